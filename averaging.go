@@ -0,0 +1,79 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import "time"
+
+// Averaging of the analog readings.
+//
+// The device averages NSamples consecutive conversions in each reading
+// (the nSamples argument of ConfigureADC). This is done in a single command,
+// so it reduces the noise with little extra latency, but only over a short
+// time window.
+//
+// The host can average several readings too (SetHostAveraging). Each one is a
+// serial round trip (a few milliseconds), so the latency grows quickly, but
+// the average spans a longer time and also attenuates low frequency noise
+// such as mains hum.
+//
+// For uncorrelated noise, the standard deviation drops by the square root of
+// the total number of samples.
+type Averaging struct {
+	Device uint8 // Conversions averaged by the device in each reading
+	Host   int   // Readings averaged by the host
+}
+
+// Return the total number of conversions averaged in each value
+func (a Averaging) Samples() int {
+	n := 1
+	if a.Device > 1 {
+		n = int(a.Device)
+	}
+	if a.Host > 1 {
+		n *= a.Host
+	}
+	return n
+}
+
+// Average n readings of the device in each value of ReadAnalog
+func (daq *OpenDAQ) SetHostAveraging(n int) {
+	daq.cfgMu.Lock()
+	daq.hostAveraging = n
+	daq.cfgMu.Unlock()
+}
+
+// Return the current averaging settings
+func (daq *OpenDAQ) GetAveraging() Averaging {
+	daq.cfgMu.RLock()
+	defer daq.cfgMu.RUnlock()
+	return Averaging{daq.nSamples, daq.hostAveraging}
+}
+
+// Analog value and information about how it was obtained
+type Reading struct {
+	Volts     float32
+	Averaging Averaging
+	Latency   time.Duration // Time taken to obtain the value
+	// Sending of the first command and reception of the last response.
+	// Use Timing.Mid to place the value on a time axis without the jitter
+	// of the serial latency.
+	Timing Timing
+}
+
+// Read a value in volts from the ADC, like ReadAnalog, with its metadata
+func (daq *OpenDAQ) ReadAnalogInfo() (Reading, error) {
+	start := time.Now()
+	v, err := daq.ReadAnalog()
+	return Reading{v, daq.GetAveraging(), time.Since(start), daq.lastReadTiming()}, err
+}
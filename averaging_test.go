@@ -0,0 +1,13 @@
+package godaq
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAveragingSamples(t *testing.T) {
+	assert.Equal(t, 1, Averaging{}.Samples())
+	assert.Equal(t, 10, Averaging{Device: 10}.Samples())
+	assert.Equal(t, 40, Averaging{Device: 10, Host: 4}.Samples())
+}
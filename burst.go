@@ -0,0 +1,91 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrStreamsExist     = errors.New("Stream experiments already created")
+	ErrInvalidNPoints   = errors.New("Invalid number of points")
+	ErrBurstIncomplete  = errors.New("Burst capture incomplete")
+	ErrNotAnalogChannel = errors.New("Not an analog input channel")
+)
+
+// Limits of the burst period
+const (
+	MinBurstPeriod = 100 * time.Microsecond
+	MaxBurstPeriod = 65535 * time.Microsecond
+)
+
+// Capture nPoints of an analog input at a high rate (one every period)
+// using a burst experiment, and return them in volts.
+// The points are stored in the device memory during the capture and then
+// transferred, reporting the number of points received to progress.
+// Burst experiments can't run together with stream experiments.
+func (daq *OpenDAQ) Burst(cfg ChannelConfig, nPoints int, period time.Duration,
+	progress func(done, total int)) ([]float32, error) {
+	if len(daq.streams) != 0 {
+		return nil, ErrStreamsExist
+	}
+	if cfg.Mode != ANALOG_INPUT {
+		return nil, ErrNotAnalogChannel
+	}
+	if nPoints < 1 || nPoints > 65535 {
+		return nil, ErrInvalidNPoints
+	}
+	if period < MinBurstPeriod || period > MaxBurstPeriod || period%time.Microsecond != 0 {
+		return nil, ErrInvalidPeriod
+	}
+
+	body := toBytes(uint16(period / time.Microsecond))
+	if _, err := daq.sendCommand(&Message{BURST_CREATE, body}, BURST_CREATE.RespLen()); err != nil {
+		return nil, err
+	}
+	// The burst experiment is handled by the firmware as the experiment 1
+	daq.streams[1] = &streamConfig{period: period}
+	defer daq.DestroyStream(1)
+	cfg.NPoints = uint16(nPoints)
+	if err := daq.ConfigureChannel(1, cfg); err != nil {
+		return nil, err
+	}
+
+	packets, err := daq.StartStream()
+	if err != nil {
+		return nil, err
+	}
+	points := make([]float32, 0, nPoints)
+	timeout := time.After(time.Duration(nPoints)*period + 5*time.Second)
+	for len(points) < nPoints {
+		select {
+		case pkt, ok := <-packets:
+			if !ok {
+				if err := daq.StopStream(); err != nil && err != ErrNotStreaming {
+					return points, err
+				}
+				return points, ErrBurstIncomplete
+			}
+			points = append(points, pkt.Volts...)
+			if progress != nil {
+				progress(len(points), nPoints)
+			}
+		case <-timeout:
+			daq.stopDraining(packets)
+			return points, ErrBurstIncomplete
+		}
+	}
+	return points[:nPoints], daq.stopDraining(packets)
+}
@@ -0,0 +1,114 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+var ErrCalibDevice = errors.New("Calibration file of another device")
+
+type calibRegister struct {
+	Index  uint    `json:"index"`
+	Gain   float32 `json:"gain"`
+	Offset float32 `json:"offset"`
+}
+
+// Zero offset of a pair of inputs (see Tare)
+type tareOffset struct {
+	Pos    uint    `json:"pos"`
+	Neg    uint    `json:"neg"`
+	Offset float32 `json:"offset"`
+}
+
+// Calibration table of a device, as stored by SaveCalibration
+type calibFile struct {
+	Name      string          `json:"name"`
+	Model     uint8           `json:"model"`
+	Version   uint8           `json:"version"`
+	Serial    string          `json:"serial"`
+	Registers []calibRegister `json:"registers"`
+	Tares     []tareOffset    `json:"tares,omitempty"`
+}
+
+// Write all the calibration registers of the device to w as JSON, along with
+// its model and serial number and the zero offsets set with Tare, e.g. to
+// back up the factory calibration.
+func (daq *OpenDAQ) SaveCalibration(w io.Writer) error {
+	model, version, serial, err := daq.GetInfo()
+	if err != nil {
+		return err
+	}
+	file := calibFile{Name: daq.Name, Model: model, Version: version, Serial: serial}
+	for i, cal := range daq.calibs() {
+		file.Registers = append(file.Registers, calibRegister{uint(i), cal.Gain, cal.Offset})
+	}
+	daq.Lock()
+	for in, offset := range daq.tares {
+		file.Tares = append(file.Tares, tareOffset{in.pos, in.neg, offset})
+	}
+	daq.Unlock()
+	sort.Slice(file.Tares, func(i, j int) bool {
+		a, b := file.Tares[i], file.Tares[j]
+		return a.Pos < b.Pos || a.Pos == b.Pos && a.Neg < b.Neg
+	})
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(file)
+}
+
+// Write to the device the calibration registers saved with SaveCalibration,
+// and set the zero offsets saved with them.
+// The file must belong to the same device (model and serial number), and
+// it's checked completely before writing any register.
+func (daq *OpenDAQ) LoadCalibration(r io.Reader) error {
+	var file calibFile
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return err
+	}
+	model, _, serial, err := daq.GetInfo()
+	if err != nil {
+		return err
+	}
+	if file.Model != model || file.Serial != serial {
+		return fmt.Errorf("%w: model %d, serial %s", ErrCalibDevice, file.Model, file.Serial)
+	}
+	nRegs := uint(len(daq.calibs()))
+	for _, reg := range file.Registers {
+		if reg.Index >= nRegs {
+			return ErrInvalidCalibIndex
+		}
+		if _, _, err := daq.encodeCalib(reg.Index, Calib{reg.Gain, reg.Offset}); err != nil {
+			return err
+		}
+	}
+	for _, tare := range file.Tares {
+		if err := daq.hw.CheckValidInputs(tare.Pos, tare.Neg); err != nil {
+			return err
+		}
+	}
+	for _, reg := range file.Registers {
+		if err := daq.writeCalib(reg.Index, Calib{reg.Gain, reg.Offset}); err != nil {
+			return err
+		}
+	}
+	for _, tare := range file.Tares {
+		daq.SetTare(tare.Pos, tare.Neg, tare.Offset)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package godaq
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveLoadCalibration(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelMId)
+	sim.Serial = 1234
+	assert.Nil(t, daq.writeCalib(2, Calib{1.25, -3}))
+	assert.Nil(t, daq.SetTare(3, 0, 0.25))
+	assert.Nil(t, daq.SetTare(1, 5, -0.5))
+
+	var b bytes.Buffer
+	assert.Nil(t, daq.SaveCalibration(&b))
+	saved := b.String()
+	var file calibFile
+	assert.Nil(t, json.Unmarshal(b.Bytes(), &file))
+	assert.Equal(t, "OpenDAQ M", file.Name)
+	assert.EqualValues(t, ModelMId, file.Model)
+	assert.Len(t, file.Registers, int(daq.NCalibRegs))
+	assert.Equal(t, calibRegister{2, 1.25, -3}, file.Registers[2])
+	assert.Equal(t, []tareOffset{{1, 5, -0.5}, {3, 0, 0.25}}, file.Tares)
+
+	assert.Nil(t, daq.writeCalib(2, Calib{1, 0}))
+	assert.Nil(t, daq.SetTare(3, 0, 0))
+	assert.Nil(t, daq.SetTare(1, 5, 0))
+	assert.Nil(t, daq.LoadCalibration(bytes.NewBufferString(saved)))
+	assert.Equal(t, Calib{1.25, -3}, daq.calib[2])
+	assert.Equal(t, SimCalib{1 << 14, -96}, sim.Calib[2])
+	assert.EqualValues(t, 0.25, daq.GetTare(3, 0))
+	assert.EqualValues(t, -0.5, daq.GetTare(1, 5))
+
+	// Another device
+	sim.Serial = 4321
+	err := daq.LoadCalibration(bytes.NewBufferString(saved))
+	assert.True(t, errors.Is(err, ErrCalibDevice))
+}
@@ -0,0 +1,343 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+var (
+	ErrCalibPoints = errors.New("Not enough calibration points")
+	ErrCalibRange  = errors.New("Calibration value out of range")
+)
+
+// Settings of the calibration of the analog inputs
+type CalibrationOptions struct {
+	Inputs   []uint        // Inputs wired to the output (all of them by default)
+	Output   uint          // Output used as reference (1 by default)
+	Points   int           // Voltages applied for each gain (5 by default)
+	NSamples uint8         // Samples averaged in each reading (20 by default)
+	Settle   time.Duration // Wait after changing the output (50 ms by default)
+	DryRun   bool          // Compute the calibration without writing it
+}
+
+// Result of a calibration
+type CalibrationReport struct {
+	Previous  map[uint]Calib // Calibration registers before the calibration
+	Registers map[uint]Calib // New values of the registers
+	Residual  float32        // RMS error of the readings with the new values (V)
+	Written   bool           // The new values were written to the device
+}
+
+// Reading of the calibration procedure
+type calibPoint struct {
+	reg1, reg2 int     // Calibration registers (reg2 is -1 without second stage)
+	gainId     uint    // PGA gain
+	raw        int     // Value read from the ADC
+	v          float32 // Voltage applied
+}
+
+// Calibrate the analog inputs against the output, which is assumed to be
+// calibrated. Each input is read with every gain while the output is set to
+// several voltages, and the gain and offset of the calibration registers are
+// fitted by least squares. The inputs must be wired to the output, in
+// single-ended mode.
+func (daq *OpenDAQ) Calibrate(opts CalibrationOptions) (CalibrationReport, error) {
+	report := CalibrationReport{Previous: make(map[uint]Calib)}
+	for i, cal := range daq.calibs() {
+		report.Previous[uint(i)] = cal
+	}
+	if opts.Output == 0 {
+		opts.Output = 1
+	}
+	if opts.Points == 0 {
+		opts.Points = 5
+	}
+	if opts.NSamples == 0 {
+		opts.NSamples = 20
+	}
+	if opts.Settle == 0 {
+		opts.Settle = 50 * time.Millisecond
+	}
+	if len(opts.Inputs) == 0 {
+		for n := uint(1); n <= daq.NInputs; n++ {
+			opts.Inputs = append(opts.Inputs, n)
+		}
+	}
+	if opts.Points < 2 {
+		return report, ErrCalibPoints
+	}
+
+	points, err := daq.calibMeasure(opts)
+	if err != nil {
+		return report, err
+	}
+	regs, err := fitCalib(&daq.Adc, points, report.Previous)
+	if err != nil {
+		return report, err
+	}
+
+	// Quantize the values as they are stored in the device
+	report.Registers = make(map[uint]Calib)
+	for idx, cal := range regs {
+		gain, offs, err := daq.encodeCalib(idx, cal)
+		if err != nil {
+			return report, err
+		}
+		report.Registers[idx] = daq.decodeCalib(idx, gain, offs)
+	}
+	report.Residual = calibResidual(&daq.Adc, points, report.Registers)
+	if opts.DryRun {
+		return report, nil
+	}
+	if err := daq.WriteCalibration(report.Registers); err != nil {
+		return report, err
+	}
+	report.Written = true
+	return report, nil
+}
+
+// Write calibration registers to the device, e.g. the ones of a report
+// computed with DryRun once they are accepted. All the values are checked
+// before writing any register.
+func (daq *OpenDAQ) WriteCalibration(regs map[uint]Calib) error {
+	nRegs := uint(len(daq.calibs()))
+	for idx, cal := range regs {
+		if idx >= nRegs {
+			return ErrInvalidCalibIndex
+		}
+		if _, _, err := daq.encodeCalib(idx, cal); err != nil {
+			return err
+		}
+	}
+	for idx, cal := range regs {
+		if err := daq.writeCalib(idx, cal); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write a calibration register to the device
+func (daq *OpenDAQ) writeCalib(idx uint, cal Calib) error {
+	if idx >= uint(len(daq.calibs())) {
+		return ErrInvalidCalibIndex
+	}
+	gain, offs, err := daq.encodeCalib(idx, cal)
+	if err != nil {
+		return err
+	}
+	body := append([]byte{byte(idx)}, toBytes([]int16{gain, offs})...)
+	if _, err := daq.sendCommand(&Message{SET_CALIB, body}, SET_CALIB.RespLen()); err != nil {
+		return err
+	}
+	cal = daq.decodeCalib(idx, gain, offs)
+	daq.Lock()
+	daq.calib[idx] = cal
+	daq.Unlock()
+	return nil
+}
+
+// Apply the calibration voltages and read them with every input and gain
+func (daq *OpenDAQ) calibMeasure(opts CalibrationOptions) ([]calibPoint, error) {
+	pos, neg, gainId, nSamples := daq.posInput, daq.negInput, daq.gainId, daq.nSamples
+	configured := daq.adcConfigured
+	defer func() {
+		daq.SetAnalog(opts.Output, 0)
+		if configured {
+			daq.ConfigureADC(pos, neg, gainId, nSamples)
+		}
+	}()
+
+	var points []calibPoint
+	for _, n := range opts.Inputs {
+		for g, pga := range daq.Adc.Gains {
+			reg1, err := daq.hw.GetCalibIndex(false, false, false, n, uint(g))
+			if err != nil {
+				return nil, err
+			}
+			reg2 := -1
+			idx, err := daq.hw.GetCalibIndex(false, false, true, n, uint(g))
+			if err == nil {
+				reg2 = int(idx)
+			} else if err != ErrNoCalibStage {
+				return nil, err
+			}
+			if err := daq.ConfigureADC(n, 0, uint(g), opts.NSamples); err != nil {
+				return nil, err
+			}
+
+			// Voltages within 80% of the ranges of both the input and the output
+			half := float64(daq.Adc.VMax-daq.Adc.VMin) / 2 / float64(pga)
+			lo := 0.8 * math.Max(-half, float64(daq.Dac.VMin))
+			hi := 0.8 * math.Min(half, float64(daq.Dac.VMax))
+			for i := 0; i < opts.Points; i++ {
+				v := lo + (hi-lo)*float64(i)/float64(opts.Points-1)
+				if err := daq.SetAnalog(opts.Output, float32(v)); err != nil {
+					return nil, err
+				}
+				time.Sleep(opts.Settle)
+				raw, err := daq.ReadADC()
+				if err != nil {
+					return nil, err
+				}
+				points = append(points, calibPoint{int(reg1), reg2, uint(g), int(raw), float32(v)})
+			}
+		}
+	}
+	return points, nil
+}
+
+// Solve y = p*a + q*b by least squares
+func fit2(a, b, y []float64) (p, q float64, err error) {
+	var saa, sab, sbb, say, sby float64
+	for i := range y {
+		saa += a[i] * a[i]
+		sab += a[i] * b[i]
+		sbb += b[i] * b[i]
+		say += a[i] * y[i]
+		sby += b[i] * y[i]
+	}
+	det := saa*sbb - sab*sab
+	if math.Abs(det) < 1e-12*saa*sbb || det == 0 {
+		return 0, 0, ErrCalibPoints
+	}
+	return (say*sbb - sby*sab) / det, (saa*sby - sab*say) / det, nil
+}
+
+// Fit the calibration registers to the readings (see ADC.ToVolts):
+// y = G1*G2*x + O1 + O2*pga, where x is the ideal and y the measured ADC value,
+// and 1 and 2 are the first and the second calibration stages.
+// Both stages are fitted alternately, starting from the previous values of the
+// registers: the split between the stages isn't unique.
+func fitCalib(adc *ADC, points []calibPoint, prev map[uint]Calib) (map[uint]Calib, error) {
+	adcGain := float64(int(1)<<adc.Bits) / float64(adc.VMax-adc.VMin)
+	baseOffs := 0
+	if !adc.Signed {
+		baseOffs = 1 << adc.Bits / 2
+	}
+	xy := func(pt calibPoint) (x, y, pga float64) {
+		pga = float64(adc.Gains[pt.gainId])
+		x = adcGain * pga * float64(pt.v)
+		if adc.Invert {
+			x = -x
+		}
+		return x, float64(pt.raw - baseOffs), pga
+	}
+	gain, offs := make(map[int]float64), make(map[int]float64)
+	for _, pt := range points {
+		for _, idx := range []int{pt.reg1, pt.reg2} {
+			if cal, ok := prev[uint(idx)]; ok && idx >= 0 {
+				gain[idx], offs[idx] = float64(cal.Gain), float64(cal.Offset)
+			} else if idx >= 0 {
+				gain[idx], offs[idx] = 1, 0
+			}
+		}
+	}
+	// Value of a register, the identity for a missing stage
+	reg := func(idx int) (float64, float64) {
+		if idx < 0 {
+			return 1, 0
+		}
+		return gain[idx], offs[idx]
+	}
+	stages := []func(pt calibPoint) (reg int, a, b, y float64){
+		func(pt calibPoint) (int, float64, float64, float64) {
+			x, y, pga := xy(pt)
+			g2, o2 := reg(pt.reg2)
+			return pt.reg1, g2 * x, 1, y - o2*pga
+		},
+		func(pt calibPoint) (int, float64, float64, float64) {
+			x, y, pga := xy(pt)
+			g1, o1 := reg(pt.reg1)
+			return pt.reg2, g1 * x, pga, y - o1
+		},
+	}
+	for iter := 0; iter < 20; iter++ {
+		for _, stage := range stages {
+			type series struct{ a, b, y []float64 }
+			data := make(map[int]*series)
+			for _, pt := range points {
+				own, a, b, y := stage(pt)
+				if own < 0 {
+					continue
+				}
+				s, ok := data[own]
+				if !ok {
+					s = &series{}
+					data[own] = s
+				}
+				s.a, s.b, s.y = append(s.a, a), append(s.b, b), append(s.y, y)
+			}
+			for idx, s := range data {
+				p, q, err := fit2(s.a, s.b, s.y)
+				if err != nil {
+					return nil, err
+				}
+				gain[idx], offs[idx] = p, q
+			}
+		}
+	}
+	regs := make(map[uint]Calib)
+	for idx := range gain {
+		regs[uint(idx)] = Calib{float32(gain[idx]), float32(offs[idx])}
+	}
+	return regs, nil
+}
+
+// RMS error in volts of the readings converted with the calibration registers
+func calibResidual(adc *ADC, points []calibPoint, regs map[uint]Calib) float32 {
+	if len(points) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, pt := range points {
+		cal2 := Calib{1, 0}
+		if pt.reg2 >= 0 {
+			cal2 = regs[uint(pt.reg2)]
+		}
+		err := float64(adc.ToVolts(pt.raw, pt.gainId, regs[uint(pt.reg1)], cal2) - pt.v)
+		sum += err * err
+	}
+	return float32(math.Sqrt(sum / float64(len(points))))
+}
+
+// The register idx holds the calibration of an output
+func (daq *OpenDAQ) isOutputReg(idx uint) bool {
+	return idx < daq.NOutputs+daq.NHiddenOutputs
+}
+
+// Encode a calibration register as stored in the device (see readCalib)
+func (daq *OpenDAQ) encodeCalib(idx uint, cal Calib) (gain, offs int16, err error) {
+	offsScale := float64(1 << 5)
+	if daq.isOutputReg(idx) {
+		offsScale = 1 << 16
+	}
+	g := math.Round(float64(cal.Gain-1) * (1 << 16))
+	o := math.Round(float64(cal.Offset) * offsScale)
+	if g < math.MinInt16 || g > math.MaxInt16 || o < math.MinInt16 || o > math.MaxInt16 {
+		return 0, 0, ErrCalibRange
+	}
+	return int16(g), int16(o), nil
+}
+
+// Decode a calibration register read from the device
+func (daq *OpenDAQ) decodeCalib(idx uint, gain, offs int16) Calib {
+	if daq.isOutputReg(idx) {
+		return Calib{1. + float32(gain)/(1<<16), float32(offs) / (1 << 16)}
+	}
+	return Calib{1. + float32(gain)/(1<<16), float32(offs) / (1 << 5)}
+}
@@ -0,0 +1,102 @@
+package godaq
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFitCalib(t *testing.T) {
+	m := NewModelM()
+	adc := &m.Adc
+	// One register per input and one per gain (the ADC of model M is inverted)
+	want := map[uint]Calib{}
+	for n := uint(1); n <= 4; n++ {
+		idx, _ := m.GetCalibIndex(false, false, false, n, 0)
+		want[idx] = Calib{1 + 0.01*float32(n), 2 * float32(n)}
+	}
+	for g := range adc.Gains {
+		idx, _ := m.GetCalibIndex(false, false, true, 1, uint(g))
+		want[idx] = Calib{1 - 0.005*float32(g), 0.5 * float32(g)}
+	}
+
+	var points []calibPoint
+	for n := uint(1); n <= 4; n++ {
+		for g, pga := range adc.Gains {
+			reg1, _ := m.GetCalibIndex(false, false, false, n, uint(g))
+			reg2, _ := m.GetCalibIndex(false, false, true, n, uint(g))
+			cal1, cal2 := want[reg1], want[reg2]
+			for _, v := range []float32{-1, -0.5, 0, 0.5, 1} {
+				v /= pga
+				raw := -v*65536/8.192*pga*cal1.Gain*cal2.Gain + cal1.Offset + cal2.Offset*pga
+				points = append(points, calibPoint{int(reg1), int(reg2), uint(g),
+					int(math.Round(float64(raw))), v})
+			}
+		}
+	}
+
+	regs, err := fitCalib(adc, points, nil)
+	assert.Nil(t, err)
+	assert.Len(t, regs, len(want))
+	assert.True(t, calibResidual(adc, points, regs) < 1e-4)
+	assert.True(t, calibResidual(adc, points, map[uint]Calib{}) > 1e-3)
+
+	_, err = fitCalib(adc, points[:1], nil)
+	assert.Equal(t, ErrCalibPoints, err)
+}
+
+func TestEncodeCalib(t *testing.T) {
+	daq, _ := newSimDAQ(t, ModelMId)
+	gain, offs, err := daq.encodeCalib(0, Calib{1.25, -0.25})
+	assert.Nil(t, err)
+	assert.Equal(t, Calib{1.25, -0.25}, daq.decodeCalib(0, gain, offs))
+	gain, offs, err = daq.encodeCalib(daq.NOutputs, Calib{0.75, 10})
+	assert.Nil(t, err)
+	assert.Equal(t, Calib{0.75, 10}, daq.decodeCalib(daq.NOutputs, gain, offs))
+
+	_, _, err = daq.encodeCalib(0, Calib{1.5, 0})
+	assert.Equal(t, ErrCalibRange, err)
+}
+
+func TestCalibrate(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelMId)
+	sim.Loopback = map[uint]uint{1: 1, 2: 1}
+	assert.Nil(t, daq.ConfigureADC(3, 0, 1, 10))
+
+	opts := CalibrationOptions{Inputs: []uint{1, 2}, Settle: time.Nanosecond, DryRun: true}
+	report, err := daq.Calibrate(opts)
+	assert.Nil(t, err)
+	assert.False(t, report.Written)
+	assert.Empty(t, sim.Calib)
+	assert.True(t, report.Residual < 1e-3)
+	// Inputs 1 and 2, and the second stage of every gain
+	assert.Len(t, report.Registers, 2+len(daq.Adc.Gains))
+	for idx, cal := range report.Registers {
+		assert.InDelta(t, 1, cal.Gain, 0.01, "register %d", idx)
+		assert.InDelta(t, 0, cal.Offset, 1, "register %d", idx)
+	}
+	// The previous configuration is restored
+	assert.EqualValues(t, 3, daq.posInput)
+	assert.EqualValues(t, 1, daq.gainId)
+	assert.EqualValues(t, 0, sim.DAC(1))
+
+	opts.DryRun = false
+	report, err = daq.Calibrate(opts)
+	assert.Nil(t, err)
+	assert.True(t, report.Written)
+	for idx, cal := range report.Registers {
+		assert.Equal(t, cal, daq.calib[idx])
+		read, err := daq.readCalib(context.Background(), uint8(idx))
+		assert.Nil(t, err)
+		assert.Equal(t, cal, read)
+	}
+
+	// Nothing is written if a register is invalid
+	before := daq.calibs()
+	err = daq.WriteCalibration(map[uint]Calib{0: {1.01, 0}, 100: {1, 0}})
+	assert.Equal(t, ErrInvalidCalibIndex, err)
+	assert.Equal(t, before, daq.calibs())
+}
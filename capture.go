@@ -0,0 +1,95 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+var ErrCaptureNotRunning = errors.New("Capture not running")
+
+// Part of the signal measured by the capture
+type CaptureMode uint8
+
+const (
+	CAPTURE_LOW    CaptureMode = 0 // Time in low state
+	CAPTURE_HIGH   CaptureMode = 1 // Time in high state
+	CAPTURE_PERIOD CaptureMode = 2 // Full period
+)
+
+// Start measuring the signal of the counter input (see HwFeatures.CounterPIO).
+// period is an estimation of the period of the signal, from 1µs to 65535µs,
+// used to set up the timer.
+// The capture uses the same timer as the counter, so it stops the counter.
+func (daq *OpenDAQ) InitCapture(period time.Duration) error {
+	if daq.CounterPIO == 0 {
+		return ErrNotSupported
+	}
+	us := period / time.Microsecond
+	if us < 1 || us > 65535 {
+		return ErrInvalidPeriod
+	}
+	daq.cfgMu.Lock()
+	defer daq.cfgMu.Unlock()
+	_, err := daq.sendCommand(&Message{CAPTURE_INIT, toBytes(uint16(us))}, CAPTURE_INIT.RespLen())
+	if err == nil {
+		daq.captureRunning, daq.counterRunning = true, false
+	}
+	return err
+}
+
+// Read the last time measured by the capture
+func (daq *OpenDAQ) ReadCapture(mode CaptureMode) (time.Duration, error) {
+	daq.cfgMu.RLock()
+	defer daq.cfgMu.RUnlock()
+	if !daq.captureRunning {
+		return 0, ErrCaptureNotRunning
+	}
+	buf, err := daq.sendCommand(&Message{GET_CAPTURE, []byte{byte(mode)}}, GET_CAPTURE.RespLen())
+	if err != nil {
+		return 0, err
+	}
+	var resp struct {
+		Mode  uint8
+		Value uint32
+	}
+	binary.Read(buf, binary.BigEndian, &resp)
+	return time.Duration(resp.Value) * time.Microsecond, nil
+}
+
+// Read the frequency of the signal in Hz, from its last measured period.
+// It's 0 if no period has been measured yet.
+func (daq *OpenDAQ) ReadFrequency() (float64, error) {
+	period, err := daq.ReadCapture(CAPTURE_PERIOD)
+	if err != nil || period == 0 {
+		return 0, err
+	}
+	return 1 / period.Seconds(), nil
+}
+
+// Stop the capture
+func (daq *OpenDAQ) StopCapture() error {
+	daq.cfgMu.Lock()
+	defer daq.cfgMu.Unlock()
+	if !daq.captureRunning {
+		return ErrCaptureNotRunning
+	}
+	_, err := daq.sendCommand(&Message{Number: CAPTURE_STOP}, CAPTURE_STOP.RespLen())
+	if err == nil {
+		daq.captureRunning = false
+	}
+	return err
+}
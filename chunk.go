@@ -0,0 +1,174 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// Large payloads are transferred as a sequence of commands (chunks).
+// Each chunk body starts with the offset of its data in the whole payload,
+// and the device echoes it in the response so lost chunks are detected.
+const chunkHeaderLen = 2
+
+var (
+	ErrChunkMismatch = errors.New("Chunk offset mismatch")
+	ErrChunkOffset   = errors.New("Chunk offset out of range")
+)
+
+type sendFunc func(command *Message, respLen int) (io.Reader, error)
+
+// Split a payload into messages carrying at most chunkSize bytes of data.
+// The offsets are expressed in items of itemSize bytes (e.g. 2 for int16 samples).
+// ErrChunkOffset is returned if an offset doesn't fit in the header.
+func splitPayload(number CommandNumber, payload []byte, chunkSize, itemSize int) ([]*Message, error) {
+	if chunkSize < itemSize || chunkSize+chunkHeaderLen > maxBodyLen || len(payload)%itemSize != 0 {
+		return nil, ErrInvalidLength
+	}
+	chunkSize -= chunkSize % itemSize
+	var msgs []*Message
+	for offs := 0; offs < len(payload); offs += chunkSize {
+		end := offs + chunkSize
+		if end > len(payload) {
+			end = len(payload)
+		}
+		if offs/itemSize > math.MaxUint16 {
+			return nil, ErrChunkOffset
+		}
+		body := make([]byte, chunkHeaderLen, chunkHeaderLen+end-offs)
+		binary.BigEndian.PutUint16(body, uint16(offs/itemSize))
+		msgs = append(msgs, &Message{number, append(body, payload[offs:end]...)})
+	}
+	return msgs, nil
+}
+
+// Check that a chunk response echoes the expected offset
+func checkChunkOffset(r io.Reader, offs uint16) error {
+	var echo uint16
+	if err := binary.Read(r, binary.BigEndian, &echo); err != nil {
+		return err
+	}
+	if echo != offs {
+		return ErrChunkMismatch
+	}
+	return nil
+}
+
+// Send the chunks of a payload in order, reporting the number of bytes sent.
+func sendChunks(send sendFunc, msgs []*Message, progress func(done, total int)) error {
+	total := 0
+	for _, msg := range msgs {
+		total += len(msg.Body) - chunkHeaderLen
+	}
+	done := 0
+	for _, msg := range msgs {
+		r, err := send(msg, chunkHeaderLen)
+		if err != nil {
+			return err
+		}
+		if err := checkChunkOffset(r, binary.BigEndian.Uint16(msg.Body)); err != nil {
+			return err
+		}
+		done += len(msg.Body) - chunkHeaderLen
+		if progress != nil {
+			progress(done, total)
+		}
+	}
+	return nil
+}
+
+// Read a payload of total bytes in chunks of at most chunkSize bytes and
+// reassemble it, reporting the number of bytes received.
+// Each request carries the offset and the length of the requested data,
+// and its response echoes the offset followed by the data.
+func readChunks(send sendFunc, number CommandNumber, total, chunkSize int,
+	progress func(done, total int)) ([]byte, error) {
+	if chunkSize < 1 || chunkSize+chunkHeaderLen > maxBodyLen {
+		return nil, ErrInvalidLength
+	}
+	if total > math.MaxUint16+1 {
+		return nil, ErrChunkOffset
+	}
+	payload := make([]byte, 0, total)
+	for offs := 0; offs < total; offs += chunkSize {
+		n := chunkSize
+		if offs+n > total {
+			n = total - offs
+		}
+		body := append(toBytes(uint16(offs)), byte(n))
+		r, err := send(&Message{number, body}, chunkHeaderLen+n)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkChunkOffset(r, uint16(offs)); err != nil {
+			return nil, err
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		payload = append(payload, data...)
+		if progress != nil {
+			progress(len(payload), total)
+		}
+	}
+	return payload, nil
+}
+
+// Return the send function of a registered command
+func (daq *OpenDAQ) chunkSender(ctx context.Context, cmd CommandNumber) (sendFunc, error) {
+	commandsMu.RLock()
+	_, ok := commands[cmd]
+	commandsMu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownCommand
+	}
+	return func(command *Message, respLen int) (io.Reader, error) {
+		return daq.sendCommandContext(ctx, command, respLen)
+	}, nil
+}
+
+// Send a large payload with a registered command of a firmware extension
+// (e.g. an EEPROM write), in as many commands as needed. Each one carries
+// the offset of its data, in items of itemSize bytes, and the device echoes
+// it in the response. progress, if not nil, is called after each chunk.
+func (daq *OpenDAQ) SendChunked(ctx context.Context, cmd CommandNumber, payload []byte, itemSize int,
+	progress func(done, total int)) error {
+	send, err := daq.chunkSender(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	msgs, err := splitPayload(cmd, payload, maxBodyLen-chunkHeaderLen, itemSize)
+	if err != nil {
+		return err
+	}
+	return sendChunks(send, msgs, progress)
+}
+
+// Read a payload of total bytes with a registered command of a firmware
+// extension, in as many commands as needed. Each one requests the offset and
+// the length of its data, and its response echoes the offset followed by the
+// data. progress, if not nil, is called after each chunk.
+func (daq *OpenDAQ) ReadChunked(ctx context.Context, cmd CommandNumber, total int,
+	progress func(done, total int)) ([]byte, error) {
+	send, err := daq.chunkSender(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	return readChunks(send, cmd, total, maxBodyLen-chunkHeaderLen, progress)
+}
@@ -0,0 +1,120 @@
+package godaq
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitPayload(t *testing.T) {
+	payload := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	msgs, err := splitPayload(SET_DAC, payload, 5, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []*Message{
+		{SET_DAC, []byte{0, 0, 1, 2, 3, 4}},
+		{SET_DAC, []byte{0, 2, 5, 6, 7, 8}},
+		{SET_DAC, []byte{0, 4, 9, 10}},
+	}, msgs)
+
+	_, err = splitPayload(SET_DAC, payload, 300, 2)
+	assert.Equal(t, ErrInvalidLength, err)
+	_, err = splitPayload(SET_DAC, payload[:3], 4, 2)
+	assert.Equal(t, ErrInvalidLength, err)
+
+	// The offset of the last chunk doesn't fit in 16 bits
+	_, err = splitPayload(SET_DAC, make([]byte, 2*(1<<16)+2), 2, 2)
+	assert.Equal(t, ErrChunkOffset, err)
+	msgs, err = splitPayload(SET_DAC, make([]byte, 2*(1<<16)), 2, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0xff, 0xff}, msgs[len(msgs)-1].Body[:2])
+}
+
+func TestSendChunks(t *testing.T) {
+	msgs, _ := splitPayload(SET_DAC, make([]byte, 10), 4, 1)
+	var progress []int
+	echo := func(m *Message, respLen int) (io.Reader, error) {
+		return bytes.NewBuffer(m.Body[:2]), nil
+	}
+	err := sendChunks(echo, msgs, func(done, total int) {
+		progress = append(progress, done)
+		assert.Equal(t, 10, total)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{4, 8, 10}, progress)
+
+	wrongEcho := func(m *Message, respLen int) (io.Reader, error) {
+		return bytes.NewBuffer([]byte{0, 0}), nil
+	}
+	assert.Equal(t, ErrChunkMismatch, sendChunks(wrongEcho, msgs, nil))
+}
+
+func TestReadChunks(t *testing.T) {
+	data := []byte("0123456789")
+	read := func(m *Message, respLen int) (io.Reader, error) {
+		offs := int(m.Body[1])
+		n := int(m.Body[2])
+		assert.Equal(t, 2+n, respLen)
+		return bytes.NewBuffer(append(m.Body[:2:2], data[offs:offs+n]...)), nil
+	}
+	payload, err := readChunks(read, GET_CALIB, len(data), 4, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, data, payload)
+
+	_, err = readChunks(read, GET_CALIB, 1<<16+1, 4, nil)
+	assert.Equal(t, ErrChunkOffset, err)
+}
+
+const (
+	VENDOR_EE_W CommandNumber = 170
+	VENDOR_EE_R CommandNumber = 171
+)
+
+func TestChunkedTransfer(t *testing.T) {
+	assert.Nil(t, RegisterCommand(CommandSpec{VENDOR_EE_W, "VENDOR_EE_W", 2}))
+	assert.Nil(t, RegisterCommand(CommandSpec{VENDOR_EE_R, "VENDOR_EE_R", -1}))
+	t.Cleanup(func() {
+		unregisterCommand(VENDOR_EE_W)
+		unregisterCommand(VENDOR_EE_R)
+	})
+	daq, sim := newSimDAQ(t, ModelMId)
+	eeprom := make([]byte, 600)
+	sim.Commands = map[CommandNumber]func([]byte) ([]byte, bool){
+		VENDOR_EE_W: func(b []byte) ([]byte, bool) {
+			copy(eeprom[binary.BigEndian.Uint16(b):], b[2:])
+			return b[:2], true
+		},
+		VENDOR_EE_R: func(b []byte) ([]byte, bool) {
+			offs := binary.BigEndian.Uint16(b)
+			return append(b[:2:2], eeprom[offs:int(offs)+int(b[2])]...), true
+		},
+	}
+
+	data := make([]byte, len(eeprom))
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	var progress []int
+	err := daq.SendChunked(context.Background(), VENDOR_EE_W, data, 1, func(done, total int) {
+		progress = append(progress, done)
+		assert.Equal(t, len(data), total)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{253, 506, 600}, progress)
+	assert.Equal(t, data, eeprom)
+
+	progress = nil
+	read, err := daq.ReadChunked(context.Background(), VENDOR_EE_R, len(data), func(done, total int) {
+		progress = append(progress, done)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, data, read)
+	assert.Equal(t, []int{253, 506, 600}, progress)
+
+	_, err = daq.ReadChunked(context.Background(), 172, 10, nil)
+	assert.Equal(t, ErrUnknownCommand, err)
+	assert.Equal(t, ErrUnknownCommand, daq.SendChunked(context.Background(), 172, data, 1, nil))
+}
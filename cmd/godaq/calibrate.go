@@ -0,0 +1,135 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/opendaq/godaq"
+)
+
+// Guide the user through the calibration of the analog inputs: save a backup
+// of the current calibration, measure the inputs wired to the output, show
+// the new values and write them once confirmed
+func calibrate(args []string) error {
+	fs := flag.NewFlagSet("calibrate", flag.ExitOnError)
+	port := fs.String("port", "/dev/ttyUSB0", "serial port of the device")
+	output := fs.Uint("output", 1, "analog output used as reference")
+	inputs := fs.String("inputs", "", "comma-separated inputs wired to the output (all by default)")
+	points := fs.Int("points", 5, "voltages applied for each gain")
+	fs.Parse(args)
+
+	opts := godaq.CalibrationOptions{Output: *output, Points: *points, DryRun: true}
+	if *inputs != "" {
+		for _, s := range strings.Split(*inputs, ",") {
+			n, err := strconv.ParseUint(strings.TrimSpace(s), 10, 8)
+			if err != nil {
+				return fmt.Errorf("invalid input %q", s)
+			}
+			opts.Inputs = append(opts.Inputs, uint(n))
+		}
+	}
+
+	daq, err := godaq.New(*port)
+	if err != nil {
+		return err
+	}
+	defer daq.Close()
+	info := daq.GetDeviceInfo()
+	fmt.Printf("%s, serial %s\n\n", info.ModelName, info.Serial)
+
+	sc := bufio.NewScanner(os.Stdin)
+	ask := func(question string) (string, error) {
+		fmt.Print(question)
+		if !sc.Scan() {
+			if err := sc.Err(); err != nil {
+				return "", err
+			}
+			return "", errors.New("calibration aborted")
+		}
+		return strings.TrimSpace(sc.Text()), nil
+	}
+
+	backup := fmt.Sprintf("calib-%s.json", info.Serial)
+	answer, err := ask(fmt.Sprintf("Save a backup of the current calibration to %s? [Y/n] ", backup))
+	if err != nil {
+		return err
+	}
+	if answer == "" || strings.EqualFold(answer, "y") {
+		if err := saveCalibration(daq, backup); err != nil {
+			return err
+		}
+		fmt.Println("Backup saved to", backup)
+	}
+
+	wired := "all the inputs"
+	if *inputs != "" {
+		wired = "the inputs " + *inputs
+	}
+	if _, err := ask(fmt.Sprintf("Wire %s to the output %d and press Enter ", wired, *output)); err != nil {
+		return err
+	}
+	fmt.Println("Measuring...")
+	report, err := daq.Calibrate(opts)
+	if err != nil {
+		return err
+	}
+
+	var regs []int
+	for idx := range report.Registers {
+		regs = append(regs, int(idx))
+	}
+	sort.Ints(regs)
+	fmt.Println()
+	fmt.Println("| Register | Gain | Offset | New gain | New offset |")
+	fmt.Println("|---|---|---|---|---|")
+	for _, idx := range regs {
+		prev, cal := report.Previous[uint(idx)], report.Registers[uint(idx)]
+		fmt.Printf("| %d | %.5f | %.5f | %.5f | %.5f |\n", idx, prev.Gain, prev.Offset, cal.Gain, cal.Offset)
+	}
+	fmt.Printf("\nResidual error: %.3g V\n\n", report.Residual)
+
+	answer, err = ask("Write the new calibration to the device? [y/N] ")
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(answer, "y") {
+		fmt.Println("Nothing written")
+		return nil
+	}
+	if err := daq.WriteCalibration(report.Registers); err != nil {
+		return err
+	}
+	fmt.Println("Calibration written")
+	return nil
+}
+
+func saveCalibration(daq *godaq.OpenDAQ, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := daq.SaveCalibration(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,55 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/opendaq/godaq"
+)
+
+// Check which features are supported by a device (or by the simulator) and
+// print them as a Markdown table
+func conformance(args []string) error {
+	fs := flag.NewFlagSet("conformance", flag.ExitOnError)
+	port := fs.String("port", "/dev/ttyUSB0", "serial port of the device")
+	sim := fs.Uint("sim", 0, "check a simulated device of this model number instead")
+	fs.Parse(args)
+
+	var daq *godaq.OpenDAQ
+	var err error
+	if *sim != 0 {
+		var s *godaq.Simulator
+		if s, err = godaq.NewSimulator(uint8(*sim)); err != nil {
+			return err
+		}
+		daq, err = godaq.NewFromTransport(s)
+	} else {
+		daq, err = godaq.New(*port)
+	}
+	if err != nil {
+		return err
+	}
+	defer daq.Close()
+
+	results, err := daq.CheckConformance()
+	if err != nil {
+		return err
+	}
+	fmt.Println("#", daq.Name)
+	fmt.Println()
+	return godaq.WriteConformanceTable(os.Stdout, results)
+}
@@ -0,0 +1,68 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command godaq is a command line tool for openDAQ devices.
+//
+// Usage:
+//
+//	godaq <command> [flags]
+//
+// Commands:
+//
+//	calibrate    guide the calibration of the analog inputs
+//	conformance  report the features supported by a device
+//	shell        interactive shell to send commands to a device
+//	soak         exercise a device for a long time and report its reliability
+//	wiring       guide the wiring of the terminals and check each of them
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+var commands = map[string]func(args []string) error{
+	"calibrate":   calibrate,
+	"conformance": conformance,
+	"shell":       shell,
+	"soak":        soak,
+	"wiring":      wiring,
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: godaq <command> [flags]\n\ncommands:")
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintln(os.Stderr, "  ", name)
+	}
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+	}
+	if err := cmd(os.Args[2:]); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,298 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opendaq/godaq"
+)
+
+var errUsage = errors.New("invalid arguments")
+
+type shellCmd struct {
+	usage string
+	run   func(daq *godaq.OpenDAQ, args []string) error
+}
+
+var shellCmds map[string]shellCmd
+
+func init() {
+	shellCmds = map[string]shellCmd{
+		"info":      {"info", shellInfo},
+		"read ain":  {"read ain <pos> [neg [gain]]", shellReadAin},
+		"read pio":  {"read pio <n>", shellReadPIO},
+		"read port": {"read port", shellReadPort},
+		"set dac":   {"set dac <n> <volts>", shellSetDac},
+		"set pio":   {"set pio <n> <0|1>", shellSetPIO},
+		"set led":   {"set led <n> <off|green|red|yellow>", shellSetLed},
+		"dir pio":   {"dir pio <n> <in|out>", shellDirPIO},
+		"watch ain": {"watch ain <pos> [neg [gain]]  (Ctrl-C to stop)", shellWatchAin},
+		"watch pio": {"watch pio <n>  (Ctrl-C to stop)", shellWatchPIO},
+	}
+}
+
+func parseUints(args []string, min, max int) ([]uint, error) {
+	if len(args) < min || len(args) > max {
+		return nil, errUsage
+	}
+	vals := make([]uint, len(args))
+	for i, arg := range args {
+		v, err := strconv.ParseUint(arg, 10, 8)
+		if err != nil {
+			return nil, errUsage
+		}
+		vals[i] = uint(v)
+	}
+	return vals, nil
+}
+
+func shellInfo(daq *godaq.OpenDAQ, args []string) error {
+	model, version, serial, err := daq.GetInfo()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s (model %d), firmware %d, serial %s\n", daq.Name, model, version, serial)
+	fmt.Printf("inputs: %d, outputs: %d, PIOs: %d, LEDs: %d\n",
+		daq.NInputs, daq.NOutputs, daq.NPIOs, daq.NLeds)
+	return nil
+}
+
+// Select the input given by the arguments: <pos> [neg [gain]]
+func configureAin(daq *godaq.OpenDAQ, args []string) error {
+	vals, err := parseUints(args, 1, 3)
+	if err != nil {
+		return err
+	}
+	vals = append(vals, 0, 0)
+	return daq.ConfigureADC(vals[0], vals[1], vals[2], 10)
+}
+
+func shellReadAin(daq *godaq.OpenDAQ, args []string) error {
+	if err := configureAin(daq, args); err != nil {
+		return err
+	}
+	v, err := daq.ReadAnalog()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%.4f V\n", v)
+	return nil
+}
+
+func shellReadPIO(daq *godaq.OpenDAQ, args []string) error {
+	vals, err := parseUints(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	v, err := daq.ReadPIO(vals[0])
+	if err != nil {
+		return err
+	}
+	fmt.Println(v)
+	return nil
+}
+
+func shellReadPort(daq *godaq.OpenDAQ, args []string) error {
+	v, err := daq.ReadPort()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%08b\n", v)
+	return nil
+}
+
+func shellSetDac(daq *godaq.OpenDAQ, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	n, err := parseUints(args[:1], 1, 1)
+	if err != nil {
+		return err
+	}
+	v, err := strconv.ParseFloat(args[1], 32)
+	if err != nil {
+		return errUsage
+	}
+	return daq.SetAnalog(n[0], float32(v))
+}
+
+func shellSetPIO(daq *godaq.OpenDAQ, args []string) error {
+	vals, err := parseUints(args, 2, 2)
+	if err != nil {
+		return err
+	}
+	return daq.SetPIO(vals[0], vals[1] != 0)
+}
+
+func shellSetLed(daq *godaq.OpenDAQ, args []string) error {
+	colors := map[string]godaq.Color{"off": godaq.OFF, "green": godaq.GREEN,
+		"red": godaq.RED, "yellow": godaq.YELLOW}
+	if len(args) != 2 {
+		return errUsage
+	}
+	n, err := parseUints(args[:1], 1, 1)
+	if err != nil {
+		return err
+	}
+	c, ok := colors[args[1]]
+	if !ok {
+		return errUsage
+	}
+	return daq.SetLED(n[0], c)
+}
+
+func shellDirPIO(daq *godaq.OpenDAQ, args []string) error {
+	if len(args) != 2 || (args[1] != "in" && args[1] != "out") {
+		return errUsage
+	}
+	n, err := parseUints(args[:1], 1, 1)
+	if err != nil {
+		return err
+	}
+	return daq.SetPIODir(n[0], args[1] == "out")
+}
+
+// Call read periodically until Ctrl-C is pressed
+func watch(read func() (string, error)) error {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	defer signal.Stop(stop)
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		s, err := read()
+		if err != nil {
+			return err
+		}
+		fmt.Println(s)
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func shellWatchAin(daq *godaq.OpenDAQ, args []string) error {
+	if err := configureAin(daq, args); err != nil {
+		return err
+	}
+	return watch(func() (string, error) {
+		v, err := daq.ReadAnalog()
+		return fmt.Sprintf("%.4f V", v), err
+	})
+}
+
+func shellWatchPIO(daq *godaq.OpenDAQ, args []string) error {
+	vals, err := parseUints(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	return watch(func() (string, error) {
+		v, err := daq.ReadPIO(vals[0])
+		return strconv.Itoa(int(v)), err
+	})
+}
+
+func shellHelp() {
+	var usages []string
+	for _, cmd := range shellCmds {
+		usages = append(usages, cmd.usage)
+	}
+	sort.Strings(usages)
+	usages = append(usages, "history", "!! (repeat the last command)",
+		"!<n> (repeat command n)", "quit")
+	for _, u := range usages {
+		fmt.Println("  " + u)
+	}
+}
+
+// Run a command line
+func shellRun(daq *godaq.OpenDAQ, line string) error {
+	words := strings.Fields(line)
+	if cmd, ok := shellCmds[words[0]]; ok {
+		return cmd.run(daq, words[1:])
+	}
+	if len(words) > 1 {
+		if cmd, ok := shellCmds[words[0]+" "+words[1]]; ok {
+			if err := cmd.run(daq, words[2:]); err != errUsage {
+				return err
+			}
+			return fmt.Errorf("usage: %s", cmd.usage)
+		}
+	}
+	return errors.New("unknown command, type help")
+}
+
+// Interactive shell over the device API.
+// It keeps a command history but no line editing; run it under rlwrap
+// to get editing and completion.
+func shell(args []string) error {
+	fs := flag.NewFlagSet("shell", flag.ExitOnError)
+	port := fs.String("port", "/dev/ttyUSB0", "serial port of the device")
+	fs.Parse(args)
+
+	daq, err := godaq.New(*port)
+	if err != nil {
+		return err
+	}
+	defer daq.Close()
+
+	var history []string
+	sc := bufio.NewScanner(os.Stdin)
+	for fmt.Print("godaq> "); sc.Scan(); fmt.Print("godaq> ") {
+		line := strings.TrimSpace(sc.Text())
+		if strings.HasPrefix(line, "!") && len(history) > 0 {
+			i := len(history)
+			if line != "!!" {
+				if i, err = strconv.Atoi(line[1:]); err != nil || i < 1 || i > len(history) {
+					fmt.Println("no such command in history")
+					continue
+				}
+			}
+			line = history[i-1]
+			fmt.Println(line)
+		}
+
+		switch line {
+		case "":
+			continue
+		case "quit", "exit":
+			return nil
+		case "help":
+			shellHelp()
+		case "history":
+			for i, l := range history {
+				fmt.Printf("%4d  %s\n", i+1, l)
+			}
+		default:
+			if err := shellRun(daq, line); err != nil {
+				fmt.Println("error:", err)
+			}
+		}
+		history = append(history, line)
+	}
+	fmt.Println()
+	return sc.Err()
+}
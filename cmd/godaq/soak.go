@@ -0,0 +1,172 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/opendaq/godaq"
+)
+
+// Number of readings averaged to compute the drift
+const driftWindow = 100
+
+type soakReport struct {
+	Port          string
+	Start         time.Time
+	Duration      time.Duration
+	Readings      uint64
+	Errors        uint64
+	Reconnections uint64
+	Stats         godaq.Stats
+	Min, Max      float64
+	first, last   []float64
+}
+
+func mean(vals []float64) float64 {
+	var sum float64
+	for _, v := range vals {
+		sum += v
+	}
+	return sum / float64(len(vals))
+}
+
+func (r *soakReport) add(v float32) {
+	r.Readings++
+	r.Min = math.Min(r.Min, float64(v))
+	r.Max = math.Max(r.Max, float64(v))
+	if len(r.first) < driftWindow {
+		r.first = append(r.first, float64(v))
+	}
+	r.last = append(r.last, float64(v))
+	if len(r.last) > driftWindow {
+		r.last = r.last[1:]
+	}
+}
+
+func (r *soakReport) addStats(s godaq.Stats) {
+	r.Stats.Commands += s.Commands
+	r.Stats.Retries += s.Retries
+	r.Stats.Errors += s.Errors
+}
+
+func (r *soakReport) write(w io.Writer) {
+	fmt.Fprintf(w, "Port:           %s\n", r.Port)
+	fmt.Fprintf(w, "Start:          %s\n", r.Start.Format(time.RFC3339))
+	fmt.Fprintf(w, "Duration:       %s\n", r.Duration.Round(time.Second))
+	fmt.Fprintf(w, "Commands:       %d\n", r.Stats.Commands)
+	fmt.Fprintf(w, "Retries:        %d\n", r.Stats.Retries)
+	fmt.Fprintf(w, "Failed cmds:    %d\n", r.Stats.Errors)
+	fmt.Fprintf(w, "Reading errors: %d\n", r.Errors)
+	fmt.Fprintf(w, "Reconnections:  %d\n", r.Reconnections)
+	fmt.Fprintf(w, "Readings:       %d\n", r.Readings)
+	if r.Readings > 0 {
+		fmt.Fprintf(w, "Range:          %.6f .. %.6f V\n", r.Min, r.Max)
+		fmt.Fprintf(w, "Drift:          %.6f V\n", mean(r.last)-mean(r.first))
+	}
+}
+
+// Open the device and configure the input to read
+func soakOpen(port string, input, gainId uint) (*godaq.OpenDAQ, error) {
+	daq, err := godaq.New(port)
+	if err != nil {
+		return nil, err
+	}
+	if err := daq.ConfigureADC(input, 0, gainId, 10); err != nil {
+		daq.Close()
+		return nil, err
+	}
+	return daq, nil
+}
+
+func soak(args []string) error {
+	fs := flag.NewFlagSet("soak", flag.ExitOnError)
+	port := fs.String("port", "/dev/ttyUSB0", "serial port of the device")
+	duration := fs.Duration("duration", time.Hour, "test duration")
+	interval := fs.Duration("interval", 100*time.Millisecond, "time between readings")
+	input := fs.Uint("input", 1, "analog input to read")
+	gainId := fs.Uint("gain", 0, "gain ID of the input")
+	maxErrors := fs.Int("reconnect", 3, "consecutive errors before reconnecting")
+	reportPath := fs.String("report", "", "write the report to this file instead of stdout")
+	fs.Parse(args)
+
+	report := soakReport{Port: *port, Start: time.Now(), Min: math.Inf(1), Max: math.Inf(-1)}
+	daq, err := soakOpen(*port, *input, *gainId)
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	deadline := time.After(*duration)
+
+	errCount := 0
+loop:
+	for {
+		select {
+		case <-stop:
+			break loop
+		case <-deadline:
+			break loop
+		case <-ticker.C:
+		}
+
+		if daq == nil {
+			if daq, err = soakOpen(*port, *input, *gainId); err != nil {
+				continue
+			}
+			report.Reconnections++
+		}
+		v, err := daq.ReadAnalog()
+		if err == nil {
+			errCount = 0
+			report.add(v)
+			continue
+		}
+		log.Println(err)
+		report.Errors++
+		if errCount++; errCount >= *maxErrors {
+			report.addStats(daq.Stats())
+			daq.Close()
+			daq = nil
+			errCount = 0
+		}
+	}
+	if daq != nil {
+		report.addStats(daq.Stats())
+		daq.Close()
+	}
+	report.Duration = time.Since(report.Start)
+
+	w := os.Stdout
+	if *reportPath != "" {
+		f, err := os.Create(*reportPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	report.write(w)
+	return nil
+}
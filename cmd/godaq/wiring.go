@@ -0,0 +1,70 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/opendaq/godaq"
+)
+
+// Guide the user through the wiring of the terminals of a device, checking
+// each of them, and print the report as a Markdown table
+func wiring(args []string) error {
+	fs := flag.NewFlagSet("wiring", flag.ExitOnError)
+	port := fs.String("port", "/dev/ttyUSB0", "serial port of the device")
+	output := fs.Uint("output", 1, "analog output driving the inputs")
+	tolerance := fs.Float64("tolerance", 0.1, "maximum error of the analog readings (V)")
+	pios := fs.Bool("pio", false, "check the PIOs too, in pairs")
+	fs.Parse(args)
+
+	daq, err := godaq.New(*port)
+	if err != nil {
+		return err
+	}
+	defer daq.Close()
+
+	sc := bufio.NewScanner(os.Stdin)
+	prompt := func(instruction string) error {
+		fmt.Printf("%s and press Enter (s to skip): ", instruction)
+		if !sc.Scan() {
+			if err := sc.Err(); err != nil {
+				return err
+			}
+			return errors.New("wiring check aborted")
+		}
+		if strings.TrimSpace(sc.Text()) == "s" {
+			return godaq.ErrSkipCheck
+		}
+		return nil
+	}
+	checks, err := daq.CheckWiring(godaq.WiringConfig{
+		Prompt:    prompt,
+		Output:    *output,
+		Tolerance: float32(*tolerance),
+		PIOs:      *pios,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println()
+	fmt.Println("#", daq.Name)
+	fmt.Println()
+	return godaq.WriteWiringReport(os.Stdout, checks)
+}
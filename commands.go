@@ -0,0 +1,129 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Command numbers of the openDAQ serial protocol
+const (
+	AIN          CommandNumber = 1
+	AIN_CFG      CommandNumber = 2
+	PIO          CommandNumber = 3
+	AIN_ALL      CommandNumber = 4
+	PIO_DIR      CommandNumber = 5
+	PORT         CommandNumber = 7
+	PORT_DIR     CommandNumber = 9
+	SET_DAC      CommandNumber = 13
+	CAPTURE_INIT CommandNumber = 14
+	CAPTURE_STOP CommandNumber = 15
+	GET_CAPTURE  CommandNumber = 16
+	LED_W        CommandNumber = 18
+	LOAD_SIGNAL  CommandNumber = 23
+	SET_ANALOG   CommandNumber = 24
+	GET_CALIB    CommandNumber = 36
+	SET_CALIB    CommandNumber = 37
+	ID_CONFIG    CommandNumber = 39
+	GET_AIN_CFG  CommandNumber = 40
+	COUNTER_INIT CommandNumber = 41
+	GET_COUNTER  CommandNumber = 42
+
+	STREAM_CREATE   CommandNumber = 19
+	EXTERNAL_CREATE CommandNumber = 20
+	BURST_CREATE    CommandNumber = 21
+	CHANNEL_CFG     CommandNumber = 22
+	STREAM_DATA     CommandNumber = 25
+	CHANNEL_SETUP   CommandNumber = 32
+	CHANNEL_DESTROY CommandNumber = 57
+	STREAM_START    CommandNumber = 64
+	STREAM_STOP     CommandNumber = 80
+)
+
+type commandInfo struct {
+	name    string
+	respLen int // Length of the response body (-1 if it's variable)
+}
+
+// Commands of the protocol, extended by RegisterCommand
+var (
+	commandsMu sync.RWMutex
+	commands   = map[CommandNumber]commandInfo{
+		AIN:          {"AIN", 2},
+		AIN_CFG:      {"AIN_CFG", 6},
+		PIO:          {"PIO", 2},
+		AIN_ALL:      {"AIN_ALL", -1},
+		PIO_DIR:      {"PIO_DIR", 2},
+		PORT:         {"PORT", 1},
+		PORT_DIR:     {"PORT_DIR", 1},
+		SET_DAC:      {"SET_DAC", 3},
+		CAPTURE_INIT: {"CAPTURE_INIT", 2},
+		CAPTURE_STOP: {"CAPTURE_STOP", 0},
+		GET_CAPTURE:  {"GET_CAPTURE", 5},
+		LED_W:        {"LED_W", 2},
+		LOAD_SIGNAL:  {"LOAD_SIGNAL", 4},
+		SET_ANALOG:   {"SET_ANALOG", -1},
+		GET_CALIB:    {"GET_CALIB", 5},
+		SET_CALIB:    {"SET_CALIB", 5},
+		ID_CONFIG:    {"ID_CONFIG", 6},
+		GET_AIN_CFG:  {"GET_AIN_CFG", 6},
+		COUNTER_INIT: {"COUNTER_INIT", 1},
+		GET_COUNTER:  {"GET_COUNTER", 2},
+
+		STREAM_CREATE:   {"STREAM_CREATE", 3},
+		EXTERNAL_CREATE: {"EXTERNAL_CREATE", 2},
+		BURST_CREATE:    {"BURST_CREATE", 2},
+		CHANNEL_CFG:     {"CHANNEL_CFG", 6},
+		STREAM_DATA:     {"STREAM_DATA", -1},
+		CHANNEL_SETUP:   {"CHANNEL_SETUP", 4},
+		CHANNEL_DESTROY: {"CHANNEL_DESTROY", 1},
+		STREAM_START:    {"STREAM_START", 0},
+		STREAM_STOP:     {"STREAM_STOP", 0},
+	}
+)
+
+// Return the name of the command (e.g. for tracing)
+func (c CommandNumber) String() string {
+	commandsMu.RLock()
+	defer commandsMu.RUnlock()
+	if info, ok := commands[c]; ok {
+		return info.name
+	}
+	return fmt.Sprintf("CMD_%d", uint8(c))
+}
+
+// Return the expected length of the response body, or -1 if it's variable
+// or the command isn't registered
+func (c CommandNumber) RespLen() int {
+	commandsMu.RLock()
+	defer commandsMu.RUnlock()
+	info, ok := commands[c]
+	if !ok {
+		return -1
+	}
+	return info.respLen
+}
+
+// Find a command by its name
+func LookupCommand(name string) (CommandNumber, bool) {
+	commandsMu.RLock()
+	defer commandsMu.RUnlock()
+	for c, info := range commands {
+		if info.name == name {
+			return c, true
+		}
+	}
+	return 0, false
+}
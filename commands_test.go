@@ -0,0 +1,20 @@
+package godaq
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandNames(t *testing.T) {
+	assert.Equal(t, "ID_CONFIG", ID_CONFIG.String())
+	assert.Equal(t, "CMD_200", CommandNumber(200).String())
+	assert.Equal(t, 6, ID_CONFIG.RespLen())
+	assert.Equal(t, -1, CommandNumber(200).RespLen())
+
+	c, ok := LookupCommand("GET_CALIB")
+	assert.True(t, ok)
+	assert.Equal(t, GET_CALIB, c)
+	_, ok = LookupCommand("FOO")
+	assert.False(t, ok)
+}
@@ -0,0 +1,220 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrConfigMismatch = errors.New("Device configuration changed")
+	ErrDeviceReset    = errors.New("Device reset detected")
+)
+
+// Configuration of the ADC
+type ADCConfig struct {
+	PosInput, NegInput, GainId uint
+	NSamples                   uint8
+}
+
+// Error returned when the configuration of the device differs from the one
+// set by the library, e.g. after a brown-out reset.
+// errors.Is(err, ErrConfigMismatch) is true for it, and
+// errors.Is(err, ErrDeviceReset) is true too if the device was reset.
+type ConfigMismatchError struct {
+	Device, Expected ADCConfig
+}
+
+func (e *ConfigMismatchError) Error() string {
+	return fmt.Sprintf("%s: ADC %+v, expected %+v", ErrConfigMismatch, e.Device, e.Expected)
+}
+
+func (e *ConfigMismatchError) Is(target error) bool {
+	return target == ErrConfigMismatch || target == ErrDeviceReset && e.IsReset()
+}
+
+// The device has lost its configuration.
+// The library never selects the input 0, so the device was reset if it
+// reports it.
+func (e *ConfigMismatchError) IsReset() bool {
+	return e.Device.PosInput == 0
+}
+
+// Read the ADC configuration stored by the device
+func (daq *OpenDAQ) readADCConfig() (ADCConfig, error) {
+	buf, err := daq.sendCommand(&Message{Number: GET_AIN_CFG}, GET_AIN_CFG.RespLen())
+	if err != nil {
+		return ADCConfig{}, err
+	}
+	var resp struct {
+		Value                          int16
+		PosInput, NegInput, GainId, NS uint8
+	}
+	binary.Read(buf, binary.BigEndian, &resp)
+	return ADCConfig{uint(resp.PosInput), uint(resp.NegInput), uint(resp.GainId), resp.NS}, nil
+}
+
+// Read the ADC configuration stored by the device
+func (daq *OpenDAQ) ReadADCConfig() (posInput, negInput, gainId uint, nSamples uint8, err error) {
+	cfg, err := daq.readADCConfig()
+	return cfg.PosInput, cfg.NegInput, cfg.GainId, cfg.NSamples, err
+}
+
+// Update the ADC configuration kept by the library (used to convert the
+// readings to volts) with the one stored by the device, e.g. after
+// reconnecting to a device configured by another program.
+// ErrDeviceReset is returned if the device isn't configured.
+func (daq *OpenDAQ) SyncADCConfig() error {
+	daq.cfgMu.Lock()
+	defer daq.cfgMu.Unlock()
+	cfg, err := daq.readADCConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.PosInput == 0 {
+		return ErrDeviceReset
+	}
+	if err := daq.hw.CheckValidInputs(cfg.PosInput, cfg.NegInput); err != nil {
+		return err
+	}
+	if cfg.GainId >= uint(len(daq.Adc.Gains)) {
+		return ErrInvalidGainID
+	}
+	if cfg.PosInput != daq.posInput || cfg.NegInput != daq.negInput || cfg.GainId != daq.gainId {
+		daq.setUnsettled()
+	}
+	daq.posInput, daq.negInput = cfg.PosInput, cfg.NegInput
+	daq.gainId, daq.nSamples = cfg.GainId, cfg.NSamples
+	daq.diffMode = cfg.NegInput != 0
+	daq.adcConfigured = true
+	return nil
+}
+
+// Compare the configuration of the device with the one set by the library.
+// A *ConfigMismatchError is returned if they differ.
+// The direction of the PIOs can't be read back, so it's not checked.
+func (daq *OpenDAQ) CheckConfig() error {
+	// The configuration can't change while it's compared
+	daq.cfgMu.Lock()
+	defer daq.cfgMu.Unlock()
+	if !daq.adcConfigured {
+		return nil
+	}
+	dev, err := daq.readADCConfig()
+	if err != nil {
+		return err
+	}
+	expected := ADCConfig{daq.posInput, daq.negInput, daq.gainId, daq.nSamples}
+	if dev != expected {
+		return &ConfigMismatchError{dev, expected}
+	}
+	return nil
+}
+
+// Check the configuration of the device every period (1 s if it's 0) and
+// send the mismatches found, until ctx is done. The checks are skipped while
+// streaming.
+// If the device was reset and SetAutoRestore is enabled, the configuration
+// is restored after sending the mismatch, and the error of Restore is sent
+// if it fails.
+func (daq *OpenDAQ) WatchConfig(ctx context.Context, period time.Duration) <-chan error {
+	if period <= 0 {
+		period = time.Second
+	}
+	out := make(chan error, 1)
+	go func() {
+		defer close(out)
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			err := daq.CheckConfig()
+			if !errors.Is(err, ErrConfigMismatch) {
+				continue
+			}
+			select {
+			case out <- err:
+			case <-ctx.Done():
+				return
+			}
+			daq.Lock()
+			autoRestore := daq.autoRestore
+			daq.Unlock()
+			if !errors.Is(err, ErrDeviceReset) || !autoRestore {
+				continue
+			}
+			if err := daq.Restore(); err != nil {
+				select {
+				case out <- err:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// Restore the configuration of the device automatically when WatchConfig
+// detects a reset
+func (daq *OpenDAQ) SetAutoRestore(on bool) {
+	daq.Lock()
+	daq.autoRestore = on
+	daq.Unlock()
+}
+
+// Write again the configuration set by the library (ADC, analog outputs and
+// PIOs), e.g. after a reset of the device.
+// Counters, captures and stream experiments are not restored: ReadCounter
+// and ReadCapture fail until they are started again.
+// The calls changing the configuration wait until it's restored, so it can be
+// used while other goroutines use the device.
+func (daq *OpenDAQ) Restore() error {
+	daq.cfgMu.Lock()
+	defer daq.cfgMu.Unlock()
+	if daq.adcConfigured {
+		_, err := daq.sendCommand(&Message{AIN_CFG, []byte{byte(daq.posInput), byte(daq.negInput),
+			byte(daq.gainId), daq.nSamples}}, AIN_CFG.RespLen())
+		if err != nil {
+			return err
+		}
+		// The input was switched by the reset
+		daq.setUnsettled()
+	}
+	daq.Lock()
+	dacValues := make(map[uint]int, len(daq.dacValues))
+	for n, val := range daq.dacValues {
+		dacValues[n] = val
+	}
+	port := PortState{daq.portDir, daq.portOut}
+	daq.Unlock()
+	for n, val := range dacValues {
+		if err := daq.setDAC(n, val); err != nil {
+			return err
+		}
+	}
+	if err := daq.setPortState(port); err != nil {
+		return err
+	}
+	daq.counterRunning, daq.captureRunning = false, false
+	return nil
+}
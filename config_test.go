@@ -0,0 +1,125 @@
+package godaq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckConfig(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelMId)
+
+	// Nothing to check before configuring the ADC
+	assert.Nil(t, daq.CheckConfig())
+
+	assert.Nil(t, daq.ConfigureADC(2, 0, 1, 10))
+	assert.Nil(t, daq.CheckConfig())
+
+	// Brown-out reset
+	sim.Reset()
+	err := daq.CheckConfig()
+	assert.True(t, errors.Is(err, ErrConfigMismatch))
+	assert.True(t, errors.Is(err, ErrDeviceReset))
+	assert.Equal(t, &ConfigMismatchError{ADCConfig{}, ADCConfig{2, 0, 1, 10}}, err)
+}
+
+func TestSyncADCConfig(t *testing.T) {
+	other, sim := newSimDAQ(t, ModelMId)
+	assert.Nil(t, other.ConfigureADC(3, 6, 2, 5))
+
+	// Reconnect to the device configured by another program
+	daq, err := NewFromTransport(sim)
+	assert.Nil(t, err)
+	pos, neg, gainId, nSamples, err := daq.ReadADCConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, []uint{3, 6, 2}, []uint{pos, neg, gainId})
+	assert.EqualValues(t, 5, nSamples)
+
+	assert.Nil(t, daq.SyncADCConfig())
+	assert.True(t, daq.diffMode)
+	assert.Equal(t, []uint{3, 6, 2}, []uint{daq.posInput, daq.negInput, daq.gainId})
+	assert.Nil(t, daq.CheckConfig())
+
+	sim.Reset()
+	assert.Equal(t, ErrDeviceReset, daq.SyncADCConfig())
+}
+
+func TestWatchConfigPeriod(t *testing.T) {
+	daq, _ := newSimDAQ(t, ModelMId)
+	// The default period is used
+	ctx, cancel := context.WithCancel(context.Background())
+	events := daq.WatchConfig(ctx, 0)
+	cancel()
+	for range events {
+	}
+}
+
+func TestRestore(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelMId)
+	assert.Nil(t, daq.ConfigureADC(3, 0, 2, 5))
+	assert.Nil(t, daq.SetAnalog(1, 1.0))
+	assert.Nil(t, daq.SetPortState(PortState{0x05, 0x04}))
+	dac := sim.DAC(1)
+
+	daq.SetAutoRestore(true)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := daq.WatchConfig(ctx, 5*time.Millisecond)
+	sim.Reset()
+	err := <-events
+	assert.True(t, errors.Is(err, ErrDeviceReset))
+
+	// Wait for the configuration to be restored
+	for i := 0; i < 100 && sim.Port() != (PortState{0x05, 0x04}); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	for range events {
+	}
+	assert.Nil(t, daq.CheckConfig())
+	assert.Equal(t, dac, sim.DAC(1))
+	assert.Equal(t, PortState{0x05, 0x04}, sim.Port())
+}
+
+func TestRestoreConcurrent(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelMId)
+	assert.Nil(t, daq.ConfigureADC(3, 0, 2, 5))
+	daq.SetAutoRestore(true)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := daq.WatchConfig(ctx, time.Millisecond)
+	go func() {
+		for range events {
+		}
+	}()
+
+	// The application keeps using the device while it's reset and restored
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			daq.ReadAnalog()
+			daq.SetAnalog(1, float32(i%3))
+			daq.SetPIO(1, i%2 == 0)
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		sim.Reset()
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(stop)
+	<-done
+
+	for i := 0; i < 100 && daq.CheckConfig() != nil; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Nil(t, daq.CheckConfig())
+}
@@ -0,0 +1,178 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var errNoStreamData = errors.New("No stream data received")
+
+// Result of the conformance check of a feature
+type ConformanceResult struct {
+	Feature   string
+	Commands  []CommandNumber // Commands used by the feature
+	Supported bool
+	Err       error // Why the feature isn't supported
+}
+
+type conformanceCheck struct {
+	feature  string
+	commands []CommandNumber
+	run      func(daq *OpenDAQ) error
+}
+
+var conformanceChecks = []conformanceCheck{
+	{"Identification", []CommandNumber{ID_CONFIG}, func(daq *OpenDAQ) error {
+		_, _, _, err := daq.GetInfo()
+		return err
+	}},
+	{"Calibration", []CommandNumber{GET_CALIB}, func(daq *OpenDAQ) error {
+		_, err := daq.readCalib(context.Background(), 0)
+		return err
+	}},
+	{"Analog input", []CommandNumber{AIN_CFG, AIN}, func(daq *OpenDAQ) error {
+		if err := daq.ConfigureADC(1, 0, 0, 1); err != nil {
+			return err
+		}
+		_, err := daq.readADC(context.Background())
+		return err
+	}},
+	{"ADC configuration readback", []CommandNumber{GET_AIN_CFG}, func(daq *OpenDAQ) error {
+		_, err := daq.readADCConfig()
+		return err
+	}},
+	{"Analog output", []CommandNumber{SET_DAC}, func(daq *OpenDAQ) error {
+		if daq.NOutputs == 0 {
+			return ErrNotSupported
+		}
+		return daq.SetAnalog(1, 0)
+	}},
+	{"LED", []CommandNumber{LED_W}, func(daq *OpenDAQ) error {
+		if daq.NLeds == 0 {
+			return ErrNotSupported
+		}
+		return daq.SetLED(1, OFF)
+	}},
+	{"PIO", []CommandNumber{PIO_DIR, PIO}, func(daq *OpenDAQ) error {
+		if err := daq.SetPIODir(1, false); err != nil {
+			return err
+		}
+		_, err := daq.readPIO(1)
+		return err
+	}},
+	{"Port", []CommandNumber{PORT_DIR, PORT}, func(daq *OpenDAQ) error {
+		if err := daq.SetPortDir(0); err != nil {
+			return err
+		}
+		_, err := daq.readPort()
+		return err
+	}},
+	{"Counter", []CommandNumber{COUNTER_INIT, GET_COUNTER}, func(daq *OpenDAQ) error {
+		if err := daq.InitCounter(RISING); err != nil {
+			return err
+		}
+		_, err := daq.StopCounter()
+		return err
+	}},
+	{"Capture", []CommandNumber{CAPTURE_INIT, GET_CAPTURE, CAPTURE_STOP}, func(daq *OpenDAQ) error {
+		if err := daq.InitCapture(time.Millisecond); err != nil {
+			return err
+		}
+		if _, err := daq.ReadCapture(CAPTURE_PERIOD); err != nil {
+			return err
+		}
+		return daq.StopCapture()
+	}},
+	{"Stream", []CommandNumber{STREAM_CREATE, CHANNEL_CFG, CHANNEL_SETUP, STREAM_START,
+		STREAM_DATA, STREAM_STOP, CHANNEL_DESTROY}, func(daq *OpenDAQ) error {
+		if err := daq.CreateStream(1, 10*time.Millisecond); err != nil {
+			return err
+		}
+		defer daq.DestroyStream(1)
+		if err := daq.ConfigureChannel(1, ChannelConfig{Mode: ANALOG_INPUT, PosInput: 1, NSamples: 1}); err != nil {
+			return err
+		}
+		packets, err := daq.StartStream()
+		if err != nil {
+			return err
+		}
+		select {
+		case _, ok := <-packets:
+			if !ok {
+				err = errNoStreamData
+			}
+		case <-time.After(time.Second):
+			err = errNoStreamData
+		}
+		if e := daq.stopDraining(packets); err == nil {
+			err = e
+		}
+		return err
+	}},
+	{"External trigger", []CommandNumber{EXTERNAL_CREATE}, func(daq *OpenDAQ) error {
+		if err := daq.CreateExternal(1, RISING); err != nil {
+			return err
+		}
+		return daq.DestroyStream(1)
+	}},
+	{"Burst", []CommandNumber{BURST_CREATE}, func(daq *OpenDAQ) error {
+		_, err := daq.Burst(ChannelConfig{Mode: ANALOG_INPUT, PosInput: 1, NSamples: 1},
+			10, time.Millisecond, nil)
+		return err
+	}},
+}
+
+// Exercise every feature implemented by the library and report which ones
+// are supported by the device. It works with a real device or a Simulator.
+// The analog input 1 is selected, the output 1 is set to 0 V and all the
+// PIOs are set as inputs, so nothing must be driven by them.
+// It fails with ErrStreamsExist if there are stream experiments.
+func (daq *OpenDAQ) CheckConformance() ([]ConformanceResult, error) {
+	if len(daq.streams) != 0 {
+		return nil, ErrStreamsExist
+	}
+	results := make([]ConformanceResult, 0, len(conformanceChecks))
+	for _, c := range conformanceChecks {
+		err := c.run(daq)
+		results = append(results, ConformanceResult{c.feature, c.commands, err == nil, err})
+	}
+	return results, nil
+}
+
+// Write the conformance results as a Markdown table
+func WriteConformanceTable(w io.Writer, results []ConformanceResult) error {
+	fmt.Fprintln(w, "| Feature | Commands | Supported |")
+	fmt.Fprintln(w, "|---------|----------|-----------|")
+	for _, r := range results {
+		names := make([]string, len(r.Commands))
+		for i, c := range r.Commands {
+			names[i] = c.String()
+		}
+		supported := "yes"
+		if !r.Supported {
+			supported = "no (" + r.Err.Error() + ")"
+		}
+		if _, err := fmt.Fprintf(w, "| %s | %s | %s |\n", r.Feature,
+			strings.Join(names, ", "), supported); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package godaq
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckConformance(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelSId)
+	sim.Faults = func(cmd CommandNumber) Fault {
+		if cmd == CAPTURE_INIT {
+			return FAULT_NAK
+		}
+		return NO_FAULT
+	}
+	results, err := daq.CheckConformance()
+	assert.Nil(t, err)
+	assert.Len(t, results, len(conformanceChecks))
+	for _, r := range results {
+		if r.Feature == "Capture" {
+			assert.False(t, r.Supported)
+			assert.True(t, errors.Is(r.Err, ErrNakReceived))
+		} else {
+			assert.True(t, r.Supported, "%s: %v", r.Feature, r.Err)
+		}
+	}
+
+	var b bytes.Buffer
+	assert.Nil(t, WriteConformanceTable(&b, results))
+	assert.Contains(t, b.String(), "| Analog input | AIN_CFG, AIN | yes |\n")
+	assert.Contains(t, b.String(), "| Capture | CAPTURE_INIT, GET_CAPTURE, CAPTURE_STOP | no (CAPTURE_INIT: NAK response received (8 attempts)) |\n")
+	assert.Equal(t, len(results)+2, strings.Count(b.String(), "\n"))
+}
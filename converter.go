@@ -13,7 +13,32 @@
 
 package godaq
 
-import "math"
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrOutOfRange   = errors.New("Value out of range")
+	ErrInvalidRange = errors.New("Invalid range")
+)
+
+// Error returned when a value is outside of the range of a converter.
+// errors.Is(err, ErrOutOfRange) is true for it.
+type RangeError struct {
+	Value, Min, Max float32
+}
+
+func (e *RangeError) Error() string {
+	return fmt.Sprintf("%s: %g not in [%g, %g]", ErrOutOfRange, e.Value, e.Min, e.Max)
+}
+
+func (e *RangeError) Is(target error) bool {
+	return target == ErrOutOfRange
+}
 
 func roundInt(f float32) int {
 	return int(math.Floor(float64(f) + .5))
@@ -46,6 +71,30 @@ func (dac *DAC) clampValue(value int) int {
 	return value
 }
 
+// Check that a voltage can be set by the DAC
+func (dac *DAC) CheckRange(v float32) error {
+	if v < dac.VMin || v > dac.VMax {
+		return &RangeError{v, dac.VMin, dac.VMax}
+	}
+	return nil
+}
+
+// Check that a raw value can be written to the DAC
+func (dac *DAC) CheckValue(value int) error {
+	if lower, upper := dac.bitRange(); value < lower || value > upper {
+		return &RangeError{float32(value), float32(lower), float32(upper)}
+	}
+	return nil
+}
+
+// Convert a percentage of the full scale of the DAC to volts
+func (dac *DAC) PercentToVolts(pct float32) (float32, error) {
+	if pct < 0 || pct > 100 {
+		return 0, &RangeError{pct, 0, 100}
+	}
+	return dac.VMin + pct/100*(dac.VMax-dac.VMin), nil
+}
+
 // Convert a voltage to a DAC value
 func (dac *DAC) FromVolts(v float32, cal Calib) int {
 	min, max := dac.bitRange()
@@ -68,6 +117,23 @@ func (dac *DAC) FromVolts(v float32, cal Calib) int {
 	return dac.clampValue(val)
 }
 
+// Convert a DAC value to the voltage of an ideally calibrated DAC
+func (dac *DAC) toVolts(raw int) float32 {
+	min, max := dac.bitRange()
+	if dac.Signed {
+		v := float32(raw) * dac.VMax / float32(max+1)
+		if dac.Invert {
+			return -v
+		}
+		return v
+	}
+	baseGain := (dac.VMax - dac.VMin) / float32(max-min+1)
+	if dac.Invert {
+		baseGain = -baseGain
+	}
+	return float32(raw)*baseGain + dac.VMin
+}
+
 // Analog-to-digital converter
 type ADC struct {
 	Bits       uint
@@ -98,3 +164,83 @@ func (adc *ADC) ToVolts(raw int, gainId uint, cal1, cal2 Calib) float32 {
 	}
 	return v
 }
+
+// Return the ID of the highest gain whose input range covers [vmin, vmax],
+// or ErrOutOfRange if it can't be measured with any gain.
+func (adc *ADC) SelectGain(vmin, vmax float32) (uint, error) {
+	best, found := uint(0), false
+	for id, g := range adc.Gains {
+		if vmin < adc.VMin/g || vmax > adc.VMax/g {
+			continue
+		}
+		if !found || g > adc.Gains[best] {
+			best, found = uint(id), true
+		}
+	}
+	if !found {
+		return 0, ErrOutOfRange
+	}
+	return best, nil
+}
+
+// Units accepted by ParseRange. "V" must be the last one.
+var voltUnits = []struct {
+	name  string
+	scale float32
+}{{"mV", 1e-3}, {"uV", 1e-6}, {"µV", 1e-6}, {"V", 1}}
+
+// Parse a signal range such as "0-50 mV", "-10..10 V" or "0–5V" (en dash)
+// and return its limits in volts.
+func ParseRange(s string) (vmin, vmax float32, err error) {
+	s = strings.TrimSpace(s)
+	scale := float32(1)
+	for _, unit := range voltUnits {
+		if strings.HasSuffix(s, unit.name) {
+			s, scale = strings.TrimSpace(strings.TrimSuffix(s, unit.name)), unit.scale
+			break
+		}
+	}
+	if s == "" {
+		return 0, 0, ErrInvalidRange
+	}
+
+	var limits []string
+	if strings.Contains(s, "..") {
+		limits = strings.SplitN(s, "..", 2)
+	} else if strings.Contains(s, "–") {
+		limits = strings.SplitN(s, "–", 2)
+	} else if i := strings.Index(s[1:], "-"); i >= 0 {
+		// Skip the sign of the first limit
+		limits = []string{s[:i+1], s[i+2:]}
+	}
+	if len(limits) != 2 {
+		return 0, 0, ErrInvalidRange
+	}
+	min, err1 := strconv.ParseFloat(strings.TrimSpace(limits[0]), 32)
+	max, err2 := strconv.ParseFloat(strings.TrimSpace(limits[1]), 32)
+	if err1 != nil || err2 != nil || min > max {
+		return 0, 0, ErrInvalidRange
+	}
+	return float32(min) * scale, float32(max) * scale, nil
+}
+
+// Convert a voltage to the value read by an ideally calibrated ADC
+func (adc *ADC) fromVolts(v float32, gainId uint) int {
+	if adc.Invert {
+		v = -v
+	}
+	max := 1 << adc.Bits
+	raw := roundInt(v * float32(max) / (adc.VMax - adc.VMin) * adc.Gains[gainId])
+	lower, upper := 0, max-1
+	if adc.Signed {
+		lower, upper = -max/2, max/2-1
+	} else {
+		raw += max / 2
+	}
+	if raw < lower {
+		return lower
+	} else if raw > upper {
+		return upper
+	}
+	return raw
+}
@@ -1,6 +1,7 @@
 package godaq
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -30,6 +31,39 @@ func TestClampValue(t *testing.T) {
 	assert.Equal(t, 200, dac.clampValue(200))
 }
 
+func TestCheckRange(t *testing.T) {
+	dac := DAC{Bits: 16, Signed: true, VMin: 0.0, VMax: 4.096}
+	assert.Nil(t, dac.CheckRange(0))
+	assert.Nil(t, dac.CheckRange(4.096))
+
+	err := dac.CheckRange(9)
+	assert.True(t, errors.Is(err, ErrOutOfRange))
+	assert.Equal(t, &RangeError{9, 0, 4.096}, err)
+	assert.Equal(t, "Value out of range: 9 not in [0, 4.096]", err.Error())
+	assert.NotNil(t, dac.CheckRange(-0.5))
+}
+
+func TestCheckValue(t *testing.T) {
+	dac := DAC{Bits: 16, Signed: true}
+	assert.Nil(t, dac.CheckValue(-32768))
+	assert.Nil(t, dac.CheckValue(32767))
+	assert.Equal(t, &RangeError{40000, -32768, 32767}, dac.CheckValue(40000))
+}
+
+func TestPercentToVolts(t *testing.T) {
+	dac := DAC{Bits: 16, Signed: true, VMin: -4.096, VMax: 4.096}
+	v, err := dac.PercentToVolts(0)
+	assert.Nil(t, err)
+	assert.InDelta(t, -4.096, v, 1e-6)
+	v, _ = dac.PercentToVolts(50)
+	assert.InDelta(t, 0, v, 1e-6)
+	v, _ = dac.PercentToVolts(100)
+	assert.InDelta(t, 4.096, v, 1e-6)
+
+	_, err = dac.PercentToVolts(101)
+	assert.True(t, errors.Is(err, ErrOutOfRange))
+}
+
 func TestFromVoltsSigned(t *testing.T) {
 	dac := DAC{Bits: 12, Signed: true, VMin: -4.096, VMax: 4.096}
 	assert.Equal(t, -2048, dac.FromVolts(-10, Calib{1, 0}))
@@ -60,6 +94,18 @@ func TestFromVoltsUnsigned(t *testing.T) {
 	assert.Equal(t, 4095, dac.FromVolts(10.0, Calib{1, 0}))
 }
 
+func TestDACToVolts(t *testing.T) {
+	for _, dac := range []DAC{
+		{Bits: 16, Signed: true, VMin: -4.096, VMax: 4.096},
+		{Bits: 12, VMin: 0, VMax: 4.096},
+		{Bits: 16, Signed: true, VMin: -4.096, VMax: 4.096, Invert: true},
+	} {
+		for _, v := range []float32{0, 1.5, 4} {
+			assert.InDelta(t, v, dac.toVolts(dac.FromVolts(v, Calib{1, 0})), 0.002, "%+v", dac)
+		}
+	}
+}
+
 func TestToVoltsSigned(t *testing.T) {
 	gains := []float32{1, 2, 4, 8}
 	adc := ADC{Bits: 12, Signed: true, VMin: -4.096, VMax: 4.096, Gains: gains}
@@ -89,3 +135,41 @@ func TestToVoltsUnSigned(t *testing.T) {
 	assert.Equal(t, float32(0.0), adc.ToVolts(2048, 2, Calib{1, 0}, Calib{1, 0}))
 	assert.Equal(t, float32(1.024), adc.ToVolts(4096, 2, Calib{1, 0}, Calib{1, 0}))
 }
+
+func TestSelectGain(t *testing.T) {
+	adc := NewModelN().Adc
+	id, err := adc.SelectGain(0, 0.05)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 7, id) // x32: ±0.384 V
+
+	id, err = adc.SelectGain(-5, 5)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, id) // x2: ±6.144 V
+
+	_, err = adc.SelectGain(-20, 5)
+	assert.Equal(t, ErrOutOfRange, err)
+}
+
+func TestParseRange(t *testing.T) {
+	cases := []struct {
+		s          string
+		vmin, vmax float32
+	}{
+		{"0-50 mV", 0, 0.05},
+		{"0–50mV", 0, 0.05},
+		{"-10..10 V", -10, 10},
+		{"-5--1V", -5, -1},
+		{"0-5", 0, 5},
+	}
+	for _, c := range cases {
+		vmin, vmax, err := ParseRange(c.s)
+		assert.Nil(t, err, c.s)
+		assert.InDelta(t, c.vmin, vmin, 1e-9, c.s)
+		assert.InDelta(t, c.vmax, vmax, 1e-9, c.s)
+	}
+
+	for _, s := range []string{"", "mV", "5 V", "5-1 V", "a-b"} {
+		_, _, err := ParseRange(s)
+		assert.Equal(t, ErrInvalidRange, err, s)
+	}
+}
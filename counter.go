@@ -0,0 +1,129 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+var ErrCounterNotRunning = errors.New("Counter not running")
+
+// Start counting the edges of the counter input (see HwFeatures.CounterPIO)
+func (daq *OpenDAQ) InitCounter(edge Edge) error {
+	if daq.CounterPIO == 0 {
+		return ErrNotSupported
+	}
+	daq.cfgMu.Lock()
+	defer daq.cfgMu.Unlock()
+	_, err := daq.sendCommand(&Message{COUNTER_INIT, []byte{byte(edge)}}, COUNTER_INIT.RespLen())
+	if err == nil {
+		// The counter and the capture share the same timer
+		daq.counterRunning, daq.captureRunning = true, false
+	}
+	return err
+}
+
+// Read the number of edges counted, optionally resetting the counter
+func (daq *OpenDAQ) ReadCounter(reset bool) (uint16, error) {
+	daq.cfgMu.RLock()
+	defer daq.cfgMu.RUnlock()
+	return daq.readCounter(reset)
+}
+
+func (daq *OpenDAQ) readCounter(reset bool) (uint16, error) {
+	if !daq.counterRunning {
+		return 0, ErrCounterNotRunning
+	}
+	buf, err := daq.sendCommand(&Message{GET_COUNTER, []byte{boolToByte(reset)}}, GET_COUNTER.RespLen())
+	if err != nil {
+		return 0, err
+	}
+	var count uint16
+	binary.Read(buf, binary.BigEndian, &count)
+	return count, nil
+}
+
+// Read the final count and stop using the counter.
+// The firmware has no command to stop the counter peripheral, so it's only
+// reset, and ReadCounter fails until InitCounter is called again.
+func (daq *OpenDAQ) StopCounter() (uint16, error) {
+	daq.cfgMu.Lock()
+	defer daq.cfgMu.Unlock()
+	count, err := daq.readCounter(true)
+	if err != nil {
+		return 0, err
+	}
+	daq.counterRunning = false
+	return count, nil
+}
+
+// First interval between readings of the counter in MeasureRate, adjusted
+// afterwards to keep the count far from overflowing
+const firstCounterRead = 100 * time.Millisecond
+
+// Measure the rate of the edges at the counter input, in Hz, counting them
+// during the gate time. The counter must be running (see InitCounter).
+// The counter is read several times during long gates, so it doesn't
+// overflow, and the interval is measured from the times of the commands.
+func (daq *OpenDAQ) MeasureRate(ctx context.Context, gate time.Duration) (float64, error) {
+	if _, err := daq.ReadCounter(true); err != nil {
+		return 0, err
+	}
+	start := daq.LastTiming().Mid()
+	last, wait := start, firstCounterRead
+	var total uint64
+	for {
+		elapsed := last.Sub(start)
+		if elapsed >= gate {
+			return float64(total) / elapsed.Seconds(), nil
+		}
+		if d := gate - elapsed; d < wait {
+			wait = d
+		}
+		if err := sleepContext(ctx, wait); err != nil {
+			return 0, err
+		}
+		count, err := daq.ReadCounter(true)
+		if err != nil {
+			return 0, err
+		}
+		now := daq.LastTiming().Mid()
+		total += uint64(count)
+		// Expect at most half of the range of the counter
+		if count > 0 {
+			if max := time.Duration(float64(now.Sub(last)) * (1 << 15) / float64(count)); max < wait {
+				wait = max
+			}
+		}
+		last = now
+	}
+}
+
+// Measure the rate of the edges at the counter input with the given
+// resolution in Hz, e.g. 0.1 Hz counts during 10 s. The gate time is limited
+// to maxGate (unlimited if 0), and returned with the rate.
+func (daq *OpenDAQ) MeasureRateResolution(ctx context.Context, resolution float64, maxGate time.Duration) (float64, time.Duration, error) {
+	if resolution <= 0 {
+		return 0, 0, ErrOutOfRange
+	}
+	gate := time.Duration(float64(time.Second) / resolution)
+	if maxGate > 0 && gate > maxGate {
+		gate = maxGate
+	}
+	rate, err := daq.MeasureRate(ctx, gate)
+	return rate, gate, err
+}
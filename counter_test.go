@@ -0,0 +1,31 @@
+package godaq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMeasureRate(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelMId)
+	_, err := daq.MeasureRate(context.Background(), time.Second)
+	assert.Equal(t, ErrCounterNotRunning, err)
+
+	assert.Nil(t, daq.InitCounter(0))
+	sim.TimerInput.Frequency = 1000
+	rate, err := daq.MeasureRate(context.Background(), 250*time.Millisecond)
+	assert.Nil(t, err)
+	assert.InDelta(t, 1000, rate, 20)
+
+	// The count of the whole gate exceeds the range of the counter
+	sim.TimerInput.Frequency = 200000
+	rate, gate, err := daq.MeasureRateResolution(context.Background(), 2, time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, 500*time.Millisecond, gate)
+	assert.InDelta(t, 200000, rate, 2000)
+
+	_, gate, _ = daq.MeasureRateResolution(context.Background(), 1, 100*time.Millisecond)
+	assert.Equal(t, 100*time.Millisecond, gate)
+}
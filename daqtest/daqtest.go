@@ -0,0 +1,141 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package daqtest provides helpers to test applications using godaq:
+// recording the frames sent to a device and comparing them with the
+// expected ones, or with golden files.
+//
+// Set GODAQ_UPDATE_GOLDEN=1 to write the golden files from the frames
+// recorded, instead of comparing them.
+package daqtest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/opendaq/godaq"
+)
+
+// Frame of a command, as sent to the device
+func Frame(number godaq.CommandNumber, body ...byte) []byte {
+	b, err := (&godaq.Message{Number: number, Body: body}).Marshal()
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Transport recording the frames written to another one (e.g. a
+// godaq.Simulator). Use it with godaq.NewFromTransport.
+type Recorder struct {
+	rw     io.ReadWriteCloser
+	frames [][]byte
+	sync.Mutex
+}
+
+func NewRecorder(rw io.ReadWriteCloser) *Recorder {
+	return &Recorder{rw: rw}
+}
+
+func (r *Recorder) Write(p []byte) (int, error) {
+	r.Lock()
+	r.frames = append(r.frames, append([]byte(nil), p...))
+	r.Unlock()
+	return r.rw.Write(p)
+}
+
+func (r *Recorder) Read(p []byte) (int, error) {
+	return r.rw.Read(p)
+}
+
+func (r *Recorder) Close() error {
+	return r.rw.Close()
+}
+
+// Discard the data pending in the underlying transport, if it's supported
+func (r *Recorder) Flush() error {
+	if f, ok := r.rw.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Return the frames written since the last Reset
+func (r *Recorder) Frames() [][]byte {
+	r.Lock()
+	defer r.Unlock()
+	return append([][]byte(nil), r.frames...)
+}
+
+// Forget the frames recorded, e.g. the ones sent when opening the device
+func (r *Recorder) Reset() {
+	r.Lock()
+	r.frames = nil
+	r.Unlock()
+}
+
+// Format frames as text, one per line with the name of the command
+func Format(frames [][]byte) string {
+	var b strings.Builder
+	for _, f := range frames {
+		name := "?"
+		if len(f) > 2 {
+			name = godaq.CommandNumber(f[2]).String()
+		}
+		fmt.Fprintf(&b, "%-16s % x\n", name, f)
+	}
+	return b.String()
+}
+
+// Check that the frames sent are the expected ones
+func AssertFrames(t testing.TB, got, want [][]byte) bool {
+	t.Helper()
+	if len(got) == len(want) {
+		equal := true
+		for i := range got {
+			equal = equal && bytes.Equal(got[i], want[i])
+		}
+		if equal {
+			return true
+		}
+	}
+	t.Errorf("frames differ\ngot:\n%swant:\n%s", Format(got), Format(want))
+	return false
+}
+
+// Compare the frames sent with the golden file at path
+func AssertGolden(t testing.TB, path string, got [][]byte) bool {
+	t.Helper()
+	text := Format(got)
+	if os.Getenv("GODAQ_UPDATE_GOLDEN") != "" {
+		if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return true
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != string(want) {
+		t.Errorf("frames differ from %s\ngot:\n%swant:\n%s", path, text, want)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package daqtest
+
+import (
+	"testing"
+
+	"github.com/opendaq/godaq"
+)
+
+// Test recording the failures instead of failing
+type fakeTB struct {
+	testing.TB
+	failed bool
+}
+
+func (t *fakeTB) Errorf(format string, args ...interface{}) {
+	t.failed = true
+}
+
+func openSimulator(t *testing.T) (*godaq.OpenDAQ, *Recorder) {
+	sim, err := godaq.NewSimulator(godaq.ModelMId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := NewRecorder(sim)
+	daq, err := godaq.NewFromTransport(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.Reset()
+	return daq, rec
+}
+
+func TestAssertFrames(t *testing.T) {
+	daq, rec := openSimulator(t)
+	if err := daq.ConfigureADC(1, 0, 1, 20); err != nil {
+		t.Fatal(err)
+	}
+	AssertFrames(t, rec.Frames(), [][]byte{
+		Frame(godaq.AIN_CFG, 1, 0, 1, 20),
+	})
+
+	ft := &fakeTB{TB: t}
+	if AssertFrames(ft, rec.Frames(), [][]byte{Frame(godaq.AIN)}) || !ft.failed {
+		t.Error("different frames accepted")
+	}
+}
+
+func TestAssertGolden(t *testing.T) {
+	daq, rec := openSimulator(t)
+	if err := daq.ConfigureADC(2, 0, 0, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := daq.SetLED(1, godaq.GREEN); err != nil {
+		t.Fatal(err)
+	}
+	AssertGolden(t, "testdata/configure.golden", rec.Frames())
+}
@@ -0,0 +1,65 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import "time"
+
+// Software debounce of a PIO input: a value is only accepted after
+// Count consecutive equal readings, which must be obtained within Timeout
+// (no limit if it's 0).
+type Debounce struct {
+	Count   int
+	Timeout time.Duration
+}
+
+// Read until the bits in mask are equal in d.Count consecutive readings
+func (d Debounce) read(readFn func() (uint8, error), mask uint8) (uint8, error) {
+	deadline := time.Now().Add(d.Timeout)
+	val, err := readFn()
+	if err != nil {
+		return 0, err
+	}
+	for count := 1; count < d.Count; {
+		if d.Timeout > 0 && time.Now().After(deadline) {
+			return val, ErrPIOUnstable
+		}
+		v, err := readFn()
+		if err != nil {
+			return 0, err
+		}
+		if v&mask == val&mask {
+			count++
+		} else {
+			count = 1
+		}
+		val = v
+	}
+	return val, nil
+}
+
+// Debounce the readings of PIO n (used by ReadPIO and ReadPort).
+// A Count lower than 2 disables the debounce.
+func (daq *OpenDAQ) SetPIODebounce(n uint, d Debounce) error {
+	if n < 1 || n > daq.NPIOs {
+		return ErrInvalidPIO
+	}
+	daq.cfgMu.Lock()
+	defer daq.cfgMu.Unlock()
+	if d.Count < 2 {
+		delete(daq.debounce, n)
+		return nil
+	}
+	daq.debounce[n] = d
+	return nil
+}
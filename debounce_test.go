@@ -0,0 +1,45 @@
+package godaq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Return a read function producing the given values
+func readSequence(values ...uint8) func() (uint8, error) {
+	return func() (uint8, error) {
+		v := values[0]
+		if len(values) > 1 {
+			values = values[1:]
+		}
+		return v, nil
+	}
+}
+
+func TestDebounce(t *testing.T) {
+	d := Debounce{Count: 3, Timeout: time.Second}
+	val, err := d.read(readSequence(1, 0, 1, 0, 0, 0), 0xff)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, val)
+
+	// Only the masked bits need to be stable
+	val, err = d.read(readSequence(0x11, 0x21, 0x41), 0x0f)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0x41, val)
+
+	// No deadline
+	d.Timeout = 0
+	val, err = d.read(readSequence(1, 0, 1, 0, 0, 0), 0xff)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, val)
+
+	d.Timeout = time.Millisecond
+	seq := readSequence(1, 0, 1, 0, 0, 0)
+	_, err = d.read(func() (uint8, error) {
+		time.Sleep(time.Millisecond)
+		return seq()
+	}, 0xff)
+	assert.Equal(t, ErrPIOUnstable, err)
+}
@@ -0,0 +1,158 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"math"
+)
+
+// Result of probing an input for an open (unconnected) channel
+type InputProbe struct {
+	Input    uint
+	Value    float32 // Last value read from the input
+	Drift    float32 // Change between the first and the last readings
+	Floating bool    // The input looks unconnected
+}
+
+// Result of measuring a differential pair of inputs
+type PairProbe struct {
+	Pos, Neg  uint
+	Value     float32 // Mean of the readings (V)
+	Noise     float32 // Standard deviation of the readings (V)
+	Saturated bool    // Some reading is at the limit of the ADC range
+	Plausible bool    // The pair carries a signal: not saturated, above the minimum level and stable
+}
+
+// Read a value in volts with ReadADC, bypassing filters and tare
+func (daq *OpenDAQ) readVolts() (float32, error) {
+	val, err := daq.ReadADC()
+	if err != nil {
+		return 0, err
+	}
+	return daq.adcToVolts(int(val))
+}
+
+// Heuristically detect floating inputs.
+// Each input is read nReads times right after reading a different input.
+// A floating input keeps the charge left by the previous channel, so its first
+// readings are close to the value of that channel and then drift away by more
+// than maxDrift volts. A driven input is stable from the first reading.
+// The settling (see SetSettling) is suspended meanwhile, so the first readings
+// aren't discarded. The ADC configuration is restored afterwards.
+func (daq *OpenDAQ) ProbeInputs(nReads int, maxDrift float32) ([]InputProbe, error) {
+	if nReads < 2 {
+		nReads = 2
+	}
+	defer daq.restoreADC()()
+	daq.cfgMu.RLock()
+	settling := daq.settling
+	daq.cfgMu.RUnlock()
+	daq.SetSettling(Settling{})
+	defer daq.SetSettling(settling)
+
+	probes := make([]InputProbe, 0, daq.NInputs)
+	for n := uint(1); n <= daq.NInputs; n++ {
+		// Charge the ADC input with the value of another channel
+		if err := daq.ConfigureADC(n%daq.NInputs+1, 0, 0, 1); err != nil {
+			return nil, err
+		}
+		prev, err := daq.readVolts()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := daq.ConfigureADC(n, 0, 0, 1); err != nil {
+			return nil, err
+		}
+		var first, last float32
+		for i := 0; i < nReads; i++ {
+			if last, err = daq.readVolts(); err != nil {
+				return nil, err
+			}
+			if i == 0 {
+				first = last
+			}
+		}
+		drift := last - first
+		floating := math.Abs(float64(drift)) > float64(maxDrift) &&
+			math.Abs(float64(first-prev)) < math.Abs(float64(last-prev))
+		probes = append(probes, InputProbe{n, last, drift, floating})
+	}
+	return probes, nil
+}
+
+// Return a function restoring the current ADC configuration, if any
+func (daq *OpenDAQ) restoreADC() func() {
+	pos, neg, gainId, nSamples := daq.posInput, daq.negInput, daq.gainId, daq.nSamples
+	configured := daq.adcConfigured
+	return func() {
+		if configured {
+			daq.ConfigureADC(pos, neg, gainId, nSamples)
+		}
+	}
+}
+
+// Measure every legal differential pair of inputs of the model (each pair
+// only once, in the orientation with the lowest positive input when both are
+// legal) with the widest range, reading it nReads times. A pair is plausible
+// if it isn't saturated, its absolute value is at least minLevel volts and
+// the noise is below 10% of the value. It helps to check the wiring of the
+// differential signals. The ADC configuration is restored afterwards.
+func (daq *OpenDAQ) DiscoverPairs(nReads int, minLevel float32) ([]PairProbe, error) {
+	if nReads < 2 {
+		nReads = 2
+	}
+	defer daq.restoreADC()()
+	lower, upper := -1<<(daq.Adc.Bits-1), 1<<(daq.Adc.Bits-1)-1
+	if !daq.Adc.Signed {
+		lower, upper = 0, 1<<daq.Adc.Bits-1
+	}
+
+	var probes []PairProbe
+	for p := uint(1); p <= daq.NInputs; p++ {
+		for n := uint(1); n <= daq.NInputs; n++ {
+			if n == p || daq.hw.CheckValidInputs(p, n) != nil ||
+				n < p && daq.hw.CheckValidInputs(n, p) == nil {
+				continue
+			}
+			if err := daq.ConfigureADC(p, n, 0, 1); err != nil {
+				return nil, err
+			}
+			probe := PairProbe{Pos: p, Neg: n}
+			var sum, sumSq float64
+			for i := 0; i < nReads; i++ {
+				raw, err := daq.ReadADC()
+				if err != nil {
+					return nil, err
+				}
+				if int(raw) <= lower || int(raw) >= upper {
+					probe.Saturated = true
+				}
+				v, err := daq.adcToVolts(int(raw))
+				if err != nil {
+					return nil, err
+				}
+				sum += float64(v)
+				sumSq += float64(v) * float64(v)
+			}
+			mean := sum / float64(nReads)
+			probe.Value = float32(mean)
+			probe.Noise = float32(math.Sqrt(math.Max(sumSq/float64(nReads)-mean*mean, 0)))
+			probe.Plausible = !probe.Saturated && math.Abs(mean) >= float64(minLevel) &&
+				probe.Noise < float32(math.Abs(mean))/10
+			probes = append(probes, probe)
+		}
+	}
+	return probes, nil
+}
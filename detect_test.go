@@ -0,0 +1,83 @@
+package godaq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscoverPairs(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelSId)
+	sim.Inputs = map[uint]Waveform{
+		3: Constant(1.0),
+		4: Constant(0.2),
+		// Noisy input
+		6: Sine(0.5, 50, 0.3),
+		// Out of range
+		7: Constant(20),
+	}
+	assert.Nil(t, daq.ConfigureADC(2, 0, 1, 5))
+
+	probes, err := daq.DiscoverPairs(20, 0.1)
+	assert.Nil(t, err)
+	// Each pair of the 8 inputs once
+	assert.Len(t, probes, 8*7/2)
+	pairs := make(map[[2]uint]PairProbe)
+	for _, p := range probes {
+		assert.True(t, p.Pos < p.Neg)
+		pairs[[2]uint{p.Pos, p.Neg}] = p
+	}
+	p := pairs[[2]uint{3, 4}]
+	assert.InDelta(t, 0.8, p.Value, 0.01)
+	assert.True(t, p.Plausible)
+	assert.False(t, pairs[[2]uint{1, 2}].Plausible)
+	assert.False(t, pairs[[2]uint{1, 6}].Plausible)
+	assert.True(t, pairs[[2]uint{1, 7}].Saturated)
+	assert.False(t, pairs[[2]uint{1, 7}].Plausible)
+
+	// The configuration is restored
+	assert.Equal(t, []uint{2, 0, 1}, []uint{daq.posInput, daq.negInput, daq.gainId})
+}
+
+func TestProbeInputs(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelMId, WithRetries(1))
+	// Input 3 drifts from the level of the previous channel at each reading
+	var charge float32
+	sim.Inputs = map[uint]Waveform{
+		1: Constant(1),
+		3: func(time.Duration) float32 { charge += 0.1; return charge },
+		4: Constant(0),
+	}
+	settling := Settling{Discard: 2}
+	daq.SetSettling(settling)
+	assert.Nil(t, daq.ConfigureADC(2, 0, 1, 5))
+
+	probes, err := daq.ProbeInputs(5, 0.2)
+	assert.Nil(t, err)
+	assert.Len(t, probes, int(daq.NInputs))
+	for _, p := range probes {
+		assert.Equal(t, p.Input == 3, p.Floating, "input %d", p.Input)
+	}
+	assert.InDelta(t, 1, probes[0].Value, 0.01)
+	assert.InDelta(t, 0.4, probes[2].Drift, 0.01)
+
+	// The configuration and the settling are restored
+	assert.Equal(t, []uint{2, 0, 1}, []uint{daq.posInput, daq.negInput, daq.gainId})
+	assert.Equal(t, ADCConfig{2, 0, 1, 5}, sim.adc)
+	assert.Equal(t, settling, daq.settling)
+
+	// Also on errors
+	sim.Faults = func(cmd CommandNumber) Fault {
+		if cmd == AIN {
+			return FAULT_NAK
+		}
+		return NO_FAULT
+	}
+	_, err = daq.ProbeInputs(5, 0.2)
+	assert.NotNil(t, err)
+	_, err = daq.DiscoverPairs(5, 0.1)
+	assert.NotNil(t, err)
+	assert.Equal(t, ADCConfig{2, 0, 1, 5}, sim.adc)
+	assert.Equal(t, settling, daq.settling)
+}
@@ -0,0 +1,217 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ErrDeviceNotFound = errors.New("Device not found")
+
+// USB vendor and product IDs of a device
+type USBID struct {
+	VID, PID uint16
+}
+
+// USB IDs of the USB-serial converter of the openDAQs (FTDI FT232R)
+var OpenDAQUSBIDs = []USBID{{0x0403, 0x6001}}
+
+// Directory of the tty devices in sysfs
+var sysfsTTY = "/sys/class/tty"
+
+// Configuration of Discover
+type DiscoverOptions struct {
+	USBIDs   []USBID  // USB IDs of the candidate ports (OpenDAQUSBIDs if nil)
+	AllPorts bool     // Consider every USB-serial port, whatever its USB IDs
+	Probe    bool     // Open each candidate port and identify the device
+	Options  []Option // Options used to open the ports when probing
+}
+
+// USB-serial port that may have an openDAQ attached
+type DiscoveredDevice struct {
+	Port  string
+	USBID            // Zero if unknown
+	Info  DeviceInfo // Identification of the device, if it was probed successfully
+	Err   error      // Why the device couldn't be identified, if it was probed
+}
+
+// Find the USB-serial ports with an openDAQ attached (Linux only), like
+// ListDevicePorts, but without opening the ports of other USB devices.
+// The ports are identified only if opts.Probe is set; then they are opened
+// in parallel.
+func Discover(opts DiscoverOptions) ([]DiscoveredDevice, error) {
+	return DiscoverContext(context.Background(), opts)
+}
+
+// Find the USB-serial ports with an openDAQ attached, like Discover.
+// The probing is aborted when ctx is done.
+func DiscoverContext(ctx context.Context, opts DiscoverOptions) ([]DiscoveredDevice, error) {
+	ports, err := ListPorts()
+	if err != nil {
+		return nil, err
+	}
+	return discover(ctx, ports, opts, func(ctx context.Context, port string) (*OpenDAQ, error) {
+		return NewContext(ctx, port, opts.Options...)
+	}), nil
+}
+
+func discover(ctx context.Context, ports []string, opts DiscoverOptions,
+	open func(ctx context.Context, port string) (*OpenDAQ, error)) []DiscoveredDevice {
+	devs := candidatePorts(ports, opts)
+	if opts.Probe {
+		for _, daq := range probePorts(ctx, devs, open) {
+			if daq != nil {
+				daq.Close()
+			}
+		}
+	}
+	return devs
+}
+
+// Select the ports with the USB IDs of opts
+func candidatePorts(ports []string, opts DiscoverOptions) []DiscoveredDevice {
+	ids := opts.USBIDs
+	if ids == nil {
+		ids = OpenDAQUSBIDs
+	}
+	var devs []DiscoveredDevice
+	for _, port := range ports {
+		id, ok := portUSBID(port)
+		if !opts.AllPorts && (!ok || !containsUSBID(ids, id)) {
+			continue
+		}
+		devs = append(devs, DiscoveredDevice{Port: port, USBID: id})
+	}
+	return devs
+}
+
+// Open the ports in parallel and identify their devices. The devices are
+// returned open, nil for the ports that failed.
+func probePorts(ctx context.Context, devs []DiscoveredDevice,
+	open func(ctx context.Context, port string) (*OpenDAQ, error)) []*OpenDAQ {
+	daqs := make([]*OpenDAQ, len(devs))
+	var wg sync.WaitGroup
+	for i := range devs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			daq, err := open(ctx, devs[i].Port)
+			if err != nil {
+				devs[i].Err = err
+				return
+			}
+			devs[i].Info = daq.GetDeviceInfo()
+			daqs[i] = daq
+		}(i)
+	}
+	wg.Wait()
+	return daqs
+}
+
+// Open the device whose identification satisfies match, probing the ports
+// found as Discover does (opts.Probe is ignored). If several devices match,
+// the one at the first port in alphabetical order is opened, so the choice
+// is deterministic. ErrDeviceNotFound is returned if none matches.
+func OpenMatching(ctx context.Context, opts DiscoverOptions, match func(DeviceInfo) bool) (*OpenDAQ, error) {
+	ports, err := ListPorts()
+	if err != nil {
+		return nil, err
+	}
+	return openMatching(ctx, ports, opts, match, func(ctx context.Context, port string) (*OpenDAQ, error) {
+		return NewContext(ctx, port, opts.Options...)
+	})
+}
+
+func openMatching(ctx context.Context, ports []string, opts DiscoverOptions, match func(DeviceInfo) bool,
+	open func(ctx context.Context, port string) (*OpenDAQ, error)) (*OpenDAQ, error) {
+	sort.Strings(ports)
+	devs := candidatePorts(ports, opts)
+	var found *OpenDAQ
+	for i, daq := range probePorts(ctx, devs, open) {
+		if daq == nil {
+			continue
+		}
+		if found == nil && match(devs[i].Info) {
+			found = daq
+		} else {
+			daq.Close()
+		}
+	}
+	if found == nil {
+		return nil, ErrDeviceNotFound
+	}
+	return found, nil
+}
+
+// Open the device with the given serial number, whatever its port.
+// The serial number can be given with or without the leading zeros.
+func OpenBySerial(serial string, opts ...Option) (*OpenDAQ, error) {
+	n, err := strconv.ParseUint(serial, 10, 32)
+	return OpenMatching(context.Background(), DiscoverOptions{Options: opts}, func(info DeviceInfo) bool {
+		return info.Serial == serial || err == nil && info.SerialNumber == uint32(n)
+	})
+}
+
+// Open a device of the given model (e.g. ModelMId), whatever its port
+func OpenByModel(model uint8, opts ...Option) (*OpenDAQ, error) {
+	return OpenMatching(context.Background(), DiscoverOptions{Options: opts}, func(info DeviceInfo) bool {
+		return info.Model == model
+	})
+}
+
+func containsUSBID(ids []USBID, id USBID) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Look up the USB IDs of the device of a tty port in sysfs
+func portUSBID(port string) (USBID, bool) {
+	dir, err := filepath.EvalSymlinks(filepath.Join(sysfsTTY, filepath.Base(port), "device"))
+	if err != nil {
+		return USBID{}, false
+	}
+	// The IDs are in the USB device, a parent of the tty and its interface
+	for {
+		vid, err1 := readUSBID(filepath.Join(dir, "idVendor"))
+		pid, err2 := readUSBID(filepath.Join(dir, "idProduct"))
+		if err1 == nil && err2 == nil {
+			return USBID{vid, pid}, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return USBID{}, false
+		}
+		dir = parent
+	}
+}
+
+func readUSBID(path string) (uint16, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseUint(strings.TrimSpace(string(b)), 16, 16)
+	return uint16(id), err
+}
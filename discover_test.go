@@ -0,0 +1,136 @@
+package godaq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Create a sysfs tree with a tty of a USB device
+func addSysfsTTY(t *testing.T, root, tty string, id USBID) {
+	usb := filepath.Join(root, "devices", tty+"-usb")
+	dev := filepath.Join(usb, "1-1:1.0", tty)
+	assert.Nil(t, os.MkdirAll(dev, 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(usb, "idVendor"), []byte(fmt.Sprintf("%04x\n", id.VID)), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(usb, "idProduct"), []byte(fmt.Sprintf("%04x\n", id.PID)), 0644))
+	class := filepath.Join(root, "class", "tty", tty)
+	assert.Nil(t, os.MkdirAll(class, 0755))
+	assert.Nil(t, os.Symlink(dev, filepath.Join(class, "device")))
+}
+
+func TestDiscover(t *testing.T) {
+	root, err := ioutil.TempDir("", "sysfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	addSysfsTTY(t, root, "ttyUSB0", USBID{0x0403, 0x6001})
+	addSysfsTTY(t, root, "ttyUSB1", USBID{0x067b, 0x2303})
+	addSysfsTTY(t, root, "ttyUSB2", USBID{0x0403, 0x6001})
+	defer func(dir string) { sysfsTTY = dir }(sysfsTTY)
+	sysfsTTY = filepath.Join(root, "class", "tty")
+
+	ports := []string{"/dev/ttyUSB0", "/dev/ttyUSB1", "/dev/ttyUSB2", "/dev/ttyACM0"}
+	var opened []string
+	open := func(ctx context.Context, port string) (*OpenDAQ, error) {
+		if port != "/dev/ttyUSB0" {
+			return nil, errors.New("no response")
+		}
+		sim, _ := NewSimulator(ModelNId)
+		sim.Serial = 42
+		return NewFromTransportContext(ctx, sim)
+	}
+	probe := func(ctx context.Context, port string) (*OpenDAQ, error) {
+		opened = append(opened, port)
+		return nil, errors.New("not probed")
+	}
+
+	// Only the ports of the openDAQ USB-serial converter, without opening them
+	devs := discover(context.Background(), ports, DiscoverOptions{}, probe)
+	assert.Empty(t, opened)
+	assert.Equal(t, []DiscoveredDevice{
+		{Port: "/dev/ttyUSB0", USBID: USBID{0x0403, 0x6001}},
+		{Port: "/dev/ttyUSB2", USBID: USBID{0x0403, 0x6001}},
+	}, devs)
+
+	devs = discover(context.Background(), ports, DiscoverOptions{
+		USBIDs: []USBID{{0x067b, 0x2303}}}, probe)
+	assert.Len(t, devs, 1)
+	assert.Equal(t, "/dev/ttyUSB1", devs[0].Port)
+
+	devs = discover(context.Background(), ports, DiscoverOptions{AllPorts: true}, probe)
+	assert.Len(t, devs, 4)
+	assert.Equal(t, USBID{}, devs[3].USBID)
+
+	devs = discover(context.Background(), ports, DiscoverOptions{Probe: true}, open)
+	assert.Len(t, devs, 2)
+	assert.Nil(t, devs[0].Err)
+	assert.Equal(t, "OpenDAQ N", devs[0].Info.ModelName)
+	assert.Equal(t, "0042", devs[0].Info.Serial)
+	assert.NotNil(t, devs[1].Err)
+	assert.Empty(t, devs[1].Info.ModelName)
+}
+
+func TestOpenMatching(t *testing.T) {
+	root, err := ioutil.TempDir("", "sysfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, tty := range []string{"ttyUSB0", "ttyUSB1", "ttyUSB2"} {
+		addSysfsTTY(t, root, tty, OpenDAQUSBIDs[0])
+	}
+	defer func(dir string) { sysfsTTY = dir }(sysfsTTY)
+	sysfsTTY = filepath.Join(root, "class", "tty")
+
+	// Model and serial number of the device at each port
+	devices := map[string][2]int{
+		"/dev/ttyUSB0": {ModelSId, 1200},
+		"/dev/ttyUSB1": {ModelMId, 42},
+		"/dev/ttyUSB2": {ModelSId, 77},
+	}
+	var mu sync.Mutex
+	sims := make(map[string]*Simulator)
+	open := func(ctx context.Context, port string) (*OpenDAQ, error) {
+		sim, _ := NewSimulator(uint8(devices[port][0]))
+		sim.Serial = uint32(devices[port][1])
+		mu.Lock()
+		sims[port] = sim
+		mu.Unlock()
+		return NewFromTransportContext(ctx, sim)
+	}
+	closed := func(port string) bool {
+		_, err := sims[port].Write([]byte{0})
+		return err != nil
+	}
+	ports := []string{"/dev/ttyUSB2", "/dev/ttyUSB1", "/dev/ttyUSB0"}
+
+	daq, err := openMatching(context.Background(), ports, DiscoverOptions{},
+		func(info DeviceInfo) bool { return info.SerialNumber == 42 }, open)
+	assert.Nil(t, err)
+	assert.Equal(t, "OpenDAQ M", daq.Name)
+	// The other devices are closed
+	assert.False(t, closed("/dev/ttyUSB1"))
+	assert.True(t, closed("/dev/ttyUSB0"))
+	assert.True(t, closed("/dev/ttyUSB2"))
+	daq.Close()
+
+	// The device at the first port is chosen when several of them match
+	daq, err = openMatching(context.Background(), ports, DiscoverOptions{},
+		func(info DeviceInfo) bool { return info.Model == ModelSId }, open)
+	assert.Nil(t, err)
+	assert.Equal(t, "1200", daq.GetDeviceInfo().Serial)
+	assert.True(t, closed("/dev/ttyUSB2"))
+	daq.Close()
+
+	_, err = openMatching(context.Background(), ports, DiscoverOptions{},
+		func(info DeviceInfo) bool { return info.Model == ModelNId }, open)
+	assert.Equal(t, ErrDeviceNotFound, err)
+}
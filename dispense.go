@@ -0,0 +1,112 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrDispenseShort   = errors.New("Fewer pulses counted than sent")
+	ErrDispenseOverrun = errors.New("More pulses counted than sent")
+)
+
+// Settings of DispensePulses
+type PulseConfig struct {
+	Width time.Duration // Time in high level (5 ms by default)
+	Gap   time.Duration // Time in low level between pulses (Width by default)
+	// The PIO is wired to the counter input, to verify the pulses
+	Verify bool
+}
+
+// Result of DispensePulses
+type DispenseResult struct {
+	Sent    int // Pulses generated
+	Counted int // Pulses counted by the counter input (if verified)
+}
+
+// Generate exactly n pulses on the PIO pio, e.g. to drive a dosing pump.
+// Every edge is acknowledged by the device, and a retried command sets the
+// same level again, so pulses are neither lost nor repeated. The pulses are
+// timed by the host: their width is approximate.
+// With cfg.Verify, the pulses are also counted by the counter input, and
+// ErrDispenseShort or ErrDispenseOverrun is returned if the count differs.
+func (daq *OpenDAQ) DispensePulses(pio uint, n int, cfg PulseConfig) (DispenseResult, error) {
+	return daq.DispensePulsesContext(context.Background(), pio, n, cfg)
+}
+
+// Generate n pulses like DispensePulses. If ctx is done, the PIO is left low
+// and the number of pulses sent is returned with the error of ctx.
+func (daq *OpenDAQ) DispensePulsesContext(ctx context.Context, pio uint, n int, cfg PulseConfig) (DispenseResult, error) {
+	var res DispenseResult
+	if n < 0 || cfg.Verify && n > 0xffff {
+		return res, ErrOutOfRange
+	}
+	if cfg.Width == 0 {
+		cfg.Width = 5 * time.Millisecond
+	}
+	if cfg.Gap == 0 {
+		cfg.Gap = cfg.Width
+	}
+	if err := daq.SetPIO(pio, false); err != nil {
+		return res, err
+	}
+	if err := daq.SetPIODir(pio, true); err != nil {
+		return res, err
+	}
+	if cfg.Verify {
+		if err := daq.InitCounter(RISING); err != nil {
+			return res, err
+		}
+	}
+
+	var err error
+	for res.Sent < n {
+		if res.Sent > 0 {
+			if err = sleepContext(ctx, cfg.Gap); err != nil {
+				break
+			}
+		}
+		if err = daq.SetPIO(pio, true); err != nil {
+			break
+		}
+		// A pulse is always completed
+		time.Sleep(cfg.Width)
+		if err = daq.SetPIO(pio, false); err != nil {
+			break
+		}
+		res.Sent++
+	}
+	if err != nil {
+		// Make sure the output is left low
+		daq.SetPIO(pio, false)
+		return res, err
+	}
+
+	if cfg.Verify {
+		count, err := daq.StopCounter()
+		if err != nil {
+			return res, err
+		}
+		res.Counted = int(count)
+		if res.Counted < res.Sent {
+			return res, ErrDispenseShort
+		} else if res.Counted > res.Sent {
+			return res, ErrDispenseOverrun
+		}
+	}
+	return res, nil
+}
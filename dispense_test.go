@@ -0,0 +1,46 @@
+package godaq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDispensePulses(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelMId)
+	sim.CounterWire = 2
+	cfg := PulseConfig{Width: time.Millisecond, Verify: true}
+	res, err := daq.DispensePulses(2, 20, cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, DispenseResult{20, 20}, res)
+	assert.Equal(t, uint8(0), sim.Port().Value&0x02)
+
+	// A retried command doesn't repeat the pulse
+	fail := true
+	sim.Faults = func(cmd CommandNumber) Fault {
+		if cmd == PIO && fail {
+			fail = false
+			return FAULT_TIMEOUT
+		}
+		return NO_FAULT
+	}
+	res, err = daq.DispensePulses(2, 5, cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, DispenseResult{5, 5}, res)
+	sim.Faults = nil
+
+	// Pulses not reaching the counter
+	sim.CounterWire = 3
+	res, err = daq.DispensePulses(2, 5, cfg)
+	assert.Equal(t, ErrDispenseShort, err)
+	assert.Equal(t, DispenseResult{5, 0}, res)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	res, err = daq.DispensePulsesContext(ctx, 2, 1000, PulseConfig{Width: 5 * time.Millisecond})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, res.Sent > 0 && res.Sent < 1000)
+	assert.Equal(t, uint8(0), sim.Port().Value&0x02)
+}
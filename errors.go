@@ -0,0 +1,60 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error of a command sent to the device. The cause is returned by Unwrap,
+// so errors.Is(err, ErrChecksum) or errors.Is(err, ErrTimeout) can be used
+// to tell the failures apart.
+type OpError struct {
+	Command  CommandNumber
+	Port     string // Port or address of the device ("" for other transports)
+	Attempts int    // Number of times the command was sent
+	Err      error
+}
+
+func (e *OpError) Error() string {
+	op := e.Command.String()
+	if e.Port != "" {
+		op += " on " + e.Port
+	}
+	return fmt.Sprintf("%s: %v (%d attempts)", op, e.Err, e.Attempts)
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// The device didn't answer in time
+func (e *OpError) Timeout() bool {
+	return errors.Is(e.Err, ErrTimeout)
+}
+
+// Error of a device of a DeviceGroup
+type GroupError struct {
+	Device int // Index of the device in the group
+	Err    error
+}
+
+func (e *GroupError) Error() string {
+	return fmt.Sprintf("device %d: %v", e.Device, e.Err)
+}
+
+func (e *GroupError) Unwrap() error {
+	return e.Err
+}
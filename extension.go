@@ -0,0 +1,131 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+)
+
+var (
+	ErrCommandExists  = errors.New("Command already registered")
+	ErrUnknownCommand = errors.New("Unknown command")
+	ErrVariableLength = errors.New("Variable response length")
+)
+
+// Command added to the protocol by a firmware extension
+type CommandSpec struct {
+	Number  CommandNumber
+	Name    string
+	RespLen int // Length of the response body (-1 if it's variable)
+}
+
+// Implemented by the models of firmwares with extra commands.
+// RegisterModel registers the commands along with the model.
+type CommandExtender interface {
+	HwModel
+	Commands() []CommandSpec
+}
+
+// Implemented by the models providing high-level methods for the features of
+// their firmware. Extension is called when a device of the model is opened,
+// and returns the value implementing those methods for that device (see
+// OpenDAQ.Extension).
+type DeviceExtender interface {
+	HwModel
+	Extension(daq *OpenDAQ) interface{}
+}
+
+// Add a command to the protocol, so it can be sent with SendCommand and it's
+// named in traces and errors. Registering the same command again is allowed,
+// but not a different one with the same number or name.
+func RegisterCommand(spec CommandSpec) error {
+	commandsMu.Lock()
+	defer commandsMu.Unlock()
+	return registerCommand(spec)
+}
+
+func registerCommand(spec CommandSpec) error {
+	info := commandInfo{spec.Name, spec.RespLen}
+	if spec.Name == "" {
+		return ErrUnknownCommand
+	}
+	if old, exists := commands[spec.Number]; exists {
+		if old != info {
+			return ErrCommandExists
+		}
+		return nil
+	}
+	for _, old := range commands {
+		if old.name == spec.Name {
+			return ErrCommandExists
+		}
+	}
+	commands[spec.Number] = info
+	return nil
+}
+
+// Register the commands of a model, if it extends the protocol
+func registerModelCommands(hw HwModel) error {
+	ext, ok := hw.(CommandExtender)
+	if !ok {
+		return nil
+	}
+	commandsMu.Lock()
+	defer commandsMu.Unlock()
+	for _, spec := range ext.Commands() {
+		if err := registerCommand(spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Return the hardware model of the device. Models of extended firmwares can
+// be detected with a type assertion.
+func (daq *OpenDAQ) Model() HwModel {
+	return daq.hw
+}
+
+// Return the value with the high-level methods of the firmware extension of
+// the device, or nil if its model doesn't implement DeviceExtender.
+// Assert it to the type of the extension:
+//
+//	if ext, ok := daq.Extension().(*vendor.Extension); ok {
+//		...
+//	}
+func (daq *OpenDAQ) Extension() interface{} {
+	return daq.ext
+}
+
+// Send a registered command and return the body of its response.
+// It's meant for the commands of firmware extensions: the retries, the
+// statistics and the errors are those of any other command.
+func (daq *OpenDAQ) SendCommand(ctx context.Context, cmd CommandNumber, body []byte) ([]byte, error) {
+	commandsMu.RLock()
+	info, ok := commands[cmd]
+	commandsMu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownCommand
+	}
+	if info.respLen < 0 {
+		return nil, ErrVariableLength
+	}
+	r, err := daq.sendCommandContext(ctx, &Message{cmd, body}, info.respLen)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
@@ -0,0 +1,93 @@
+package godaq
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const VENDOR_TEMP CommandNumber = 150
+
+// Model of a firmware with a temperature sensor
+type tempModel struct {
+	*ModelM
+}
+
+func (tempModel) Commands() []CommandSpec {
+	return []CommandSpec{{VENDOR_TEMP, "VENDOR_TEMP", 2}}
+}
+
+func (tempModel) Extension(daq *OpenDAQ) interface{} {
+	return &tempExtension{daq}
+}
+
+type tempExtension struct {
+	daq *OpenDAQ
+}
+
+// Temperature in tenths of degree
+func (e *tempExtension) Temperature() (int16, error) {
+	b, err := e.daq.SendCommand(context.Background(), VENDOR_TEMP, nil)
+	if err != nil {
+		return 0, err
+	}
+	return int16(binary.BigEndian.Uint16(b)), nil
+}
+
+// Remove a command registered by a test
+func unregisterCommand(cmd CommandNumber) {
+	commandsMu.Lock()
+	delete(commands, cmd)
+	commandsMu.Unlock()
+}
+
+func TestExtension(t *testing.T) {
+	const id = 210
+	assert.Nil(t, RegisterModel(id, tempModel{NewModelM()}))
+	t.Cleanup(func() {
+		unregisterModel(id)
+		unregisterCommand(VENDOR_TEMP)
+	})
+	assert.Equal(t, "VENDOR_TEMP", VENDOR_TEMP.String())
+	assert.Equal(t, 2, VENDOR_TEMP.RespLen())
+
+	// The same command can be registered again, but not a different one
+	assert.Nil(t, RegisterCommand(CommandSpec{VENDOR_TEMP, "VENDOR_TEMP", 2}))
+	assert.Equal(t, ErrCommandExists, RegisterCommand(CommandSpec{VENDOR_TEMP, "VENDOR_T", 2}))
+	assert.Equal(t, ErrCommandExists, RegisterCommand(CommandSpec{151, "AIN", 2}))
+	assert.Equal(t, ErrCommandExists, RegisterModel(211, customCommandModel{NewModelM()}))
+	_, ok := GetModel(211)
+	assert.False(t, ok)
+
+	daq, sim := newSimDAQ(t, id)
+	sim.Commands = map[CommandNumber]func([]byte) ([]byte, bool){
+		VENDOR_TEMP: func([]byte) ([]byte, bool) { return toBytes(int16(235)), true },
+	}
+	_, ok = daq.Model().(tempModel)
+	assert.True(t, ok)
+	ext, ok := daq.Extension().(*tempExtension)
+	assert.True(t, ok)
+	temp, err := ext.Temperature()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 235, temp)
+
+	_, err = daq.SendCommand(context.Background(), 152, nil)
+	assert.Equal(t, ErrUnknownCommand, err)
+	_, err = daq.SendCommand(context.Background(), AIN_ALL, nil)
+	assert.Equal(t, ErrVariableLength, err)
+
+	// Standard models have no extension
+	daq, _ = newSimDAQ(t, ModelMId)
+	assert.Nil(t, daq.Extension())
+}
+
+// Model with a command that conflicts with VENDOR_TEMP
+type customCommandModel struct {
+	*ModelM
+}
+
+func (customCommandModel) Commands() []CommandSpec {
+	return []CommandSpec{{VENDOR_TEMP, "OTHER", 4}}
+}
@@ -0,0 +1,72 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrInvalidClock = errors.New("Invalid clock source")
+
+type Edge uint8
+
+const (
+	FALLING Edge = iota
+	RISING
+)
+
+// Create an external experiment, which acquires a point on each edge of
+// the trigger input PIO n, instead of periodically.
+// The experiment number is the number of the PIO (1 to MaxStreams), and its
+// channel is configured with ConfigureChannel like a stream experiment.
+func (daq *OpenDAQ) CreateExternal(n uint, edge Edge) error {
+	if n < 1 || n > MaxStreams || n > daq.NPIOs {
+		return ErrInvalidPIO
+	}
+	body := []byte{byte(n), byte(edge)}
+	if _, err := daq.sendCommand(&Message{EXTERNAL_CREATE, body}, EXTERNAL_CREATE.RespLen()); err != nil {
+		return err
+	}
+	daq.streams[n] = &streamConfig{}
+	return nil
+}
+
+type ClockSource uint8
+
+const (
+	INTERNAL_CLOCK ClockSource = iota // Timer of the device
+	EXTERNAL_CLOCK                    // Edges of a trigger PIO
+)
+
+// Clock acquiring the points of an experiment
+type ExperimentClock struct {
+	Source ClockSource
+	Period time.Duration // For INTERNAL_CLOCK
+	Edge   Edge          // For EXTERNAL_CLOCK
+}
+
+// Create the experiment n acquiring its points with the given clock: a stream
+// experiment (see CreateStream) with the internal clock, or an external
+// experiment triggered by the PIO n (see CreateExternal) with the external
+// one, e.g. to synchronize the acquisition with a machine cycle.
+func (daq *OpenDAQ) CreateExperiment(n uint, clk ExperimentClock) error {
+	switch clk.Source {
+	case INTERNAL_CLOCK:
+		return daq.CreateStream(n, clk.Period)
+	case EXTERNAL_CLOCK:
+		return daq.CreateExternal(n, clk.Edge)
+	}
+	return ErrInvalidClock
+}
@@ -0,0 +1,52 @@
+package godaq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateExternal(t *testing.T) {
+	sim, _ := NewSimulator(ModelMId)
+	rec := &recorder{ReadWriteCloser: sim}
+	daq, err := NewFromTransport(rec)
+	assert.Nil(t, err)
+
+	rec.frames = nil
+	assert.Nil(t, daq.CreateExternal(2, RISING))
+	if assert.Len(t, rec.frames, 1) {
+		msg, _ := (&Message{EXTERNAL_CREATE, []byte{2, byte(RISING)}}).Marshal()
+		assert.Equal(t, msg, rec.frames[0])
+	}
+	assert.True(t, sim.streams[2].external)
+
+	assert.Nil(t, daq.ConfigureChannel(2, ChannelConfig{Mode: ANALOG_INPUT, PosInput: 1, NPoints: 10}))
+	assert.Equal(t, [5]byte{byte(ANALOG_INPUT), 1, 0, 0, 0}, sim.streams[2].channel)
+	assert.Equal(t, 10, sim.streams[2].nPoints)
+	assert.Nil(t, daq.DestroyStream(2))
+	_, ok := sim.streams[2]
+	assert.False(t, ok)
+	assert.Equal(t, ErrInvalidStream, daq.DestroyStream(2))
+
+	assert.Equal(t, ErrInvalidPIO, daq.CreateExternal(0, RISING))
+	assert.Equal(t, ErrInvalidPIO, daq.CreateExternal(MaxStreams+1, RISING))
+	daq.NPIOs = 2
+	assert.Equal(t, ErrInvalidPIO, daq.CreateExternal(3, FALLING))
+}
+
+func TestCreateExperiment(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelMId)
+	assert.Nil(t, daq.CreateExperiment(1, ExperimentClock{Source: INTERNAL_CLOCK, Period: 10 * time.Millisecond}))
+	assert.Equal(t, 10*time.Millisecond, daq.streams[1].period)
+	assert.Equal(t, 10*time.Millisecond, sim.streams[1].period)
+
+	assert.Nil(t, daq.CreateExperiment(2, ExperimentClock{Source: EXTERNAL_CLOCK, Edge: RISING}))
+	assert.Zero(t, daq.streams[2].period)
+	assert.True(t, sim.streams[2].external)
+
+	assert.Equal(t, ErrInvalidPeriod, daq.CreateExperiment(3, ExperimentClock{Source: INTERNAL_CLOCK}))
+	assert.Equal(t, ErrInvalidClock, daq.CreateExperiment(3, ExperimentClock{Source: 2, Period: time.Second}))
+	_, ok := daq.streams[3]
+	assert.False(t, ok)
+}
@@ -0,0 +1,292 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+)
+
+// Moving median of the last N values.
+// It removes single-sample spikes (e.g. caused by serial retries or mux
+// switching) without smoothing real steps of the signal.
+type MedianFilter struct {
+	window []float32
+	sorted []float32
+	next   int
+}
+
+func NewMedianFilter(n int) *MedianFilter {
+	if n < 1 {
+		n = 1
+	}
+	return &MedianFilter{window: make([]float32, 0, n), sorted: make([]float32, 0, n)}
+}
+
+// Add a new value and return the median of the window
+func (f *MedianFilter) Filter(v float32) float32 {
+	if len(f.window) < cap(f.window) {
+		f.window = append(f.window, v)
+	} else {
+		f.window[f.next] = v
+		f.next = (f.next + 1) % len(f.window)
+	}
+
+	f.sorted = append(f.sorted[:0], f.window...)
+	sort.Slice(f.sorted, func(i, j int) bool { return f.sorted[i] < f.sorted[j] })
+	n := len(f.sorted)
+	if n%2 == 0 {
+		return (f.sorted[n/2-1] + f.sorted[n/2]) / 2
+	}
+	return f.sorted[n/2]
+}
+
+// Discard all the values stored in the window
+func (f *MedianFilter) Reset() {
+	f.window = f.window[:0]
+	f.next = 0
+}
+
+// Rate of change of a signal, in units per second.
+// The rate is smoothed with an exponential moving average of time constant tau,
+// so it doesn't depend on the interval between readings.
+type Derivative struct {
+	tau   time.Duration
+	last  float32
+	lastT time.Time
+	rate  float32
+	init  bool
+}
+
+func NewDerivative(tau time.Duration) *Derivative {
+	return &Derivative{tau: tau}
+}
+
+// Add the value v read at time t and return the smoothed rate of change
+func (d *Derivative) Update(t time.Time, v float32) float32 {
+	if !d.init {
+		d.last, d.lastT, d.init = v, t, true
+		return 0
+	}
+	dt := t.Sub(d.lastT)
+	if dt <= 0 {
+		return d.rate
+	}
+	rate := (v - d.last) / float32(dt.Seconds())
+	alpha := float32(dt) / float32(d.tau+dt)
+	d.rate += alpha * (rate - d.rate)
+	d.last, d.lastT = v, t
+	return d.rate
+}
+
+// Return the last computed rate of change
+func (d *Derivative) Rate() float32 {
+	return d.rate
+}
+
+func (d *Derivative) Reset() {
+	*d = Derivative{tau: d.tau}
+}
+
+// Alarm raised when the rate of change of a signal goes out of [Min, Max],
+// e.g. a temperature rising faster than 2 °C/min (Max = 2.0 / 60).
+type RateAlarm struct {
+	*Derivative
+	Min, Max float32 // Limits in units per second
+}
+
+func NewRateAlarm(tau time.Duration, min, max float32) *RateAlarm {
+	return &RateAlarm{NewDerivative(tau), min, max}
+}
+
+// Add the value v read at time t and check the rate of change against the limits
+func (a *RateAlarm) Check(t time.Time, v float32) (rate float32, active bool) {
+	rate = a.Update(t, v)
+	return rate, rate < a.Min || rate > a.Max
+}
+
+// AC coupling: removes the DC component of a signal with a first-order
+// high-pass filter. The DC level is tracked with an exponential moving average
+// of time constant tau, which must be several periods of the signal
+// (e.g. 1 s for 50 Hz).
+type ACCoupling struct {
+	tau   time.Duration
+	dc    float32
+	lastT time.Time
+	init  bool
+}
+
+func NewACCoupling(tau time.Duration) *ACCoupling {
+	return &ACCoupling{tau: tau}
+}
+
+// Add the value v read at time t and return it without the DC component
+func (f *ACCoupling) Filter(t time.Time, v float32) float32 {
+	if !f.init {
+		// Start from the first value, avoiding a long transient
+		f.dc, f.lastT, f.init = v, t, true
+		return 0
+	}
+	if dt := t.Sub(f.lastT); dt > 0 {
+		alpha := float32(dt) / float32(f.tau+dt)
+		f.dc += alpha * (v - f.dc)
+		f.lastT = t
+	}
+	return v - f.dc
+}
+
+// Return the DC component of the signal
+func (f *ACCoupling) DC() float32 {
+	return f.dc
+}
+
+func (f *ACCoupling) Reset() {
+	*f = ACCoupling{tau: f.tau}
+}
+
+// True-RMS value over consecutive windows of N values.
+// For periodic signals the window must hold a whole number of periods
+// (e.g. 100 values read every 1 ms for 50 Hz), or the result fluctuates.
+type RMS struct {
+	AC         bool // Remove the mean of each window (RMS of the AC component)
+	n, count   int
+	sum, sumSq float64
+	rms, mean  float32
+}
+
+func NewRMS(n int) *RMS {
+	if n < 1 {
+		n = 1
+	}
+	return &RMS{n: n}
+}
+
+// Add a new value. When a window is complete, its RMS value is returned and
+// done is true.
+func (r *RMS) Add(v float32) (rms float32, done bool) {
+	r.sum += float64(v)
+	r.sumSq += float64(v) * float64(v)
+	r.count++
+	if r.count < r.n {
+		return r.rms, false
+	}
+	mean := r.sum / float64(r.n)
+	ms := r.sumSq / float64(r.n)
+	if r.AC {
+		ms -= mean * mean
+	}
+	r.rms, r.mean = float32(math.Sqrt(math.Max(ms, 0))), float32(mean)
+	r.count, r.sum, r.sumSq = 0, 0, 0
+	return r.rms, true
+}
+
+// Return the RMS value of the last complete window
+func (r *RMS) Value() float32 {
+	return r.rms
+}
+
+// Return the mean value of the last complete window
+func (r *RMS) Mean() float32 {
+	return r.mean
+}
+
+// Discard the values of the current window
+func (r *RMS) Reset() {
+	r.count, r.sum, r.sumSq = 0, 0, 0
+}
+
+// Deadband: a value is reported only when it differs from the last reported
+// one by more than Delta, or when MaxInterval has elapsed since then (0 for
+// never). It reduces the traffic of slowly varying signals published to
+// network or storage sinks.
+type Deadband struct {
+	Delta       float32
+	MaxInterval time.Duration
+	last        float32
+	lastT       time.Time
+	init        bool
+}
+
+func NewDeadband(delta float32, maxInterval time.Duration) *Deadband {
+	return &Deadband{Delta: delta, MaxInterval: maxInterval}
+}
+
+// Add the value v read at time t and tell if it must be reported.
+// The first value is always reported.
+func (d *Deadband) Update(t time.Time, v float32) bool {
+	if d.init && math.Abs(float64(v-d.last)) <= float64(d.Delta) &&
+		(d.MaxInterval == 0 || t.Sub(d.lastT) < d.MaxInterval) {
+		return false
+	}
+	d.last, d.lastT, d.init = v, t, true
+	return true
+}
+
+// Forget the last reported value, so the next one is reported
+func (d *Deadband) Reset() {
+	d.init = false
+}
+
+// Apply a deadband to each stream channel (see Samples), dropping the
+// samples that needn't be reported. The channels without a deadband are
+// passed through. The output channel is closed when in is closed.
+func ApplyDeadband(in <-chan Sample, bands map[uint]*Deadband) <-chan Sample {
+	out := make(chan Sample, 16)
+	go func() {
+		defer close(out)
+		for s := range in {
+			if d, ok := bands[s.Channel]; ok && !d.Update(s.Time, s.Volts) {
+				continue
+			}
+			out <- s
+		}
+	}()
+	return out
+}
+
+// Run the stream experiments (see Samples) and call f with the last reported
+// value of the channel and the new one each time it moves by more than delta
+// from it. The values are in volts for ANALOG_INPUT channels and raw
+// otherwise. It blocks until ctx is done or the stream is interrupted, and
+// returns the error that interrupted it (see StreamErr).
+func (daq *OpenDAQ) OnChange(ctx context.Context, channel uint, delta float32, f func(old, new float32)) error {
+	st, ok := daq.streams[channel]
+	if !ok {
+		return ErrInvalidStream
+	}
+	analog := st.channel.Mode == ANALOG_INPUT
+	samples, err := daq.Samples(ctx)
+	if err != nil {
+		return err
+	}
+	d := NewDeadband(delta, 0)
+	first := true
+	var last float32
+	for s := range samples {
+		v := float32(s.Raw)
+		if analog {
+			v = s.Volts
+		}
+		if s.Channel != channel || !d.Update(s.Time, v) {
+			continue
+		}
+		if !first {
+			f(last, v)
+		}
+		first, last = false, v
+	}
+	return daq.StreamErr()
+}
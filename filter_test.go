@@ -0,0 +1,153 @@
+package godaq
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMedianFilter(t *testing.T) {
+	f := NewMedianFilter(3)
+	var out []float32
+	for _, v := range []float32{1, 1, 9, 1, 1, 5, 5, 5} {
+		out = append(out, f.Filter(v))
+	}
+	// The spike is removed and the step is kept
+	assert.Equal(t, []float32{1, 1, 1, 1, 1, 1, 5, 5}, out)
+
+	f.Reset()
+	assert.Equal(t, float32(7), f.Filter(7))
+}
+
+func TestMedianFilterEven(t *testing.T) {
+	f := NewMedianFilter(2)
+	f.Filter(1)
+	assert.Equal(t, float32(2), f.Filter(3))
+}
+
+func TestDerivative(t *testing.T) {
+	d := NewDerivative(0)
+	t0 := time.Unix(0, 0)
+	assert.Equal(t, float32(0), d.Update(t0, 1))
+	assert.Equal(t, float32(2), d.Update(t0.Add(time.Second), 3))
+	assert.Equal(t, float32(-1), d.Update(t0.Add(3*time.Second), 1))
+
+	// Smoothed: the rate approaches the real slope
+	d = NewDerivative(time.Second)
+	d.Update(t0, 0)
+	assert.Equal(t, float32(0.5), d.Update(t0.Add(time.Second), 1))
+	assert.Equal(t, float32(0.75), d.Update(t0.Add(2*time.Second), 2))
+}
+
+func TestRateAlarm(t *testing.T) {
+	a := NewRateAlarm(0, -1, 2.0/60)
+	t0 := time.Unix(0, 0)
+	_, active := a.Check(t0, 20)
+	assert.False(t, active)
+	_, active = a.Check(t0.Add(time.Minute), 21)
+	assert.False(t, active)
+	rate, active := a.Check(t0.Add(2*time.Minute), 24)
+	assert.True(t, active)
+	assert.InDelta(t, 0.05, rate, 1e-6)
+}
+
+// 50 Hz sine of 1 V peak over a 2 V DC level, read every ms
+func sine50(k int) float32 {
+	return 2 + float32(math.Sin(2*math.Pi*50*float64(k)/1000))
+}
+
+func TestACCoupling(t *testing.T) {
+	f := NewACCoupling(time.Second)
+	t0 := time.Unix(0, 0)
+	var out float32
+	for k := 0; k < 5000; k++ {
+		out = f.Filter(t0.Add(time.Duration(k)*time.Millisecond), sine50(k))
+	}
+	assert.InDelta(t, 2, f.DC(), 0.05)
+	assert.InDelta(t, sine50(4999)-2, out, 0.05)
+
+	f.Reset()
+	assert.Equal(t, float32(0), f.Filter(t0, 5))
+	assert.Equal(t, float32(5), f.DC())
+}
+
+func TestRMS(t *testing.T) {
+	r := NewRMS(100)
+	for k := 0; k < 99; k++ {
+		_, done := r.Add(sine50(k))
+		assert.False(t, done)
+	}
+	rms, done := r.Add(sine50(99))
+	assert.True(t, done)
+	assert.InDelta(t, math.Sqrt(4.5), rms, 1e-4)
+	assert.InDelta(t, 2, r.Mean(), 1e-4)
+
+	r.AC = true
+	for k := 100; k < 200; k++ {
+		rms, done = r.Add(sine50(k))
+	}
+	assert.True(t, done)
+	assert.InDelta(t, 1/math.Sqrt2, rms, 1e-4)
+	assert.Equal(t, rms, r.Value())
+}
+
+func TestDeadband(t *testing.T) {
+	d := NewDeadband(0.1, 10*time.Second)
+	t0 := time.Now()
+	at := func(s float64) time.Time { return t0.Add(time.Duration(s * float64(time.Second))) }
+	assert.True(t, d.Update(at(0), 1))
+	assert.False(t, d.Update(at(1), 1.05))
+	assert.False(t, d.Update(at(2), 0.95))
+	assert.True(t, d.Update(at(3), 1.15))
+	// Slow drift from the last reported value
+	assert.False(t, d.Update(at(4), 1.2))
+	assert.True(t, d.Update(at(5), 1.3))
+	// Reported again after the maximum interval
+	assert.False(t, d.Update(at(14), 1.3))
+	assert.True(t, d.Update(at(15), 1.3))
+
+	d.Reset()
+	assert.True(t, d.Update(at(16), 1.3))
+
+	in := make(chan Sample)
+	out := ApplyDeadband(in, map[uint]*Deadband{1: NewDeadband(0.5, 0)})
+	go func() {
+		for k, v := range []float32{0, 0.2, 0.6, 0.7, 0.3} {
+			in <- Sample{Channel: 1, Volts: v, Time: at(float64(k))}
+			in <- Sample{Channel: 2, Volts: v, Time: at(float64(k))}
+		}
+		close(in)
+	}()
+	var ch1, ch2 []float32
+	for s := range out {
+		if s.Channel == 1 {
+			ch1 = append(ch1, s.Volts)
+		} else {
+			ch2 = append(ch2, s.Volts)
+		}
+	}
+	assert.Equal(t, []float32{0, 0.6}, ch1)
+	assert.Len(t, ch2, 5)
+}
+
+func TestOnChange(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelMId)
+	// Steps between -1 and 1 V every 25 ms
+	sim.Inputs = map[uint]Waveform{1: Square(1, 20, 0)}
+	assert.Equal(t, ErrInvalidStream, daq.OnChange(context.Background(), 1, 0.5, nil))
+	assert.Nil(t, daq.CreateStream(1, time.Millisecond))
+	assert.Nil(t, daq.ConfigureChannel(1, ChannelConfig{Mode: ANALOG_INPUT, PosInput: 1, GainId: 1}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 110*time.Millisecond)
+	defer cancel()
+	changes := 0
+	err := daq.OnChange(ctx, 1, 0.5, func(old, new float32) {
+		assert.InDelta(t, 2, math.Abs(float64(new-old)), 0.1)
+		changes++
+	})
+	assert.Nil(t, err)
+	assert.True(t, changes >= 3 && changes <= 5, "%d changes", changes)
+}
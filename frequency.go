@@ -0,0 +1,98 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import "time"
+
+// Frequency measured at a zero crossing
+type FrequencyPoint struct {
+	Time time.Time
+	Hz   float64
+}
+
+// Frequency of a sampled AC signal, e.g. the mains voltage, measured between
+// consecutive rising zero crossings. The crossing times are interpolated
+// between samples, so the resolution is much better than the sampling
+// period. The DC component is removed first.
+type FrequencyTracker struct {
+	Min, Max   float64 // Frequencies accepted, others are discarded (Hz)
+	Hysteresis float32 // Level the signal must go below to detect the next crossing
+	ac         *ACCoupling
+	last       float32
+	lastT      time.Time
+	cross      time.Time
+	armed      bool
+	hz         float64
+}
+
+// Tracker of the mains frequency: 49 to 61 Hz, for 50 and 60 Hz grids
+func NewFrequencyTracker() *FrequencyTracker {
+	return &FrequencyTracker{Min: 49, Max: 61, ac: NewACCoupling(time.Second)}
+}
+
+// Add the value v read at time t. When a rising zero crossing completes a
+// period in [Min, Max], its frequency is returned and ok is true.
+func (f *FrequencyTracker) Update(t time.Time, v float32) (hz float64, ok bool) {
+	v = f.ac.Filter(t, v)
+	prev, prevT := f.last, f.lastT
+	f.last, f.lastT = v, t
+	if v < -f.Hysteresis {
+		f.armed = true
+	}
+	if prevT.IsZero() || !f.armed || prev >= 0 || v < 0 {
+		return f.hz, false
+	}
+	f.armed = false
+	// Linear interpolation of the crossing time
+	cross := prevT.Add(time.Duration(float64(t.Sub(prevT)) * float64(-prev) / float64(v-prev)))
+	last := f.cross
+	f.cross = cross
+	if last.IsZero() {
+		return f.hz, false
+	}
+	hz = 1 / cross.Sub(last).Seconds()
+	if hz < f.Min || hz > f.Max {
+		return f.hz, false
+	}
+	f.hz = hz
+	return hz, true
+}
+
+// Return the last frequency measured
+func (f *FrequencyTracker) Frequency() float64 {
+	return f.hz
+}
+
+func (f *FrequencyTracker) Reset() {
+	f.ac.Reset()
+	*f = FrequencyTracker{Min: f.Min, Max: f.Max, Hysteresis: f.Hysteresis, ac: f.ac}
+}
+
+// Track the frequency of the samples of a stream channel (see Samples).
+// The output channel is closed when in is closed.
+func TrackFrequency(in <-chan Sample, channel uint, f *FrequencyTracker) <-chan FrequencyPoint {
+	out := make(chan FrequencyPoint, 16)
+	go func() {
+		defer close(out)
+		for s := range in {
+			if s.Channel != channel {
+				continue
+			}
+			if hz, ok := f.Update(s.Time, s.Volts); ok {
+				out <- FrequencyPoint{f.cross, hz}
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,62 @@
+package godaq
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrequencyTracker(t *testing.T) {
+	f := NewFrequencyTracker()
+	f.Hysteresis = 0.1
+	t0 := time.Unix(0, 0)
+	// 50.2 Hz over 1.5 V DC, sampled every ms with some noise
+	var n int
+	var hz, sum float64
+	for k := 0; k < 2000; k++ {
+		ts := float64(k) / 1000
+		v := 1.5 + math.Sin(2*math.Pi*50.2*ts) + 0.01*math.Sin(2*math.Pi*437*ts)
+		if h, ok := f.Update(t0.Add(time.Duration(k)*time.Millisecond), float32(v)); ok {
+			n++
+			hz = h
+			sum += h
+		}
+	}
+	assert.InDelta(t, 99, n, 2)
+	assert.InDelta(t, 50.2, hz, 0.1)
+	assert.InDelta(t, 50.2, sum/float64(n), 0.01)
+	assert.Equal(t, hz, f.Frequency())
+
+	// Out of range
+	f.Reset()
+	for k := 0; k < 1000; k++ {
+		v := math.Sin(2 * math.Pi * 10 * float64(k) / 1000)
+		_, ok := f.Update(t0.Add(time.Duration(k)*time.Millisecond), float32(v))
+		assert.False(t, ok)
+	}
+}
+
+func TestTrackFrequency(t *testing.T) {
+	in := make(chan Sample)
+	out := TrackFrequency(in, 1, NewFrequencyTracker())
+	go func() {
+		t0 := time.Unix(0, 0)
+		for k := 0; k < 500; k++ {
+			ts := t0.Add(time.Duration(k) * time.Millisecond)
+			v := float32(math.Sin(2 * math.Pi * 60 * float64(k) / 1000))
+			in <- Sample{Channel: 1, Volts: v, Time: ts}
+			in <- Sample{Channel: 2, Volts: 0, Time: ts}
+		}
+		close(in)
+	}()
+	var points []FrequencyPoint
+	for p := range out {
+		points = append(points, p)
+	}
+	assert.True(t, len(points) > 25)
+	for _, p := range points {
+		assert.InDelta(t, 60, p.Hz, 0.05)
+	}
+}
@@ -0,0 +1,427 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+var ErrGeneratorRunning = errors.New("Generator already running")
+
+// The signal can't be played by the hardware
+var errNoHardware = errors.New("No hardware stream-out for this signal")
+
+// Size of the signal buffer of the firmware, in points
+const MaxSignalPoints = 400
+
+// Stream experiment used by the hardware generator
+const generatorStream = 1
+
+// Shape of a periodic signal
+type Shape uint8
+
+const (
+	SINE Shape = iota
+	SQUARE
+	TRIANGLE
+	SAWTOOTH
+	DC // Only the offset
+)
+
+// Value of the shape at the phase p (in cycles), between -1 and 1
+func (s Shape) at(p float64) float64 {
+	p -= math.Floor(p)
+	switch s {
+	case SINE:
+		return math.Sin(2 * math.Pi * p)
+	case SQUARE:
+		if p < 0.5 {
+			return 1
+		}
+		return -1
+	case TRIANGLE:
+		if p < 0.25 {
+			return 4 * p
+		} else if p < 0.75 {
+			return 2 - 4*p
+		}
+		return 4*p - 4
+	case SAWTOOTH:
+		return 2*p - 1
+	}
+	return 0
+}
+
+// Periodic signal
+type Signal struct {
+	Shape     Shape
+	Frequency float64 // Hz
+	Amplitude float32 // Peak voltage around the offset
+	Offset    float32
+}
+
+// Value of the signal at the phase p (in cycles)
+func (s Signal) at(p float64) float32 {
+	return s.Offset + s.Amplitude*float32(s.Shape.at(p))
+}
+
+// Return the signal as a function of the time since its start
+func (s Signal) Waveform() Waveform {
+	return func(t time.Duration) float32 {
+		return s.at(s.Frequency * t.Seconds())
+	}
+}
+
+// Configuration of a Generator
+type GeneratorConfig struct {
+	Output uint          // Analog output (1 by default)
+	Period time.Duration // Between points (MinSoftwarePeriod by default)
+	// Don't use the hardware stream-out, e.g. to keep the stream experiments
+	// free for acquisitions
+	Software bool
+}
+
+// Signal generator on an analog output.
+// The signal is played by the firmware from its signal buffer when possible:
+// the period must be a whole number of milliseconds, there must be no stream
+// experiments, a cycle must fit in MaxSignalPoints and the firmware must
+// accept the buffer. Then the frequency is rounded to a whole number of points
+// per cycle, and no other commands can be sent while it plays. Otherwise the
+// points are written from the host, like PlaySoftware does.
+// The frequency and the rest of the signal can be changed while it plays,
+// keeping its phase.
+type Generator struct {
+	daq *OpenDAQ
+	cfg GeneratorConfig
+
+	ctl sync.Mutex // Serializes Start, Set and Stop
+
+	mu     sync.Mutex
+	signal Signal
+	freq   float64 // Actual frequency
+	phase  float64 // Phase (in cycles) at phaseT
+	phaseT time.Time
+
+	running  bool
+	hardware bool
+	cancel   context.CancelFunc
+	done     chan struct{}
+	stats    OutputStats
+	err      error
+}
+
+func (daq *OpenDAQ) NewGenerator(cfg GeneratorConfig) (*Generator, error) {
+	if cfg.Output == 0 {
+		cfg.Output = 1
+	}
+	if cfg.Output > daq.NOutputs {
+		return nil, ErrInvalidOutput
+	}
+	if cfg.Period == 0 {
+		cfg.Period = MinSoftwarePeriod
+	}
+	if cfg.Period < time.Millisecond {
+		return nil, ErrInvalidPeriod
+	}
+	return &Generator{daq: daq, cfg: cfg}, nil
+}
+
+// Check that the signal is within the range of the output
+func (g *Generator) check(sig Signal) error {
+	if sig.Frequency < 0 || math.IsInf(sig.Frequency, 0) || math.IsNaN(sig.Frequency) {
+		return ErrOutOfRange
+	}
+	a := float32(math.Abs(float64(sig.Amplitude)))
+	if sig.Shape == DC {
+		a = 0
+	}
+	if err := g.daq.Dac.CheckRange(sig.Offset - a); err != nil {
+		return err
+	}
+	return g.daq.Dac.CheckRange(sig.Offset + a)
+}
+
+// Phase at time t
+func (g *Generator) phaseAt(t time.Time) float64 {
+	return g.phase + g.freq*t.Sub(g.phaseT).Seconds()
+}
+
+// Start playing the signal
+func (g *Generator) Start(sig Signal) error {
+	if err := g.check(sig); err != nil {
+		return err
+	}
+	g.ctl.Lock()
+	defer g.ctl.Unlock()
+	g.mu.Lock()
+	if g.running {
+		g.mu.Unlock()
+		return ErrGeneratorRunning
+	}
+	g.signal, g.freq, g.phase, g.phaseT = sig, sig.Frequency, 0, time.Now()
+	g.stats, g.err = OutputStats{}, nil
+	g.mu.Unlock()
+
+	if !g.cfg.Software {
+		err := g.startHardware()
+		if err == nil {
+			g.setRunning(true, true)
+			return nil
+		}
+		if !errors.Is(err, errNoHardware) {
+			return err
+		}
+	}
+	if g.cfg.Period < MinSoftwarePeriod {
+		return ErrInvalidPeriod
+	}
+	g.startSoftware()
+	return nil
+}
+
+// Set the state of the generator
+func (g *Generator) setRunning(running, hardware bool) {
+	g.mu.Lock()
+	g.running, g.hardware = running, hardware
+	g.mu.Unlock()
+}
+
+func (g *Generator) startSoftware() {
+	ctx, cancel := context.WithCancel(context.Background())
+	g.cancel, g.done = cancel, make(chan struct{})
+	g.setRunning(true, false)
+	start := time.Now()
+	w := func(t time.Duration) float32 {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		return g.signal.at(g.phaseAt(start.Add(t)))
+	}
+	go func() {
+		defer close(g.done)
+		stats, err := g.daq.playSoftware(ctx, g.cfg.Output, w, g.cfg.Period, 0)
+		g.mu.Lock()
+		g.stats, g.err = stats, err
+		g.mu.Unlock()
+	}()
+}
+
+// Raw DAC values of a cycle of the signal starting at the phase p
+func (g *Generator) signalPoints(sig Signal, p float64) ([]byte, float64, error) {
+	if actual, err := g.daq.StreamPeriod(g.cfg.Period); err != nil || actual != g.cfg.Period ||
+		sig.Frequency <= 0 {
+		return nil, 0, errNoHardware
+	}
+	n := int(math.Round(1 / (sig.Frequency * g.cfg.Period.Seconds())))
+	if n < 2 || n > MaxSignalPoints {
+		return nil, 0, errNoHardware
+	}
+	payload := make([]byte, 0, 2*n)
+	for k := 0; k < n; k++ {
+		raw, err := g.daq.voltsToDac(sig.at(p+float64(k)/float64(n)), g.cfg.Output)
+		if err != nil {
+			return nil, 0, err
+		}
+		payload = append(payload, toBytes(int16(raw))...)
+	}
+	return payload, 1 / (float64(n) * g.cfg.Period.Seconds()), nil
+}
+
+// Load a cycle of the signal starting at the current phase, and start the
+// stream experiment that plays it
+func (g *Generator) loadAndStart() error {
+	g.mu.Lock()
+	now := time.Now()
+	sig, p := g.signal, g.phaseAt(now)
+	g.mu.Unlock()
+	payload, freq, err := g.signalPoints(sig, p)
+	if err != nil {
+		return err
+	}
+	if err := g.daq.loadSignal(payload); err != nil {
+		return err
+	}
+	if err := g.daq.startOutputStream(); err != nil {
+		return err
+	}
+	g.mu.Lock()
+	g.phase, g.phaseT, g.freq = p, time.Now(), freq
+	g.mu.Unlock()
+	return nil
+}
+
+// Load the raw DAC values in the signal buffer of the firmware.
+// Each LOAD_SIGNAL command carries the offset of its points in the buffer,
+// and the response holds the number of points loaded and the offset.
+func (daq *OpenDAQ) loadSignal(payload []byte) error {
+	msgs, err := splitPayload(LOAD_SIGNAL, payload, maxBodyLen-chunkHeaderLen, 2)
+	if err != nil {
+		return err
+	}
+	for _, msg := range msgs {
+		if err := daq.loadSignalChunk(msg); err != nil {
+			if errors.Is(err, ErrNakReceived) || errors.Is(err, ErrTimeout) {
+				// The firmware has no signal buffer
+				return fmt.Errorf("%w: %v", errNoHardware, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (daq *OpenDAQ) loadSignalChunk(msg *Message) error {
+	r, err := daq.sendCommand(msg, LOAD_SIGNAL.RespLen())
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		N    uint16
+		Offs uint16
+	}
+	if err := binary.Read(r, binary.BigEndian, &resp); err != nil {
+		return err
+	}
+	if int(resp.N) != (len(msg.Body)-chunkHeaderLen)/2 || resp.Offs != binary.BigEndian.Uint16(msg.Body) {
+		return ErrChunkMismatch
+	}
+	return nil
+}
+
+// Start the stream experiments playing the signal buffer
+func (daq *OpenDAQ) startOutputStream() error {
+	packets, err := daq.StartStream()
+	if err != nil {
+		return err
+	}
+	// The output stream sends no data, but the packets are drained anyway
+	go func() {
+		for range packets {
+		}
+	}()
+	return nil
+}
+
+func (g *Generator) startHardware() error {
+	if len(g.daq.streams) != 0 {
+		return errNoHardware
+	}
+	if _, _, err := g.signalPoints(g.signal, 0); err != nil {
+		return err
+	}
+	if err := g.daq.CreateStream(generatorStream, g.cfg.Period); err != nil {
+		return err
+	}
+	err := g.daq.ConfigureChannel(generatorStream, ChannelConfig{Mode: ANALOG_OUTPUT,
+		PosInput: g.cfg.Output})
+	if err == nil {
+		err = g.loadAndStart()
+	}
+	if err != nil {
+		g.daq.DestroyStream(generatorStream)
+	}
+	return err
+}
+
+// Change the signal, keeping its phase. In hardware, the signal buffer is
+// loaded again, holding the output for a few milliseconds; if the new signal
+// can't be played by the hardware, ErrOutOfRange is returned, and if the
+// buffer can't be loaded the generator is stopped.
+func (g *Generator) Set(sig Signal) error {
+	if err := g.check(sig); err != nil {
+		return err
+	}
+	g.ctl.Lock()
+	defer g.ctl.Unlock()
+	g.mu.Lock()
+	hardware := g.running && g.hardware
+	g.mu.Unlock()
+	if hardware {
+		if _, _, err := g.signalPoints(sig, 0); err != nil {
+			return ErrOutOfRange
+		}
+	}
+	g.mu.Lock()
+	now := time.Now()
+	g.phase, g.phaseT = g.phaseAt(now), now
+	g.signal, g.freq = sig, sig.Frequency
+	g.mu.Unlock()
+	if !hardware {
+		return nil
+	}
+	if err := g.daq.StopStream(); err != nil {
+		return err
+	}
+	if err := g.loadAndStart(); err != nil {
+		// The signal isn't played anymore
+		g.daq.DestroyStream(generatorStream)
+		g.setRunning(false, false)
+		return err
+	}
+	return nil
+}
+
+// Change the frequency (Hz), keeping the phase
+func (g *Generator) SetFrequency(freq float64) error {
+	g.mu.Lock()
+	sig := g.signal
+	g.mu.Unlock()
+	sig.Frequency = freq
+	return g.Set(sig)
+}
+
+// Return the frequency being played, which is rounded in hardware
+func (g *Generator) Frequency() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.freq
+}
+
+// The signal is played by the firmware
+func (g *Generator) Hardware() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.hardware
+}
+
+// Stop playing the signal. The output keeps its last value.
+// The timing statistics are returned for software generation.
+func (g *Generator) Stop() (OutputStats, error) {
+	g.ctl.Lock()
+	defer g.ctl.Unlock()
+	g.mu.Lock()
+	running, hardware := g.running, g.hardware
+	g.running = false
+	g.mu.Unlock()
+	if !running {
+		return OutputStats{}, nil
+	}
+	if hardware {
+		err := g.daq.StopStream()
+		if e := g.daq.DestroyStream(generatorStream); err == nil {
+			err = e
+		}
+		return OutputStats{}, err
+	}
+	g.cancel()
+	<-g.done
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.stats, g.err
+}
@@ -0,0 +1,162 @@
+package godaq
+
+import (
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShapes(t *testing.T) {
+	ms := time.Millisecond
+	sq := Square(1, 10, 2)
+	assert.Equal(t, float32(3), sq(10*ms))
+	assert.Equal(t, float32(1), sq(60*ms))
+	tri := Triangle(2, 10, 0)
+	assert.InDelta(t, 0, tri(0), 1e-6)
+	assert.InDelta(t, 2, tri(25*ms), 1e-6)
+	assert.InDelta(t, -2, tri(75*ms), 1e-6)
+	saw := Sawtooth(1, 10, 0)
+	assert.InDelta(t, -1, saw(0), 1e-6)
+	assert.InDelta(t, 0, saw(50*ms), 1e-6)
+	dc := Signal{DC, 10, 1, 0.5}.Waveform()
+	assert.Equal(t, float32(0.5), dc(33*ms))
+}
+
+func TestLoadSignal(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelMId)
+	payload := make([]byte, 0, 2*MaxSignalPoints)
+	for i := 0; i < MaxSignalPoints; i++ {
+		payload = append(payload, toBytes(int16(i))...)
+	}
+	assert.Nil(t, daq.loadSignal(payload))
+	sim.mu.Lock()
+	assert.Len(t, sim.signal, MaxSignalPoints)
+	assert.EqualValues(t, MaxSignalPoints-1, sim.signal[MaxSignalPoints-1])
+	sim.mu.Unlock()
+
+	// The response doesn't count the points sent
+	sim.Commands = map[CommandNumber]func([]byte) ([]byte, bool){
+		LOAD_SIGNAL: func(b []byte) ([]byte, bool) {
+			return append(toBytes(uint16(1)), b[:2]...), true
+		},
+	}
+	assert.Equal(t, ErrChunkMismatch, daq.loadSignal(payload))
+}
+
+func TestGeneratorHardware(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelMId)
+	g, err := daq.NewGenerator(GeneratorConfig{Period: time.Millisecond})
+	assert.Nil(t, err)
+	assert.Nil(t, g.Start(Signal{SINE, 10, 1, 0.5}))
+	assert.True(t, g.Hardware())
+	assert.Equal(t, 10.0, g.Frequency())
+	assert.Equal(t, ErrGeneratorRunning, g.Start(Signal{SINE, 10, 1, 0}))
+
+	// A cycle is loaded in the signal buffer
+	sim.mu.Lock()
+	assert.Len(t, sim.signal, 100)
+	peak := sim.signal[0]
+	for _, raw := range sim.signal {
+		if raw > peak {
+			peak = raw
+		}
+	}
+	sim.mu.Unlock()
+	assert.InDelta(t, 1.5, sim.features.Dac.toVolts(int(peak)), 0.05)
+
+	// The output follows the signal
+	values := make(map[int16]bool)
+	for i := 0; i < 10; i++ {
+		time.Sleep(3 * time.Millisecond)
+		values[sim.DAC(1)] = true
+	}
+	assert.True(t, len(values) > 3)
+
+	// The frequency is rounded to a whole number of points per cycle
+	assert.Nil(t, g.SetFrequency(30))
+	assert.InDelta(t, 1000.0/33, g.Frequency(), 1e-9)
+	sim.mu.Lock()
+	assert.Len(t, sim.signal, 33)
+	sim.mu.Unlock()
+	assert.Equal(t, ErrOutOfRange, g.SetFrequency(1))
+	// The amplitude exceeds the range of the output
+	assert.NotNil(t, g.Set(Signal{SINE, 10, 5, 0}))
+
+	_, err = g.Stop()
+	assert.Nil(t, err)
+	assert.Empty(t, daq.streams)
+	assert.Nil(t, daq.SetAnalog(1, 0))
+}
+
+func TestGeneratorReload(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelMId)
+	g, _ := daq.NewGenerator(GeneratorConfig{Period: time.Millisecond})
+	assert.Nil(t, g.Start(Signal{SINE, 10, 1, 0.5}))
+
+	// Stop and SetFrequency can be called concurrently
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		g.SetFrequency(20)
+	}()
+	_, err := g.Stop()
+	assert.Nil(t, err)
+	wg.Wait()
+	_, err = g.Stop()
+	assert.Nil(t, err)
+
+	// The generator is stopped if the buffer can't be loaded again
+	assert.Nil(t, g.Start(Signal{SINE, 10, 1, 0.5}))
+	sim.Faults = func(cmd CommandNumber) Fault {
+		if cmd == LOAD_SIGNAL {
+			return FAULT_NAK
+		}
+		return NO_FAULT
+	}
+	assert.NotNil(t, g.SetFrequency(20))
+	assert.False(t, g.Hardware())
+	assert.Empty(t, daq.streams)
+	sim.Faults = nil
+	assert.Nil(t, g.Start(Signal{SINE, 10, 1, 0.5}))
+	assert.True(t, g.Hardware())
+	_, err = g.Stop()
+	assert.Nil(t, err)
+}
+
+func TestGeneratorSoftware(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelMId)
+	// The firmware has no signal buffer
+	sim.Faults = func(cmd CommandNumber) Fault {
+		if cmd == LOAD_SIGNAL {
+			return FAULT_NAK
+		}
+		return NO_FAULT
+	}
+	g, err := daq.NewGenerator(GeneratorConfig{})
+	assert.Nil(t, err)
+	assert.Nil(t, g.Start(Signal{SQUARE, 10, 1, 0}))
+	assert.False(t, g.Hardware())
+	assert.Empty(t, daq.streams)
+
+	// Phase-continuous frequency change
+	g.mu.Lock()
+	now := time.Now()
+	before := g.phaseAt(now)
+	g.mu.Unlock()
+	assert.Nil(t, g.SetFrequency(20))
+	g.mu.Lock()
+	assert.InDelta(t, before, g.phaseAt(now), 0.01)
+	g.mu.Unlock()
+
+	time.Sleep(50 * time.Millisecond)
+	stats, err := g.Stop()
+	assert.Nil(t, err)
+	assert.True(t, stats.Points > 3, "%d points", stats.Points)
+	raw := sim.DAC(1)
+	v := sim.features.Dac.toVolts(int(raw))
+	assert.InDelta(t, 1, math.Abs(float64(v)), 0.05)
+}
@@ -0,0 +1,167 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Several devices used together, e.g. a test bench with more channels than
+// a single device provides. The operations are run on all the devices in
+// parallel, and fail with a *GroupError holding the first device that failed.
+type DeviceGroup struct {
+	Devices []*OpenDAQ
+}
+
+func NewDeviceGroup(devices ...*OpenDAQ) *DeviceGroup {
+	return &DeviceGroup{devices}
+}
+
+// Open the devices at the given ports in parallel. If any of them fails,
+// the others are closed.
+func OpenGroup(ports []string, opts ...Option) (*DeviceGroup, error) {
+	g := &DeviceGroup{make([]*OpenDAQ, len(ports))}
+	err := g.Each(func(i int, _ *OpenDAQ) (err error) {
+		g.Devices[i], err = New(ports[i], opts...)
+		return err
+	})
+	if err != nil {
+		for _, daq := range g.Devices {
+			if daq != nil {
+				daq.Close()
+			}
+		}
+		return nil, err
+	}
+	return g, nil
+}
+
+// Run f for each device in parallel, e.g. to configure them differently
+func (g *DeviceGroup) Each(f func(i int, daq *OpenDAQ) error) error {
+	errs := make([]error, len(g.Devices))
+	var wg sync.WaitGroup
+	for i, daq := range g.Devices {
+		wg.Add(1)
+		go func(i int, daq *OpenDAQ) {
+			defer wg.Done()
+			errs[i] = f(i, daq)
+		}(i, daq)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return &GroupError{i, err}
+		}
+	}
+	return nil
+}
+
+func (g *DeviceGroup) Close() error {
+	return g.Each(func(_ int, daq *OpenDAQ) error { return daq.Close() })
+}
+
+func (g *DeviceGroup) ConfigureADC(posInput, negInput, gainId uint, nSamples uint8) error {
+	return g.Each(func(_ int, daq *OpenDAQ) error {
+		return daq.ConfigureADC(posInput, negInput, gainId, nSamples)
+	})
+}
+
+func (g *DeviceGroup) SetAnalog(n uint, val float32) error {
+	return g.Each(func(_ int, daq *OpenDAQ) error { return daq.SetAnalog(n, val) })
+}
+
+func (g *DeviceGroup) CreateStream(n uint, period time.Duration) error {
+	return g.Each(func(_ int, daq *OpenDAQ) error { return daq.CreateStream(n, period) })
+}
+
+func (g *DeviceGroup) ConfigureChannel(n uint, cfg ChannelConfig) error {
+	return g.Each(func(_ int, daq *OpenDAQ) error { return daq.ConfigureChannel(n, cfg) })
+}
+
+func (g *DeviceGroup) DestroyStream(n uint) error {
+	return g.Each(func(_ int, daq *OpenDAQ) error { return daq.DestroyStream(n) })
+}
+
+// Read a value from every device at the same time. The timing of each
+// reading places them on a common time axis.
+func (g *DeviceGroup) ReadAnalog() ([]Reading, error) {
+	readings := make([]Reading, len(g.Devices))
+	err := g.Each(func(i int, daq *OpenDAQ) (err error) {
+		readings[i], err = daq.ReadAnalogInfo()
+		return err
+	})
+	return readings, err
+}
+
+// Point of a stream experiment of a device of a group
+type GroupSample struct {
+	Device int // Index of the device in the group
+	Sample
+}
+
+// Start the stream experiments of all the devices at the same time and
+// deliver their points, merged, until ctx is done. The start commands are
+// released together, so the times of the points of different devices are
+// aligned within the latency of the links.
+// If a device fails to start, the others are stopped.
+func (g *DeviceGroup) Samples(ctx context.Context) (<-chan GroupSample, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	ins := make([]<-chan Sample, len(g.Devices))
+	start := make(chan struct{})
+	var ready sync.WaitGroup
+	ready.Add(len(g.Devices))
+	go func() {
+		ready.Wait()
+		close(start)
+	}()
+	err := g.Each(func(i int, daq *OpenDAQ) (err error) {
+		ready.Done()
+		<-start
+		ins[i], err = daq.Samples(ctx)
+		return err
+	})
+	if err != nil {
+		cancel()
+		for _, in := range ins {
+			if in != nil {
+				for range in {
+				}
+			}
+		}
+		return nil, err
+	}
+
+	out := make(chan GroupSample, 256)
+	var wg sync.WaitGroup
+	for i, in := range ins {
+		wg.Add(1)
+		go func(i int, in <-chan Sample) {
+			defer wg.Done()
+			for s := range in {
+				select {
+				case out <- GroupSample{i, s}:
+				case <-ctx.Done():
+				}
+			}
+		}(i, in)
+	}
+	go func() {
+		wg.Wait()
+		cancel()
+		close(out)
+	}()
+	return out, nil
+}
@@ -0,0 +1,80 @@
+package godaq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newSimGroup(t *testing.T, n int) (*DeviceGroup, []*Simulator) {
+	g := NewDeviceGroup()
+	var sims []*Simulator
+	for i := 0; i < n; i++ {
+		daq, sim := newSimDAQ(t, ModelMId)
+		g.Devices = append(g.Devices, daq)
+		sims = append(sims, sim)
+	}
+	return g, sims
+}
+
+func TestDeviceGroup(t *testing.T) {
+	g, sims := newSimGroup(t, 3)
+	for i, sim := range sims {
+		sim.Inputs = map[uint]Waveform{2: Constant(float32(i))}
+	}
+	assert.Nil(t, g.ConfigureADC(2, 0, 1, 1))
+	readings, err := g.ReadAnalog()
+	assert.Nil(t, err)
+	assert.Len(t, readings, 3)
+	for i, r := range readings {
+		assert.InDelta(t, float32(i), r.Volts, 0.01)
+		assert.False(t, r.Timing.Sent.IsZero())
+	}
+
+	// The first device that fails is reported
+	err = g.Each(func(i int, daq *OpenDAQ) error {
+		if i == 0 {
+			return nil
+		}
+		return daq.ConfigureADC(20, 0, 0, 1)
+	})
+	var groupErr *GroupError
+	assert.True(t, errors.As(err, &groupErr))
+	assert.Equal(t, 1, groupErr.Device)
+	assert.True(t, errors.Is(err, ErrInvalidInput))
+
+	assert.Nil(t, g.Close())
+	_, err = sims[2].Write([]byte{0})
+	assert.NotNil(t, err)
+}
+
+func TestDeviceGroupSamples(t *testing.T) {
+	g, _ := newSimGroup(t, 2)
+	assert.Nil(t, g.CreateStream(1, 5*time.Millisecond))
+	assert.Nil(t, g.ConfigureChannel(1, ChannelConfig{Mode: ANALOG_INPUT, PosInput: 1, NSamples: 1}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	samples, err := g.Samples(ctx)
+	assert.Nil(t, err)
+	var first [2]time.Time
+	count := [2]int{}
+	for s := range samples {
+		if count[s.Device] == 0 {
+			first[s.Device] = s.Time
+		}
+		count[s.Device]++
+	}
+	assert.True(t, count[0] > 5 && count[1] > 5, "%v", count)
+	// The streams start at the same time
+	diff := first[0].Sub(first[1])
+	assert.True(t, diff < 10*time.Millisecond && diff > -10*time.Millisecond, "%v", diff)
+
+	// The devices can be used again
+	assert.Nil(t, g.DestroyStream(1))
+	_, err = g.ReadAnalog()
+	assert.Nil(t, err)
+}
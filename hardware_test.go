@@ -0,0 +1,214 @@
+//go:build hardware
+// +build hardware
+
+// Integration tests run against the openDAQ devices attached to this machine:
+//
+//	go test -tags hardware -v
+//
+// Environment variables:
+//	GODAQ_PORTS     comma-separated list of ports (all openDAQs are used by default)
+//	GODAQ_LOOPBACK  number of the input wired to the output 1 (loopback test)
+//	GODAQ_JUNIT     write a JUnit XML report to this path
+
+package godaq
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+}
+
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+var report = struct {
+	junitSuite
+	sync.Mutex
+}{junitSuite: junitSuite{Name: "godaq-hardware"}}
+
+// Record the result of a test in the JUnit report
+func record(t *testing.T, class string) {
+	start := time.Now()
+	t.Cleanup(func() {
+		c := junitCase{Name: t.Name(), Classname: class, Time: time.Since(start).Seconds()}
+		if t.Failed() {
+			c.Failure = &junitFailure{"failed"}
+		} else if t.Skipped() {
+			c.Skipped = &struct{}{}
+		}
+		report.Lock()
+		report.Cases = append(report.Cases, c)
+		report.Tests++
+		if t.Failed() {
+			report.Failures++
+		}
+		report.Unlock()
+	})
+}
+
+func writeReport(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := xml.NewEncoder(f)
+	enc.Indent("", "  ")
+	return enc.Encode(report.junitSuite)
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if path := os.Getenv("GODAQ_JUNIT"); path != "" {
+		if err := writeReport(path); err != nil {
+			fmt.Fprintln(os.Stderr, "JUnit report:", err)
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
+func devicePorts(t *testing.T) []string {
+	if ports := os.Getenv("GODAQ_PORTS"); ports != "" {
+		return strings.Split(ports, ",")
+	}
+	devs, err := ListDevicePorts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ports []string
+	for _, dev := range devs {
+		ports = append(ports, dev.Port)
+	}
+	if len(ports) == 0 {
+		t.Skip("no openDAQ devices found")
+	}
+	return ports
+}
+
+func TestHardware(t *testing.T) {
+	for _, port := range devicePorts(t) {
+		port := port
+		t.Run(port, func(t *testing.T) {
+			daq, err := New(port)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer daq.Close()
+			class := "godaq." + strings.Replace(daq.Name, " ", "", -1)
+
+			t.Run("Info", func(t *testing.T) {
+				record(t, class)
+				model, _, serial, err := daq.GetInfo()
+				assert.Nil(t, err)
+				hw, ok := GetModel(model)
+				assert.True(t, ok)
+				assert.Equal(t, daq.HwFeatures, hw.GetFeatures())
+				assert.NotEmpty(t, serial)
+			})
+
+			t.Run("Calib", func(t *testing.T) {
+				record(t, class)
+				for i := range daq.calib {
+					cal, err := daq.readCalib(context.Background(), uint8(i))
+					assert.Nil(t, err)
+					// Calibration gains are small corrections
+					assert.InDelta(t, 1, cal.Gain, 0.5, "register %d", i)
+				}
+			})
+
+			t.Run("Loopback", func(t *testing.T) {
+				record(t, class)
+				input, err := strconv.Atoi(os.Getenv("GODAQ_LOOPBACK"))
+				if err != nil {
+					t.Skip("GODAQ_LOOPBACK not set")
+				}
+				assert.Nil(t, daq.ConfigureADC(uint(input), 0, 0, 20))
+				for _, v := range []float32{0.5, 1.5} {
+					assert.Nil(t, daq.SetAnalog(1, v))
+					time.Sleep(50 * time.Millisecond)
+					read, err := daq.ReadAnalog()
+					assert.Nil(t, err)
+					assert.InDelta(t, v, read, 0.05)
+				}
+				assert.Nil(t, daq.SetAnalog(1, 0))
+			})
+
+			t.Run("PIOWalk", func(t *testing.T) {
+				record(t, class)
+				for n := uint(1); n <= daq.NPIOs; n++ {
+					assert.Nil(t, daq.SetPIODir(n, true))
+					for _, v := range []bool{true, false} {
+						assert.Nil(t, daq.SetPIO(n, v))
+						read, err := daq.ReadPIO(n)
+						assert.Nil(t, err)
+						assert.Equal(t, boolToByte(v), read, "PIO %d", n)
+					}
+					assert.Nil(t, daq.SetPIODir(n, false))
+				}
+			})
+
+			t.Run("Stream", func(t *testing.T) {
+				record(t, class)
+				assert.Nil(t, daq.CreateStream(1, 10*time.Millisecond))
+				assert.Nil(t, daq.ConfigureChannel(1, ChannelConfig{Mode: ANALOG_INPUT,
+					PosInput: 1, NSamples: 1}))
+				data, err := daq.StartStream()
+				if err != nil {
+					t.Fatal(err)
+				}
+				points := 0
+				timeout := time.After(2 * time.Second)
+				for points < 50 {
+					select {
+					case pkt := <-data:
+						assert.EqualValues(t, 1, pkt.Stream)
+						assert.Equal(t, len(pkt.Raw), len(pkt.Volts))
+						points += len(pkt.Raw)
+					case <-timeout:
+						t.Errorf("only %d points received", points)
+						points = 50
+					}
+				}
+				assert.Nil(t, daq.StopStream())
+				assert.Nil(t, daq.DestroyStream(1))
+			})
+
+			t.Run("Conformance", func(t *testing.T) {
+				record(t, class)
+				results, err := daq.CheckConformance()
+				if err != nil {
+					t.Fatal(err)
+				}
+				var b strings.Builder
+				WriteConformanceTable(&b, results)
+				t.Log("\n" + b.String())
+			})
+		})
+	}
+}
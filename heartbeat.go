@@ -0,0 +1,97 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"context"
+	"time"
+)
+
+// Number of consecutive failed commands considered a persistent failure
+const heartbeatFailures = 3
+
+// Blink the LED n in green while the connection is healthy and turn it red
+// when the commands fail persistently.
+// The LED blinks once per period, which must be 2 ms at least. Its commands
+// have the SCHEDULED priority.
+func (daq *OpenDAQ) StartHeartbeat(n uint, period time.Duration) error {
+	if n < 1 || n > daq.NLeds {
+		return ErrInvalidLed
+	}
+	if period < 2*time.Millisecond {
+		return ErrInvalidPeriod
+	}
+	daq.StopHeartbeat()
+	stop, done := make(chan struct{}), make(chan struct{})
+	daq.heartbeat, daq.heartbeatDone = stop, done
+
+	ctx := WithPriority(context.Background(), SCHEDULED)
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(period / 2)
+		defer ticker.Stop()
+		on := false
+		for {
+			select {
+			case <-stop:
+				daq.setLED(ctx, n, OFF)
+				return
+			case <-ticker.C:
+			}
+			daq.Lock()
+			healthy := daq.failures < heartbeatFailures
+			daq.Unlock()
+			switch {
+			case !healthy:
+				daq.setLED(ctx, n, RED)
+			case on:
+				daq.setLED(ctx, n, OFF)
+			default:
+				daq.setLED(ctx, n, GREEN)
+			}
+			on = !on
+		}
+	}()
+	return nil
+}
+
+// Stop blinking the LED and turn it off
+func (daq *OpenDAQ) StopHeartbeat() {
+	if daq.heartbeat == nil {
+		return
+	}
+	close(daq.heartbeat)
+	<-daq.heartbeatDone
+	daq.heartbeat, daq.heartbeatDone = nil, nil
+}
+
+// Show the state of the library in the LED n:
+// yellow when idle, green while streaming and red when a stream is
+// interrupted by an error. Use 0 to stop updating the LED.
+// Don't use it together with the heartbeat on the same LED.
+func (daq *OpenDAQ) SetStatusLED(n uint) error {
+	if n > daq.NLeds {
+		return ErrInvalidLed
+	}
+	daq.statusLed = n
+	return daq.setStatus(YELLOW)
+}
+
+// Set the color of the status LED, if there's one
+func (daq *OpenDAQ) setStatus(c Color) error {
+	if daq.statusLed == 0 {
+		return nil
+	}
+	return daq.SetLED(daq.statusLed, c)
+}
@@ -0,0 +1,47 @@
+package godaq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Wait until the LED n of the simulator shows the color c
+func waitLED(sim *Simulator, n uint, c Color) bool {
+	for i := 0; i < 200; i++ {
+		if sim.LED(n) == c {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return false
+}
+
+func TestHeartbeat(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelMId)
+	assert.Equal(t, ErrInvalidLed, daq.StartHeartbeat(2, time.Second))
+	assert.Equal(t, ErrInvalidPeriod, daq.StartHeartbeat(1, 0))
+
+	assert.Nil(t, daq.StartHeartbeat(1, 20*time.Millisecond))
+	assert.True(t, waitLED(sim, 1, GREEN))
+	assert.True(t, waitLED(sim, 1, OFF))
+	assert.True(t, waitLED(sim, 1, GREEN))
+	daq.StopHeartbeat()
+	assert.Equal(t, OFF, sim.LED(1))
+
+	// Persistent failures
+	sim.Faults = func(cmd CommandNumber) Fault {
+		if cmd == AIN {
+			return FAULT_TIMEOUT
+		}
+		return NO_FAULT
+	}
+	for i := 0; i < heartbeatFailures; i++ {
+		_, err := daq.ReadADC()
+		assert.NotNil(t, err)
+	}
+	assert.Nil(t, daq.StartHeartbeat(1, 20*time.Millisecond))
+	assert.True(t, waitLED(sim, 1, RED))
+	daq.StopHeartbeat()
+}
@@ -0,0 +1,139 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mobile exposes godaq with the types supported by gomobile bindings,
+// so Android apps can use a device through the USB host API:
+//
+//	gomobile bind -target android github.com/opendaq/godaq/mobile
+//
+// The app implements USBSerial (e.g. with the usb-serial-for-android
+// library) and passes it to Open. The serial port library of godaq isn't
+// used on Android.
+package mobile
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/opendaq/godaq"
+)
+
+// USB-serial port implemented by the app.
+// The port must be configured at 115200 baud.
+type USBSerial interface {
+	// Return the bytes received, waiting up to timeoutMs milliseconds.
+	// An empty slice means that nothing was received.
+	Read(timeoutMs int) ([]byte, error)
+	// Send all the bytes of data
+	Write(data []byte) error
+	Close() error
+}
+
+// Read timeout of the transport, as the serial port used by godaq
+const readTimeout = 100 * time.Millisecond
+
+// Adapt a USBSerial to the io.ReadWriteCloser used by godaq
+type transport struct {
+	port USBSerial
+	buf  bytes.Buffer
+}
+
+func (t *transport) Read(p []byte) (int, error) {
+	if t.buf.Len() == 0 {
+		data, err := t.port.Read(int(readTimeout / time.Millisecond))
+		if err != nil {
+			return 0, err
+		}
+		t.buf.Write(data)
+	}
+	return t.buf.Read(p)
+}
+
+func (t *transport) Write(p []byte) (int, error) {
+	if err := t.port.Write(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Discard the data received
+func (t *transport) Flush() error {
+	t.buf.Reset()
+	return nil
+}
+
+func (t *transport) Close() error {
+	return t.port.Close()
+}
+
+// openDAQ device
+type Device struct {
+	daq *godaq.OpenDAQ
+}
+
+// Use the device connected to port. The device reboots when the port is
+// opened, so wait 1.5 s before calling Open.
+func Open(port USBSerial) (*Device, error) {
+	daq, err := godaq.NewFromTransport(&transport{port: port})
+	if err != nil {
+		return nil, err
+	}
+	return &Device{daq}, nil
+}
+
+// Return the model name of the device
+func (d *Device) Name() string {
+	return d.daq.Name
+}
+
+// Return the serial number of the device
+func (d *Device) Serial() (string, error) {
+	_, _, serial, err := d.daq.GetInfo()
+	return serial, err
+}
+
+func (d *Device) SetLED(n int, color int) error {
+	return d.daq.SetLED(uint(n), godaq.Color(color))
+}
+
+// Set the output n to v volts
+func (d *Device) SetAnalog(n int, v float32) error {
+	return d.daq.SetAnalog(uint(n), v)
+}
+
+// Configure the analog input (see godaq.OpenDAQ.ConfigureADC)
+func (d *Device) ConfigureADC(posInput, negInput, gainId, nSamples int) error {
+	return d.daq.ConfigureADC(uint(posInput), uint(negInput), uint(gainId), uint8(nSamples))
+}
+
+// Read a value in volts from the analog input
+func (d *Device) ReadAnalog() (float32, error) {
+	return d.daq.ReadAnalog()
+}
+
+func (d *Device) SetPIODir(n int, output bool) error {
+	return d.daq.SetPIODir(uint(n), output)
+}
+
+func (d *Device) SetPIO(n int, value bool) error {
+	return d.daq.SetPIO(uint(n), value)
+}
+
+func (d *Device) ReadPIO(n int) (bool, error) {
+	v, err := d.daq.ReadPIO(uint(n))
+	return v != 0, err
+}
+
+func (d *Device) Close() error {
+	return d.daq.Close()
+}
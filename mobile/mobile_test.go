@@ -0,0 +1,51 @@
+package mobile
+
+import (
+	"testing"
+
+	"github.com/opendaq/godaq"
+	"github.com/stretchr/testify/assert"
+)
+
+// USBSerial implemented with the simulator, as an app would do with the
+// USB host API
+type simSerial struct {
+	sim *godaq.Simulator
+}
+
+func (s simSerial) Read(timeoutMs int) ([]byte, error) {
+	buf := make([]byte, 64)
+	n, err := s.sim.Read(buf)
+	return buf[:n], err
+}
+
+func (s simSerial) Write(data []byte) error {
+	_, err := s.sim.Write(data)
+	return err
+}
+
+func (s simSerial) Close() error {
+	return s.sim.Close()
+}
+
+func TestDevice(t *testing.T) {
+	sim, err := godaq.NewSimulator(godaq.ModelMId)
+	assert.Nil(t, err)
+	sim.Inputs = map[uint]godaq.Waveform{2: godaq.Constant(1.5)}
+	dev, err := Open(simSerial{sim})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "OpenDAQ M", dev.Name())
+
+	assert.Nil(t, dev.ConfigureADC(2, 0, 1, 1))
+	v, err := dev.ReadAnalog()
+	assert.Nil(t, err)
+	assert.InDelta(t, 1.5, v, 0.01)
+
+	assert.Nil(t, dev.SetAnalog(1, 1))
+	assert.NotZero(t, sim.DAC(1))
+	assert.Nil(t, dev.SetLED(1, int(godaq.GREEN)))
+	assert.Equal(t, godaq.GREEN, sim.LED(1))
+	assert.Nil(t, dev.Close())
+}
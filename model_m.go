@@ -29,13 +29,15 @@ func NewModelM() *ModelM {
 		Name:       "OpenDAQ M",
 		NLeds:      1,
 		NPIOs:      6,
+		CounterPIO: 5,
 		NInputs:    nInputs,
 		NOutputs:   nOutputs,
 		NCalibRegs: nOutputs + nInputs + uint(len(adcGainsM)),
 
 		Adc: ADC{Bits: 16, Signed: true, VMin: -4.096, VMax: 4.096,
 			Invert: true, Gains: adcGainsM},
-		Dac: DAC{Bits: 16, Signed: true, VMin: -4.096, VMax: 4.096},
+		Dac:    DAC{Bits: 16, Signed: true, VMin: -4.096, VMax: 4.096},
+		Stream: firmwareStreamLimits,
 	}}
 }
 
@@ -81,5 +83,5 @@ func (m *ModelM) CheckValidInputs(pos, neg uint) error {
 }
 
 func init() {
-	registerModel(ModelMId, NewModelM())
+	RegisterModel(ModelMId, NewModelM())
 }
@@ -29,13 +29,15 @@ func NewModelN() *ModelN {
 		Name:       "OpenDAQ N",
 		NLeds:      1,
 		NPIOs:      6,
+		CounterPIO: 5,
 		NInputs:    nInputs,
 		NOutputs:   nOutputs,
 		NCalibRegs: nOutputs + 2*(nInputs+uint(len(adcGainsN))),
 
 		Adc: ADC{Bits: 16, Signed: true, VMin: -12.288, VMax: 12.288, Gains: adcGainsN},
 		// The DAC has 12 bits, but the firmware transforms the values
-		Dac: DAC{Bits: 16, Signed: true, VMin: -4.096, VMax: 4.096},
+		Dac:    DAC{Bits: 16, Signed: true, VMin: -4.096, VMax: 4.096},
+		Stream: firmwareStreamLimits,
 	}}
 }
 
@@ -73,5 +75,5 @@ func (m *ModelN) CheckValidInputs(pos, neg uint) error {
 
 func init() {
 	// Register this model
-	registerModel(ModelNId, NewModelN())
+	RegisterModel(ModelNId, NewModelN())
 }
@@ -0,0 +1,55 @@
+package godaq
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNCalibIndex(t *testing.T) {
+	hw := NewModelN()
+	idx, err := hw.GetCalibIndex(true, false, false, 1, 0)
+	assert.EqualValues(t, 0, idx)
+	assert.Nil(t, err)
+	_, err = hw.GetCalibIndex(true, false, false, 2, 0)
+	assert.Equal(t, ErrInvalidOutput, err)
+
+	// The registers depend on the input only: first stage after the output,
+	// and second stage interleaved after the first stages (9, 11... 23)
+	for i := uint(1); i <= hw.NInputs; i++ {
+		for g := uint(0); g < uint(len(hw.Adc.Gains)); g++ {
+			for _, diff := range []bool{false, true} {
+				idx, err := hw.GetCalibIndex(false, diff, false, i, g)
+				assert.Nil(t, err)
+				assert.Equal(t, i, idx, "input %d, gain %d", i, g)
+
+				idx, err = hw.GetCalibIndex(false, diff, true, i, g)
+				assert.Nil(t, err)
+				assert.Equal(t, 2*i+7, idx, "input %d, gain %d", i, g)
+				assert.True(t, idx < hw.NCalibRegs)
+			}
+		}
+	}
+	_, err = hw.GetCalibIndex(false, false, false, 9, 0)
+	assert.Equal(t, ErrInvalidInput, err)
+}
+
+func TestNValidInputs(t *testing.T) {
+	hw := NewModelN()
+	assert.Equal(t, ErrInvalidInput, hw.CheckValidInputs(0, 0))
+	assert.Equal(t, ErrInvalidInput, hw.CheckValidInputs(9, 0))
+
+	var negInputs []uint
+	for i := uint(0); i < 32; i++ {
+		if err := hw.CheckValidInputs(1, i); err == nil {
+			negInputs = append(negInputs, i)
+		}
+	}
+	assert.Equal(t, []uint{0, 1, 2, 3, 4, 5, 6, 7, 8}, negInputs)
+}
+
+func TestNRegistered(t *testing.T) {
+	hw, ok := GetModel(ModelNId)
+	assert.True(t, ok)
+	assert.Equal(t, "OpenDAQ N", hw.GetFeatures().Name)
+}
@@ -29,13 +29,15 @@ func NewModelS() *ModelS {
 		Name:       "OpenDAQ S",
 		NLeds:      1,
 		NPIOs:      6,
+		CounterPIO: 5,
 		NInputs:    nInputs,
 		NOutputs:   nOutputs,
 		NCalibRegs: nOutputs + 2*nInputs,
 
 		Adc: ADC{Bits: 16, Signed: true, VMin: -12.0, VMax: 12.0, Gains: adcGainsS},
 		// The DAC has 12 bits, but the firmware transforms the values
-		Dac: DAC{Bits: 16, Signed: true, VMin: 0.0, VMax: 4.096},
+		Dac:    DAC{Bits: 16, Signed: true, VMin: 0.0, VMax: 4.096},
+		Stream: firmwareStreamLimits,
 	}}
 }
 
@@ -50,9 +52,12 @@ func (m *ModelS) GetCalibIndex(isOutput, diffMode, secondStage bool, n, gainId u
 		}
 		return n - 1, nil
 	}
-	if n < 1 || n > m.NInputs || secondStage {
+	if n < 1 || n > m.NInputs {
 		return 0, ErrInvalidInput
 	}
+	if secondStage {
+		return 0, ErrNoCalibStage
+	}
 	if diffMode {
 		return m.NOutputs + m.NInputs + n - 1, nil
 	}
@@ -71,5 +76,5 @@ func (m *ModelS) CheckValidInputs(pos, neg uint) error {
 
 func init() {
 	// Register this model
-	registerModel(ModelSId, NewModelS())
+	RegisterModel(ModelSId, NewModelS())
 }
@@ -0,0 +1,30 @@
+package godaq
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSCalibIndex(t *testing.T) {
+	hw := NewModelS()
+	idx, err := hw.GetCalibIndex(true, false, false, 1, 0)
+	assert.EqualValues(t, 0, idx)
+	assert.Nil(t, err)
+
+	for i := uint(1); i <= hw.NInputs; i++ {
+		idx, err := hw.GetCalibIndex(false, false, false, i, 0)
+		assert.EqualValues(t, i, idx)
+		assert.Nil(t, err)
+
+		idx, err = hw.GetCalibIndex(false, true, false, i, 0)
+		assert.EqualValues(t, 8+i, idx)
+		assert.Nil(t, err)
+
+		_, err = hw.GetCalibIndex(false, false, true, i, 0)
+		assert.Equal(t, ErrNoCalibStage, err)
+	}
+
+	_, err = hw.GetCalibIndex(false, false, true, 9, 0)
+	assert.Equal(t, ErrInvalidInput, err)
+}
@@ -14,14 +14,16 @@
 package godaq
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/tarm/serial"
 	try "gopkg.in/matryer/try.v1"
 )
 
@@ -34,31 +36,24 @@ const (
 	YELLOW
 )
 
-const (
-	AIN         = 1
-	AIN_CFG     = 2
-	PIO         = 3
-	AIN_ALL     = 4
-	PIO_DIR     = 5
-	PORT        = 7
-	PORT_DIR    = 9
-	SET_DAC     = 13
-	LED_W       = 18
-	SET_ANALOG  = 24
-	GET_CALIB   = 36
-	ID_CONFIG   = 39
-	GET_AIN_CFG = 40
-)
-
 var (
-	ErrUnknownModel    = errors.New("Unknown device model number")
-	ErrInvalidLed      = errors.New("Invalid LED number")
-	ErrInvalidInput    = errors.New("Invalid input number")
-	ErrInvalidOutput   = errors.New("Invalid output number")
-	ErrInvalidPIO      = errors.New("Invalid PIO number")
-	ErrInvalidGainID   = errors.New("Invalid gain ID")
-	ErrInvalidID       = errors.New("ID out of range")
-	ErrInvalidPIOValue = errors.New("Invalid PIO value")
+	ErrUnknownModel      = errors.New("Unknown device model number")
+	ErrInvalidLed        = errors.New("Invalid LED number")
+	ErrInvalidInput      = errors.New("Invalid input number")
+	ErrInvalidOutput     = errors.New("Invalid output number")
+	ErrInvalidPIO        = errors.New("Invalid PIO number")
+	ErrInvalidGainID     = errors.New("Invalid gain ID")
+	ErrInvalidID         = errors.New("ID out of range")
+	ErrInvalidPIOValue   = errors.New("Invalid PIO value")
+	ErrNotConfigured     = errors.New("Input not configured")
+	ErrNoReference       = errors.New("Ratiometric reference not configured")
+	ErrZeroReference     = errors.New("Ratiometric reference reads zero")
+	ErrNoCalibStage      = errors.New("Calibration stage not available")
+	ErrInvalidCalibIndex = errors.New("Calibration index out of range")
+	ErrPIOUnstable       = errors.New("PIO value not stable")
+	ErrNotSupported      = errors.New("Feature not supported by this model")
+	ErrInvalidModel      = errors.New("Invalid hardware model")
+	ErrModelExists       = errors.New("Hardware model already registered")
 )
 
 type Calib struct {
@@ -71,8 +66,10 @@ type HwFeatures struct {
 	NPIOs, NLeds                      uint
 	NInputs, NOutputs, NHiddenOutputs uint
 	NCalibRegs                        uint
+	CounterPIO                        uint // PIO of the counter (0 if there isn't one)
 	Dac                               DAC
 	Adc                               ADC
+	Stream                            StreamLimits // The ones of the firmware if empty
 }
 
 type HwModel interface {
@@ -81,16 +78,52 @@ type HwModel interface {
 	CheckValidInputs(pos, neg uint) error
 }
 
-var hwModels = make(map[uint8]HwModel)
+// Registered hardware models. It's only written by RegisterModel, usually
+// from init functions, so the devices don't contend for the lock.
+var (
+	hwModels   = make(map[uint8]HwModel)
+	hwModelsMu sync.RWMutex
+)
 
-func registerModel(model uint8, hw HwModel) error {
+// Add support for a hardware model, identified by the model number reported
+// by the device (see GetInfo). Call it from an init function, before
+// opening any device.
+func RegisterModel(model uint8, hw HwModel) error {
+	if hw == nil {
+		return ErrInvalidModel
+	}
+	hwModelsMu.Lock()
+	defer hwModelsMu.Unlock()
 	if _, exists := hwModels[model]; exists {
-		return errors.New("Hardware model already registered!")
+		return ErrModelExists
+	}
+	if err := registerModelCommands(hw); err != nil {
+		return err
 	}
 	hwModels[model] = hw
 	return nil
 }
 
+// Return the numbers of the registered hardware models, in increasing order
+func Models() []uint8 {
+	hwModelsMu.RLock()
+	defer hwModelsMu.RUnlock()
+	list := make([]uint8, 0, len(hwModels))
+	for model := range hwModels {
+		list = append(list, model)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+	return list
+}
+
+// Return the registered hardware model with the given number
+func GetModel(model uint8) (HwModel, bool) {
+	hwModelsMu.RLock()
+	defer hwModelsMu.RUnlock()
+	hw, ok := hwModels[model]
+	return hw, ok
+}
+
 func boolToByte(val bool) byte {
 	if val {
 		return 1
@@ -98,120 +131,489 @@ func boolToByte(val bool) byte {
 	return 0
 }
 
+// Connection to a device. Each device has its own lock and goroutines, so
+// many devices can be used concurrently from the same process.
 type OpenDAQ struct {
-	ser *serial.Port
+	ser io.ReadWriteCloser
 	HwFeatures
 	hw    HwModel
 	calib []Calib
 	sync.Mutex
+	stats Stats
+	// Number of consecutive failed commands
+	failures int
+	// Error of the last command
+	lastErr error
+	// Maximum number of attempts of each command
+	retries int
+
+	// Name of the port or address of the device
+	port string
+	// Model number reported by the device
+	model     uint8
+	info      DeviceInfo
+	skipCalib bool
+	// Open the transport again, nil if it's not possible
+	dial Dialer
+	// Firmware extension (see DeviceExtender)
+	ext interface{}
+	// Commands waiting for the link
+	queue linkQueue
+	// Timestamps of the last command and of the last ReadAnalog
+	timing, readTiming Timing
+
+	heartbeat     chan struct{}
+	heartbeatDone chan struct{}
+	// LED showing the state of the library (0 if none)
+	statusLed uint
+
+	// Stream experiments
+	streams    map[uint]*streamConfig
+	streaming  bool
+	streamQuit chan struct{}
+	quitOnce   *sync.Once // Closes streamQuit
+	streamDone chan struct{}
+	streamErr  error
+
+	// Fail on calibration lookup errors
+	strictCalib bool
+
+	// Guards the state kept by the library about the configuration of the
+	// device (ADC, outputs, PIOs, counter and capture). The calls using or
+	// changing it hold it for reading; Restore and CheckConfig, which may run
+	// in the background, hold it for writing.
+	cfgMu sync.RWMutex
 
 	// Input state (needed for converting ADC values to volts)
 	gainId   uint
 	posInput uint
+	negInput uint
 	diffMode bool
+	nSamples uint8
+	// ConfigureADC has been called
+	adcConfigured bool
+
+	// Number of readings averaged by ReadAnalog
+	hostAveraging int
+
+	// Reference input of the ratiometric mode (0 if disabled)
+	refInput  uint
+	refGainId uint
+
+	// Settling after a mux/gain change
+	settling     Settling
+	unsettled    bool
+	configuredAt time.Time
+
+	// Median filters applied to the readings of each input
+	filters map[uint]*MedianFilter
+	// Zero offsets (in volts) subtracted from the readings of each pair of
+	// inputs (guarded by the lock)
+	tares map[inputPair]float32
+	// Debounce settings of each PIO
+	debounce map[uint]Debounce
+	// Direction of the PIOs (the device can't report it)
+	portDir uint8
+	// Last values written to the PIOs and to the DACs
+	portOut   uint8
+	dacValues map[uint]int
+	// Restore the configuration when WatchConfig detects a reset
+	autoRestore bool
+
+	counterRunning, captureRunning bool
 }
 
-func New(port string) (*OpenDAQ, error) {
-	var err error
-	daq := OpenDAQ{}
-	daq.posInput = 1 // 0 is not a valid default for posInput
+func New(port string, opts ...Option) (*OpenDAQ, error) {
+	return NewContext(context.Background(), port, opts...)
+}
 
-	// Setup and open the serial port
-	serCfg := &serial.Config{Name: port, Baud: 115200, ReadTimeout: time.Millisecond * 100}
-	daq.ser, err = serial.OpenPort(serCfg)
+// Open the device connected to port, like New.
+// The initialization, including the reading of the calibration registers,
+// is aborted when ctx is done.
+func NewContext(ctx context.Context, port string, opts ...Option) (*OpenDAQ, error) {
+	o := newOptions(opts)
+	dial := func(ctx context.Context) (io.ReadWriteCloser, error) {
+		ser, err := openSerial(port, o)
+		if err != nil {
+			return nil, err
+		}
+		// The device reboots when the port is opened
+		if err = probeDevice(ctx, ser, o.bootDelay); err != nil {
+			ser.Close()
+			return nil, err
+		}
+		return ser, nil
+	}
+	ser, err := dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts[:len(opts):len(opts)], WithDialer(dial), withPort(port))
+	daq, err := NewFromTransportContext(ctx, ser, opts...)
 	if err != nil {
+		ser.Close()
 		return nil, err
 	}
-	time.Sleep(1500 * time.Millisecond)
+	return daq, nil
+}
+
+// Use a device connected through any transport (e.g. a TCP serial server).
+// Reads must time out when the device doesn't answer, returning the bytes
+// received so far, as a serial port does. The transport is not closed if an
+// error is returned.
+func NewFromTransport(rw io.ReadWriteCloser, opts ...Option) (*OpenDAQ, error) {
+	return NewFromTransportContext(context.Background(), rw, opts...)
+}
+
+// Use a device connected through any transport, like NewFromTransport.
+// The initialization is aborted when ctx is done.
+func NewFromTransportContext(ctx context.Context, rw io.ReadWriteCloser, opts ...Option) (*OpenDAQ, error) {
+	var err error
+	o := newOptions(opts)
+	daq := OpenDAQ{
+		ser:       rw,
+		retries:   o.retries,
+		skipCalib: o.skipCalib,
+		port:      o.port,
+		dial:      o.dial,
+		filters:   make(map[uint]*MedianFilter),
+		tares:     make(map[inputPair]float32),
+		debounce:  make(map[uint]Debounce),
+		streams:   make(map[uint]*streamConfig),
+		dacValues: make(map[uint]int),
+	}
+	daq.posInput = 1 // 0 is not a valid default for posInput
 
 	// Obtain the device model number
-	model, _, _, err := daq.GetInfo()
+	daq.info, err = daq.readInfo(ctx)
 	if err != nil {
 		return nil, err
 	}
-	hw, ok := hwModels[model]
+	hw, ok := GetModel(daq.info.Model)
 	if !ok {
 		return nil, ErrUnknownModel
 	}
+	daq.model = daq.info.Model
 	daq.hw = hw
 	daq.HwFeatures = hw.GetFeatures()
 
-	// Read the calibration registers from the device
-	daq.calib = make([]Calib, daq.NCalibRegs)
-	for i := range daq.calib {
-		if daq.calib[i], err = daq.readCalib(uint8(i)); err != nil {
-			return nil, err
-		}
+	if err = daq.readCalibs(ctx); err != nil {
+		return nil, err
+	}
+	if err = daq.initOutputs(o); err != nil {
+		return nil, err
+	}
+	if ext, ok := hw.(DeviceExtender); ok {
+		daq.ext = ext.Extension(&daq)
 	}
 	return &daq, nil
 }
 
+// Read the calibration registers from the device
+func (daq *OpenDAQ) readCalibs(ctx context.Context) error {
+	calib := make([]Calib, daq.NCalibRegs)
+	for i := range calib {
+		if daq.skipCalib {
+			calib[i] = Calib{1, 0}
+			continue
+		}
+		var err error
+		if calib[i], err = daq.readCalib(ctx, uint8(i)); err != nil {
+			return err
+		}
+	}
+	daq.Lock()
+	daq.calib = calib
+	daq.Unlock()
+	return nil
+}
+
+// Return a copy of the calibration registers
+func (daq *OpenDAQ) calibs() []Calib {
+	daq.Lock()
+	defer daq.Unlock()
+	return append([]Calib(nil), daq.calib...)
+}
+
+// Implemented by transports that can discard their buffered data
+type flusher interface {
+	Flush() error
+}
+
+// Discard the data pending in the transport, if it's supported
+func (daq *OpenDAQ) flush() {
+	if f, ok := daq.ser.(flusher); ok {
+		f.Flush()
+	}
+}
+
+// Wait for d, or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Interval between the probes of a device while it boots
+const probeInterval = 50 * time.Millisecond
+
+// Wait until the device answers to ID_CONFIG, up to maxWait.
+// A device that is already booted answers the first probe, instead of
+// waiting the whole boot time. The data received is discarded afterwards,
+// as a late response to a previous probe could be pending. Returning after
+// maxWait isn't an error: the initialization retries the commands anyway.
+func probeDevice(ctx context.Context, rw io.ReadWriter, maxWait time.Duration) error {
+	deadline := time.Now().Add(maxWait)
+	f, _ := rw.(flusher)
+	for {
+		var t Timing
+		_, err := sendCommand(rw, &Message{Number: ID_CONFIG}, ID_CONFIG.RespLen(), &t)
+		if err == nil || !time.Now().Before(deadline) {
+			if f != nil {
+				time.Sleep(probeInterval)
+				f.Flush()
+			}
+			return nil
+		}
+		if err := sleepContext(ctx, probeInterval); err != nil {
+			return err
+		}
+		if f != nil {
+			f.Flush()
+		}
+	}
+}
+
 func (daq *OpenDAQ) Close() error {
+	daq.StopHeartbeat()
+	daq.StopStream()
 	return daq.ser.Close()
 }
 
 // Send a comand and returns its response
-func (daq *OpenDAQ) sendCommand(command *Message, respLen int) (r io.Reader, err error) {
+func (daq *OpenDAQ) sendCommand(command *Message, respLen int) (io.Reader, error) {
+	return daq.sendCommandContext(context.Background(), command, respLen)
+}
+
+// Send a command and return its response, giving up the retries when ctx is
+// done. An attempt in progress is not interrupted, but it's bounded by the
+// read timeout of the serial port.
+// The command waits for the link in the queue of its priority (see
+// WithPriority).
+func (daq *OpenDAQ) sendCommandContext(ctx context.Context, command *Message, respLen int) (io.Reader, error) {
+	if err := daq.queue.acquire(ctx); err != nil {
+		return nil, &OpError{command.Number, daq.port, 0, err}
+	}
+	defer daq.queue.release()
+	return daq.transact(ctx, command, respLen)
+}
+
+// Send an output command to the target identified by key. If a newer
+// command to the same target is queued before this one is sent, this one
+// is dropped (sent is false), so fast updates (e.g. from a slider) don't
+// pile up in the queue: only the latest pending value is sent.
+func (daq *OpenDAQ) sendOutput(ctx context.Context, command *Message, key string) (sent bool, err error) {
+	granted, err := daq.queue.acquireKey(ctx, key)
+	if err != nil {
+		return false, &OpError{command.Number, daq.port, 0, err}
+	}
+	if !granted {
+		return false, nil
+	}
+	defer daq.queue.release()
+	_, err = daq.transact(ctx, command, command.Number.RespLen())
+	return err == nil, err
+}
+
+// Send a command holding the link
+func (daq *OpenDAQ) transact(ctx context.Context, command *Message, respLen int) (r io.Reader, err error) {
 	daq.Lock()
 	defer daq.Unlock()
-	// Retry the command up to 8 times
+	if daq.streaming {
+		return nil, &OpError{command.Number, daq.port, 0, ErrStreaming}
+	}
+	// Retry the command up to daq.retries times
+	attempts := 0
 	err = try.Do(func(attempt int) (bool, error) {
+		attempts = attempt
+		if e := ctx.Err(); e != nil {
+			return false, e
+		}
 		var e error
-		r, e = sendCommand(daq.ser, command, respLen)
+		var t Timing
+		r, e = sendCommand(daq.ser, command, respLen, &t)
 		if e != nil {
-			daq.ser.Flush()
+			daq.flush()
+		} else {
+			daq.timing = t
+		}
+		if attempt > 1 {
+			daq.stats.Retries++
 		}
-		return attempt < 8, e
+		return attempt < daq.retries, e
 	})
+	daq.stats.Commands++
+	daq.lastErr = err
+	if err != nil {
+		daq.stats.Errors++
+		daq.failures++
+		err = &OpError{command.Number, daq.port, attempts, err}
+	} else {
+		daq.failures = 0
+	}
 	return
 }
 
+// Return the transport timestamps of the last successful command
+func (daq *OpenDAQ) LastTiming() Timing {
+	daq.Lock()
+	defer daq.Unlock()
+	return daq.timing
+}
+
+// Communication counters
+type Stats struct {
+	Commands uint64 // Commands sent
+	Retries  uint64 // Commands sent again after a failed attempt
+	Errors   uint64 // Commands that failed after all the attempts
+
+	QueueDepth    int     // Commands waiting for the link now
+	MaxQueueDepth int     // Highest number of commands waiting for the link
+	Busy          float64 // Fraction of the time the link is busy, averaged over the last second
+	Coalesced     uint64  // Output commands superseded by a newer one before being sent
+}
+
+func (daq *OpenDAQ) Stats() Stats {
+	daq.Lock()
+	st := daq.stats
+	daq.Unlock()
+	daq.queue.addStats(&st)
+	return st
+}
+
 // Return the calibration values for a given input or output.
 // The gain ID and the input mode (single-ended or differential) are needed.
 // Different device models use different calibration schemas.
+// The identity calibration is returned if there are no matching values,
+// use GetCalibChecked to detect it.
 func (daq *OpenDAQ) GetCalib(isOutput, diffMode, secondStage bool, n, gainId uint) Calib {
+	cal, _ := daq.GetCalibChecked(isOutput, diffMode, secondStage, n, gainId)
+	return cal
+}
+
+// Return the calibration values for a given input or output, or the identity
+// calibration and an error if there are no matching values.
+func (daq *OpenDAQ) GetCalibChecked(isOutput, diffMode, secondStage bool, n, gainId uint) (Calib, error) {
 	idx, err := daq.hw.GetCalibIndex(isOutput, diffMode, secondStage, n, gainId)
 	if err != nil {
-		return Calib{1, 0}
+		return Calib{1, 0}, err
 	}
-	return daq.calib[idx]
+	daq.Lock()
+	defer daq.Unlock()
+	if idx >= uint(len(daq.calib)) {
+		return Calib{1, 0}, ErrInvalidCalibIndex
+	}
+	return daq.calib[idx], nil
+}
+
+// Make the conversions between volts and raw values fail if the calibration
+// values can't be found, instead of silently using the identity calibration.
+func (daq *OpenDAQ) SetStrictCalib(strict bool) {
+	daq.strictCalib = strict
 }
 
 // Convert a voltage to a DAC value given the number of the output
-func (daq *OpenDAQ) voltsToDac(v float32, n uint) int {
+func (daq *OpenDAQ) voltsToDac(v float32, n uint) (int, error) {
 	// TODO: add caching?
-	cal := daq.GetCalib(true, false, false, n, 0)
-	return daq.Dac.FromVolts(v, cal)
+	cal, err := daq.GetCalibChecked(true, false, false, n, 0)
+	if err != nil && daq.strictCalib {
+		return 0, err
+	}
+	return daq.Dac.FromVolts(v, cal), nil
 }
 
-// Convert an ADC value to volts
-func (daq *OpenDAQ) adcToVolts(raw int) float32 {
+// Convert an ADC value to volts, using the current input configuration
+func (daq *OpenDAQ) adcToVolts(raw int) (float32, error) {
+	return daq.rawToVolts(raw, daq.posInput, daq.diffMode, daq.gainId)
+}
+
+// Convert an ADC value read from the given input configuration to volts
+func (daq *OpenDAQ) rawToVolts(raw int, posInput uint, diffMode bool, gainId uint) (float32, error) {
 	// TODO: add caching?
-	cal1 := daq.GetCalib(false, daq.diffMode, false, daq.posInput, daq.gainId)
-	cal2 := daq.GetCalib(false, daq.diffMode, true, daq.posInput, daq.gainId)
-	return daq.Adc.ToVolts(raw, daq.gainId, cal1, cal2)
+	cal1, err := daq.GetCalibChecked(false, diffMode, false, posInput, gainId)
+	if err != nil && daq.strictCalib {
+		return 0, err
+	}
+	// Not all the models have a second calibration stage
+	cal2, err := daq.GetCalibChecked(false, diffMode, true, posInput, gainId)
+	if err != nil && err != ErrNoCalibStage && daq.strictCalib {
+		return 0, err
+	}
+	return daq.Adc.ToVolts(raw, gainId, cal1, cal2), nil
+}
+
+// Identification of a device
+type DeviceInfo struct {
+	Model        uint8  // Model number (e.g. ModelMId)
+	ModelName    string // e.g. "OpenDAQ M"
+	HWVersion    string // Hardware version, e.g. "M"
+	FWVersion    uint8  // Firmware version
+	Serial       string // Serial number, zero-padded to 4 digits at least
+	SerialNumber uint32 // Serial number as reported by the device
+	HwFeatures          // Features of the model (empty if it isn't registered)
 }
 
+// Read the model number, firmware version and serial number of the device.
+// Unlike GetDeviceInfo it always queries the device.
 func (daq *OpenDAQ) GetInfo() (model, version uint8, serial string, err error) {
-	var buf io.Reader
-	buf, err = daq.sendCommand(&Message{Number: ID_CONFIG}, 6)
+	return daq.getInfo(context.Background())
+}
+
+func (daq *OpenDAQ) getInfo(ctx context.Context) (model, version uint8, serial string, err error) {
+	info, err := daq.readInfo(ctx)
+	return info.Model, info.FWVersion, info.Serial, err
+}
+
+func (daq *OpenDAQ) readInfo(ctx context.Context) (DeviceInfo, error) {
+	buf, err := daq.sendCommandContext(ctx, &Message{Number: ID_CONFIG}, ID_CONFIG.RespLen())
 	if err != nil {
-		return
+		return DeviceInfo{}, err
 	}
-	var info = struct {
+	var raw = struct {
 		Model, Version uint8
 		Serial         uint32
 	}{}
-	binary.Read(buf, binary.BigEndian, &info)
-	model = info.Model
-	version = info.Version
-	serial = fmt.Sprintf("%04d", info.Serial)
-	return
+	binary.Read(buf, binary.BigEndian, &raw)
+	info := DeviceInfo{
+		Model:        raw.Model,
+		FWVersion:    raw.Version,
+		Serial:       fmt.Sprintf("%04d", raw.Serial),
+		SerialNumber: raw.Serial,
+	}
+	if hw, ok := GetModel(raw.Model); ok {
+		info.HwFeatures = hw.GetFeatures()
+		info.ModelName = info.Name
+		info.HWVersion = strings.TrimPrefix(info.Name, "OpenDAQ ")
+	}
+	return info, nil
+}
+
+// Return the identification of the device. It's read when the device is
+// opened (and again when it's reconnected), so it doesn't send any command.
+func (daq *OpenDAQ) GetDeviceInfo() DeviceInfo {
+	daq.Lock()
+	defer daq.Unlock()
+	return daq.info
 }
 
 // Read the calibration register stored at index nReg
-func (daq *OpenDAQ) readCalib(nReg uint8) (Calib, error) {
-	buf, err := daq.sendCommand(&Message{GET_CALIB, []byte{nReg}}, 5)
+func (daq *OpenDAQ) readCalib(ctx context.Context, nReg uint8) (Calib, error) {
+	buf, err := daq.sendCommandContext(ctx, &Message{GET_CALIB, []byte{nReg}}, GET_CALIB.RespLen())
 	if err != nil {
 		return Calib{1, 0}, err
 	}
@@ -221,21 +623,21 @@ func (daq *OpenDAQ) readCalib(nReg uint8) (Calib, error) {
 		Offs int16
 	}{}
 	binary.Read(buf, binary.BigEndian, &ret)
-	//TODO: refactor this
-	if uint(nReg) < daq.NOutputs+daq.NHiddenOutputs {
-		return Calib{1. + float32(ret.Gain)/(1<<16), float32(ret.Offs) / (1 << 16)}, nil
-	}
-	return Calib{1. + float32(ret.Gain)/(1<<16), float32(ret.Offs) / (1 << 5)}, nil
+	return daq.decodeCalib(uint(nReg), ret.Gain, ret.Offs), nil
 }
 
 func (daq *OpenDAQ) SetLED(n uint, c Color) error {
+	return daq.setLED(context.Background(), n, c)
+}
+
+func (daq *OpenDAQ) setLED(ctx context.Context, n uint, c Color) error {
 	if n < 1 || n > daq.NLeds {
 		return ErrInvalidLed
 	}
 	if c > 3 {
 		return errors.New("Invalid LED color")
 	}
-	_, err := daq.sendCommand(&Message{LED_W, []byte{byte(c), byte(n)}}, 2)
+	_, err := daq.sendCommandContext(ctx, &Message{LED_W, []byte{byte(c), byte(n)}}, LED_W.RespLen())
 	return err
 }
 
@@ -246,20 +648,91 @@ func (daq *OpenDAQ) ConfigureADC(posInput, negInput, gainId uint, nSamples uint8
 	if gainId >= uint(len(daq.Adc.Gains)) {
 		return ErrInvalidGainID
 	}
+	daq.cfgMu.Lock()
+	defer daq.cfgMu.Unlock()
+	changed := posInput != daq.posInput || negInput != daq.negInput || gainId != daq.gainId
 	daq.posInput = posInput
+	daq.negInput = negInput
+	daq.nSamples = nSamples
 	daq.gainId = gainId
 	daq.diffMode = false
 	if negInput != 0 {
 		daq.diffMode = true
 	}
 	_, err := daq.sendCommand(&Message{AIN_CFG, []byte{byte(posInput), byte(negInput),
-		byte(gainId), nSamples}}, 6)
+		byte(gainId), nSamples}}, AIN_CFG.RespLen())
+	// The settling delay starts once the input is switched
+	if changed {
+		daq.setUnsettled()
+	}
+	if err == nil {
+		daq.adcConfigured = true
+	}
 	return err
 }
 
+// Configure how the readings are settled after changing the input or the gain.
+// The first reading after a mux/gain change is often invalid.
+type Settling struct {
+	Discard int           // Number of readings discarded after a change
+	Delay   time.Duration // Minimum time between the change and the first reading
+}
+
+func (daq *OpenDAQ) SetSettling(s Settling) {
+	daq.cfgMu.Lock()
+	daq.settling = s
+	daq.cfgMu.Unlock()
+}
+
+// Mark the ADC as changed, the next reading must be settled
+func (daq *OpenDAQ) setUnsettled() {
+	daq.Lock()
+	daq.unsettled, daq.configuredAt = true, time.Now()
+	daq.Unlock()
+}
+
+// Wait and discard readings until the ADC is settled after a change.
+// cfgMu must be held.
+func (daq *OpenDAQ) settle(ctx context.Context) error {
+	daq.Lock()
+	unsettled, configuredAt := daq.unsettled, daq.configuredAt
+	daq.Unlock()
+	if !unsettled {
+		return nil
+	}
+	if wait := daq.settling.Delay - time.Since(configuredAt); wait > 0 {
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < daq.settling.Discard; i++ {
+		if _, err := daq.readADC(ctx); err != nil {
+			return err
+		}
+	}
+	daq.Lock()
+	daq.unsettled = false
+	daq.Unlock()
+	return nil
+}
+
 // Read a raw value from the ADC
 func (daq *OpenDAQ) ReadADC() (int16, error) {
-	buf, err := daq.sendCommand(&Message{Number: AIN}, 2)
+	return daq.ReadADCContext(context.Background())
+}
+
+// Read a raw value from the ADC, giving up when ctx is done
+func (daq *OpenDAQ) ReadADCContext(ctx context.Context) (int16, error) {
+	daq.cfgMu.RLock()
+	defer daq.cfgMu.RUnlock()
+	if err := daq.settle(ctx); err != nil {
+		return 0, err
+	}
+	return daq.readADC(ctx)
+}
+
+func (daq *OpenDAQ) readADC(ctx context.Context) (int16, error) {
+	buf, err := daq.sendCommandContext(ctx, &Message{Number: AIN}, AIN.RespLen())
 	if err != nil {
 		return 0, err
 	}
@@ -268,37 +741,261 @@ func (daq *OpenDAQ) ReadADC() (int16, error) {
 	return val, nil
 }
 
-// Read a value in volts from the ADC
+// Read a value in volts from the ADC.
+// The value is averaged by the host if SetHostAveraging was used.
 func (daq *OpenDAQ) ReadAnalog() (float32, error) {
-	val, err := daq.ReadADC()
+	return daq.ReadAnalogContext(context.Background())
+}
+
+// Read a value in volts from the ADC, like ReadAnalog, giving up when ctx is
+// done (e.g. in the middle of a long host averaging)
+func (daq *OpenDAQ) ReadAnalogContext(ctx context.Context) (float32, error) {
+	daq.cfgMu.RLock()
+	defer daq.cfgMu.RUnlock()
+	n := daq.hostAveraging
+	if n < 1 {
+		n = 1
+	}
+	sum := 0
+	var timing Timing
+	for i := 0; i < n; i++ {
+		if err := daq.settle(ctx); err != nil {
+			return 0, err
+		}
+		val, err := daq.readADC(ctx)
+		if err != nil {
+			return 0, err
+		}
+		sum += int(val)
+		if i == 0 {
+			timing.Sent = daq.LastTiming().Sent
+		}
+	}
+	timing.Received = daq.LastTiming().Received
+	daq.Lock()
+	daq.readTiming = timing
+	daq.Unlock()
+	v, err := daq.adcToVolts(roundInt(float32(sum) / float32(n)))
 	if err != nil {
 		return 0, err
 	}
-	return daq.adcToVolts(int(val)), nil
+	return daq.filter(daq.posInput, v) - daq.GetTare(daq.posInput, daq.negInput), nil
+}
+
+// Apply the median filter of the input, if any.
+// cfgMu must be held.
+func (daq *OpenDAQ) filter(input uint, v float32) float32 {
+	f, ok := daq.filters[input]
+	if !ok {
+		return v
+	}
+	daq.Lock()
+	defer daq.Unlock()
+	return f.Filter(v)
 }
 
-// Set the raw value of the DAC at output n
+// Timestamps of the last ReadAnalog
+func (daq *OpenDAQ) lastReadTiming() Timing {
+	daq.Lock()
+	defer daq.Unlock()
+	return daq.readTiming
+}
+
+// Positive and negative inputs of a reading
+type inputPair struct {
+	pos, neg uint
+}
+
+// Measure the mean value of input n during d and store it as its zero offset,
+// which is subtracted from the subsequent readings of that input with the
+// same negative input. The input must have been selected with ConfigureADC
+// beforehand. The offsets are saved with SaveCalibration.
+func (daq *OpenDAQ) Tare(n uint, d time.Duration) (float32, error) {
+	if n != daq.posInput {
+		return 0, ErrNotConfigured
+	}
+	var sum float32
+	var count int
+	for start := time.Now(); count == 0 || time.Since(start) < d; count++ {
+		val, err := daq.ReadADC()
+		if err != nil {
+			return 0, err
+		}
+		v, err := daq.adcToVolts(int(val))
+		if err != nil {
+			return 0, err
+		}
+		sum += v
+	}
+	offset := sum / float32(count)
+	daq.Lock()
+	daq.tares[inputPair{n, daq.negInput}] = offset
+	daq.Unlock()
+	return offset, nil
+}
+
+// Set the zero offset of the readings of input pos against neg (0 for
+// single-ended readings), e.g. to restore a previous Tare.
+// An offset of 0 removes the tare.
+func (daq *OpenDAQ) SetTare(pos, neg uint, offset float32) error {
+	if err := daq.hw.CheckValidInputs(pos, neg); err != nil {
+		return err
+	}
+	daq.Lock()
+	defer daq.Unlock()
+	if offset == 0 {
+		delete(daq.tares, inputPair{pos, neg})
+		return nil
+	}
+	daq.tares[inputPair{pos, neg}] = offset
+	return nil
+}
+
+// Return the zero offset of the readings of input pos against neg
+func (daq *OpenDAQ) GetTare(pos, neg uint) float32 {
+	daq.Lock()
+	defer daq.Unlock()
+	return daq.tares[inputPair{pos, neg}]
+}
+
+// Apply a moving median of n samples to the values read from input posInput.
+// A value of n lower than 2 disables the filter.
+func (daq *OpenDAQ) SetMedianFilter(posInput uint, n int) error {
+	if posInput < 1 || posInput > daq.NInputs {
+		return ErrInvalidInput
+	}
+	daq.cfgMu.Lock()
+	defer daq.cfgMu.Unlock()
+	if n < 2 {
+		delete(daq.filters, posInput)
+		return nil
+	}
+	daq.filters[posInput] = NewMedianFilter(n)
+	return nil
+}
+
+// Enable the ratiometric mode, using input n (read with the given gain) as the
+// excitation reference. An input of 0 disables it.
+func (daq *OpenDAQ) SetRatiometric(n, gainId uint) error {
+	if n != 0 {
+		if err := daq.hw.CheckValidInputs(n, 0); err != nil {
+			return err
+		}
+		if gainId >= uint(len(daq.Adc.Gains)) {
+			return ErrInvalidGainID
+		}
+	}
+	daq.cfgMu.Lock()
+	defer daq.cfgMu.Unlock()
+	daq.refInput = n
+	daq.refGainId = gainId
+	return nil
+}
+
+// Read the configured input and return its value divided by the value
+// of the reference input, which is measured right after it.
+// This corrects the supply drift of potentiometers and bridges.
+func (daq *OpenDAQ) ReadRatio() (float32, error) {
+	daq.cfgMu.RLock()
+	refInput, refGainId := daq.refInput, daq.refGainId
+	daq.cfgMu.RUnlock()
+	if refInput == 0 {
+		return 0, ErrNoReference
+	}
+	v, err := daq.ReadAnalog()
+	if err != nil {
+		return 0, err
+	}
+
+	// ConfigureADC takes the lock for writing
+	daq.cfgMu.RLock()
+	pos, neg, gainId, nSamples := daq.posInput, daq.negInput, daq.gainId, daq.nSamples
+	daq.cfgMu.RUnlock()
+	if err := daq.ConfigureADC(refInput, 0, refGainId, nSamples); err != nil {
+		return 0, err
+	}
+	ref, err := daq.ReadAnalog()
+	// Restore the previous configuration
+	if err := daq.ConfigureADC(pos, neg, gainId, nSamples); err != nil {
+		return 0, err
+	}
+	if err != nil {
+		return 0, err
+	}
+	if ref == 0 {
+		return 0, ErrZeroReference
+	}
+	return v / ref, nil
+}
+
+// Set the raw value of the DAC at output n.
+// A *RangeError is returned if the value doesn't fit in the DAC.
 func (daq *OpenDAQ) SetDAC(n uint, val int) error {
+	daq.cfgMu.RLock()
+	defer daq.cfgMu.RUnlock()
+	return daq.setDAC(n, val)
+}
+
+func (daq *OpenDAQ) setDAC(n uint, val int) error {
 	if n < 1 || n > (daq.NOutputs+daq.NHiddenOutputs) {
 		return ErrInvalidOutput
 	}
+	if err := daq.Dac.CheckValue(val); err != nil {
+		return err
+	}
 	out := toBytes(int16(val))
 	out = append(out, byte(n))
-	_, err := daq.sendCommand(&Message{SET_DAC, out}, 3)
+	sent, err := daq.sendOutput(context.Background(), &Message{SET_DAC, out}, fmt.Sprint("DAC", n))
+	if sent {
+		daq.Lock()
+		daq.dacValues[n] = val
+		daq.Unlock()
+	}
 	return err
 }
 
-// Set the voltage at output n
+// Set the voltage at output n.
+// A *RangeError is returned if the model can't output that voltage.
+// Concurrent updates of the same output are coalesced: a value still waiting
+// for the link when a newer one arrives is dropped.
 func (daq *OpenDAQ) SetAnalog(n uint, val float32) error {
-	return daq.SetDAC(n, daq.voltsToDac(val, n))
+	if err := daq.Dac.CheckRange(val); err != nil {
+		return err
+	}
+	daq.cfgMu.RLock()
+	defer daq.cfgMu.RUnlock()
+	raw, err := daq.voltsToDac(val, n)
+	if err != nil {
+		return err
+	}
+	return daq.setDAC(n, raw)
+}
+
+// Set output n to a percentage of the full scale of the DAC
+// (0% is the minimum output voltage and 100% the maximum)
+func (daq *OpenDAQ) SetOutputPercent(n uint, pct float32) error {
+	v, err := daq.Dac.PercentToVolts(pct)
+	if err != nil {
+		return err
+	}
+	return daq.SetAnalog(n, v)
 }
 
+// Set the level of PIO n. Like with SetAnalog, concurrent updates of the
+// same PIO are coalesced.
 func (daq *OpenDAQ) SetPIO(n uint, value bool) error {
 	if n < 1 || n > daq.NPIOs {
 		return ErrInvalidPIO
 	}
 	val := boolToByte(value)
-	_, err := daq.sendCommand(&Message{PIO, []byte{byte(n), val}}, 2)
+	daq.cfgMu.RLock()
+	defer daq.cfgMu.RUnlock()
+	sent, err := daq.sendOutput(context.Background(), &Message{PIO, []byte{byte(n), val}}, fmt.Sprint("PIO", n))
+	if sent {
+		daq.Lock()
+		daq.portOut = daq.portOut&^(1<<(n-1)) | val<<(n-1)
+		daq.Unlock()
+	}
 	return err
 }
 
@@ -307,7 +1004,14 @@ func (daq *OpenDAQ) SetPIODir(n uint, out bool) error {
 		return ErrInvalidPIO
 	}
 	dir := boolToByte(out)
-	_, err := daq.sendCommand(&Message{PIO_DIR, []byte{byte(n), dir}}, 2)
+	daq.cfgMu.RLock()
+	defer daq.cfgMu.RUnlock()
+	_, err := daq.sendCommand(&Message{PIO_DIR, []byte{byte(n), dir}}, PIO_DIR.RespLen())
+	if err == nil {
+		daq.Lock()
+		daq.portDir = daq.portDir&^(1<<(n-1)) | dir<<(n-1)
+		daq.Unlock()
+	}
 	return err
 }
 
@@ -315,41 +1019,138 @@ func (daq *OpenDAQ) ReadPIO(n uint) (uint8, error) {
 	if n < 1 || n > daq.NPIOs {
 		return 0, ErrInvalidPIO
 	}
-	buf, err := daq.sendCommand(&Message{PIO, []byte{byte(n)}}, 2)
+	daq.cfgMu.RLock()
+	d, ok := daq.debounce[n]
+	daq.cfgMu.RUnlock()
+	if ok {
+		return d.read(func() (uint8, error) { return daq.readPIO(n) }, 0xff)
+	}
+	return daq.readPIO(n)
+}
+
+func (daq *OpenDAQ) readPIO(n uint) (uint8, error) {
+	buf, err := daq.sendCommand(&Message{PIO, []byte{byte(n)}}, PIO.RespLen())
+	if err != nil {
+		return 0, err
+	}
 	var ret = struct {
 		N_PIO uint8
 		Read  uint8
 	}{}
 	binary.Read(buf, binary.BigEndian, &ret)
-	return ret.Read, err
+	return ret.Read, nil
 }
 
 // Configure all PIO direction.
 func (daq *OpenDAQ) SetPortDir(dir_port uint8) error {
+	daq.cfgMu.RLock()
+	defer daq.cfgMu.RUnlock()
+	return daq.setPortDir(dir_port)
+}
+
+func (daq *OpenDAQ) setPortDir(dir_port uint8) error {
 	if dir_port < 0 || dir_port >= (1<<daq.NPIOs) {
 		return ErrInvalidPIOValue
 	} else {
-		_, err := daq.sendCommand(&Message{PORT_DIR, []byte{byte(dir_port)}}, 1)
+		_, err := daq.sendCommand(&Message{PORT_DIR, []byte{byte(dir_port)}}, PORT_DIR.RespLen())
+		if err == nil {
+			daq.Lock()
+			daq.portDir = dir_port
+			daq.Unlock()
+		}
 		return err
 	}
 }
 
-// ead all PIO values.
+// Read all PIO values.
+// The pins with debounce settings are debounced using the strictest ones.
 func (daq *OpenDAQ) ReadPort() (uint8, error) {
+	var mask uint8
+	var d Debounce
+	unlimited := false
+	daq.cfgMu.RLock()
+	for n, pin := range daq.debounce {
+		mask |= 1 << (n - 1)
+		if pin.Count > d.Count {
+			d.Count = pin.Count
+		}
+		if pin.Timeout > d.Timeout {
+			d.Timeout = pin.Timeout
+		}
+		unlimited = unlimited || pin.Timeout == 0
+	}
+	daq.cfgMu.RUnlock()
+	if unlimited {
+		d.Timeout = 0
+	}
+	if mask != 0 {
+		return d.read(daq.readPort, mask)
+	}
+	return daq.readPort()
+}
+
+func (daq *OpenDAQ) readPort() (uint8, error) {
 	var read_value uint8
-	buf, err := daq.sendCommand(&Message{Number: PORT}, 1)
+	buf, err := daq.sendCommand(&Message{Number: PORT}, PORT.RespLen())
+	if err != nil {
+		return 0, err
+	}
 	binary.Read(buf, binary.BigEndian, &read_value)
-	return read_value, err
+	return read_value, nil
 }
 
 // Write all PIO values.
 func (daq *OpenDAQ) SetPort(value_port uint8) error {
+	daq.cfgMu.RLock()
+	defer daq.cfgMu.RUnlock()
+	return daq.setPort(value_port)
+}
+
+func (daq *OpenDAQ) setPort(value_port uint8) error {
 	if value_port < 0 || value_port >= (1<<daq.NPIOs) {
 		return ErrInvalidPIOValue
 	} else {
-		_, err := daq.sendCommand(&Message{PORT, []byte{byte(value_port)}}, 1)
+		_, err := daq.sendCommand(&Message{PORT, []byte{byte(value_port)}}, PORT.RespLen())
+		if err == nil {
+			daq.Lock()
+			daq.portOut = value_port
+			daq.Unlock()
+		}
+		return err
+	}
+}
+
+// Direction and value of all the PIOs, one bit per PIO (PIO n is bit n-1)
+type PortState struct {
+	Dir   uint8 // 1 for outputs, 0 for inputs
+	Value uint8
+}
+
+// Read the direction and the value of all the PIOs.
+// Only the value is read from the device: the firmware can't report the
+// direction, so the software shadow of the last direction set through this
+// handle is returned (all inputs after connecting). It doesn't reflect a
+// reset of the device (see CheckConfig).
+func (daq *OpenDAQ) ReadPortState() (PortState, error) {
+	value, err := daq.ReadPort()
+	daq.Lock()
+	defer daq.Unlock()
+	return PortState{daq.portDir, value}, err
+}
+
+// Set the direction and the value of all the PIOs.
+// The values are written first, so outputs don't glitch when enabled.
+func (daq *OpenDAQ) SetPortState(st PortState) error {
+	daq.cfgMu.RLock()
+	defer daq.cfgMu.RUnlock()
+	return daq.setPortState(st)
+}
+
+func (daq *OpenDAQ) setPortState(st PortState) error {
+	if err := daq.setPort(st.Value); err != nil {
 		return err
 	}
+	return daq.setPortDir(st.Dir)
 }
 
 func (daq *OpenDAQ) SetId(id uint32) (uint16, error) {
@@ -362,7 +1163,7 @@ func (daq *OpenDAQ) SetId(id uint32) (uint16, error) {
 		RESP uint16
 	}{}
 	out := toBytes(int32(id))
-	buf, err := daq.sendCommand(&Message{ID_CONFIG, out}, 6)
+	buf, err := daq.sendCommand(&Message{ID_CONFIG, out}, ID_CONFIG.RespLen())
 	binary.Read(buf, binary.BigEndian, &ret)
 	return ret.RESP, err
 }
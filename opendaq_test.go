@@ -0,0 +1,387 @@
+package godaq
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Transport recording the commands sent
+type recorder struct {
+	io.ReadWriteCloser
+	cmds   []CommandNumber
+	frames [][]byte
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.cmds = append(r.cmds, CommandNumber(p[2]))
+	r.frames = append(r.frames, append([]byte(nil), p...))
+	return r.ReadWriteCloser.Write(p)
+}
+
+// Open a simulated device
+func newSimDAQ(t testing.TB, model uint8, opts ...Option) (*OpenDAQ, *Simulator) {
+	sim, err := NewSimulator(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	daq, err := NewFromTransport(sim, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return daq, sim
+}
+
+func TestNewFromTransport(t *testing.T) {
+	sim, _ := NewSimulator(ModelMId)
+	sim.Inputs = map[uint]Waveform{1: Constant(1.5)}
+	daq, err := NewFromTransport(sim)
+	assert.Nil(t, err)
+	assert.Equal(t, "OpenDAQ M", daq.Name)
+	assert.Len(t, daq.calib, int(daq.NCalibRegs))
+
+	assert.Nil(t, daq.ConfigureADC(1, 0, 1, 1))
+	v, err := daq.ReadAnalog()
+	assert.Nil(t, err)
+	assert.InDelta(t, 1.5, v, 0.001)
+
+	assert.Nil(t, daq.Close())
+	_, err = sim.Write([]byte{0})
+	assert.NotNil(t, err)
+
+	sim, _ = NewSimulator(ModelMId)
+	sim.Model = 99
+	_, err = NewFromTransport(sim)
+	assert.Equal(t, ErrUnknownModel, err)
+}
+
+func TestGetDeviceInfo(t *testing.T) {
+	sim, _ := NewSimulator(ModelSId)
+	sim.Version, sim.Serial = 3, 123456
+	daq, err := NewFromTransport(sim)
+	assert.Nil(t, err)
+
+	commands := daq.Stats().Commands
+	info := daq.GetDeviceInfo()
+	assert.EqualValues(t, ModelSId, info.Model)
+	assert.Equal(t, "OpenDAQ S", info.ModelName)
+	assert.Equal(t, "S", info.HWVersion)
+	assert.EqualValues(t, 3, info.FWVersion)
+	assert.Equal(t, "123456", info.Serial)
+	assert.EqualValues(t, 123456, info.SerialNumber)
+	assert.Equal(t, daq.HwFeatures, info.HwFeatures)
+	// The information is cached
+	assert.Equal(t, info, daq.GetDeviceInfo())
+	assert.Equal(t, commands, daq.Stats().Commands)
+
+	model, version, serial, err := daq.GetInfo()
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{info.Model, info.FWVersion, info.Serial},
+		[]interface{}{model, version, serial})
+}
+
+func TestStatusLED(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelSId)
+
+	assert.Equal(t, ErrInvalidLed, daq.SetStatusLED(2))
+	assert.Nil(t, daq.SetStatusLED(1))
+	assert.Equal(t, YELLOW, sim.LED(1))
+	assert.Nil(t, daq.setStatus(GREEN))
+	assert.Equal(t, GREEN, sim.LED(1))
+	assert.Nil(t, daq.SetStatusLED(0))
+	assert.Nil(t, daq.setStatus(RED))
+	assert.Equal(t, GREEN, sim.LED(1))
+}
+
+func TestStartupOutputs(t *testing.T) {
+	sim, _ := NewSimulator(ModelMId)
+	rec := &recorder{ReadWriteCloser: sim}
+
+	// The outputs are not touched by default
+	_, err := NewFromTransport(rec)
+	assert.Nil(t, err)
+	assert.NotContains(t, rec.cmds, SET_DAC)
+	assert.NotContains(t, rec.cmds, PORT_DIR)
+
+	rec.cmds = nil
+	_, err = NewFromTransport(rec, WithZeroOutputs())
+	assert.Nil(t, err)
+	assert.Contains(t, rec.cmds, SET_DAC)
+	assert.Contains(t, rec.cmds, PORT_DIR)
+
+	rec.cmds = nil
+	_, err = NewFromTransport(rec, WithOutputDefaults(OutputDefaults{
+		Analog: map[uint]float32{1: 1.5},
+		Port:   &PortState{Dir: 0x03, Value: 0x01}}))
+	assert.Nil(t, err)
+	assert.NotZero(t, sim.DAC(1))
+	assert.Equal(t, PortState{0x03, 0x01}, sim.Port())
+}
+
+func TestOptions(t *testing.T) {
+	sim, _ := NewSimulator(ModelMId)
+	sim.Calib = []SimCalib{{100, 10}}
+	rec := &recorder{ReadWriteCloser: sim}
+	daq, err := NewFromTransport(rec, WithSkipCalibration(), WithRetries(2))
+	assert.Nil(t, err)
+	assert.NotContains(t, rec.cmds, GET_CALIB)
+	assert.Equal(t, Calib{1, 0}, daq.calib[0])
+
+	sim.Faults = func(CommandNumber) Fault { return FAULT_NAK }
+	_, err = daq.ReadADC()
+	assert.Equal(t, &OpError{AIN, "", 2, ErrNakReceived}, err)
+	assert.EqualValues(t, 1, daq.Stats().Retries)
+}
+
+func TestProbeDevice(t *testing.T) {
+	sim, _ := NewSimulator(ModelMId)
+	// The device is booting during the first probes
+	probes := 0
+	sim.Faults = func(CommandNumber) Fault {
+		probes++
+		if probes <= 3 {
+			return FAULT_TIMEOUT
+		}
+		return NO_FAULT
+	}
+	start := time.Now()
+	assert.Nil(t, probeDevice(context.Background(), sim, 5*time.Second))
+	assert.Equal(t, 4, probes)
+	assert.True(t, time.Since(start) < time.Second)
+
+	// A device that doesn't answer is probed up to the maximum wait
+	sim.Faults = func(CommandNumber) Fault { return FAULT_TIMEOUT }
+	start = time.Now()
+	assert.Nil(t, probeDevice(context.Background(), sim, 200*time.Millisecond))
+	assert.True(t, time.Since(start) >= 200*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, probeDevice(ctx, sim, 5*time.Second))
+}
+
+// Custom board based on the Model M
+type customModel struct {
+	*ModelM
+}
+
+func (m customModel) GetFeatures() HwFeatures {
+	f := m.ModelM.GetFeatures()
+	f.Name = "Custom"
+	return f
+}
+
+// Remove a model registered by a test
+func unregisterModel(model uint8) {
+	hwModelsMu.Lock()
+	delete(hwModels, model)
+	hwModelsMu.Unlock()
+}
+
+func TestRegisterModel(t *testing.T) {
+	const id = 200
+	assert.Nil(t, RegisterModel(id, customModel{NewModelM()}))
+	t.Cleanup(func() { unregisterModel(id) })
+	assert.Equal(t, ErrModelExists, RegisterModel(id, NewModelM()))
+	assert.Equal(t, ErrInvalidModel, RegisterModel(201, nil))
+	assert.Subset(t, Models(), []uint8{ModelMId, ModelSId, ModelNId, id})
+
+	daq, _ := newSimDAQ(t, id)
+	assert.Equal(t, "Custom", daq.Name)
+}
+
+// Read from several devices at the same time. The time per reading should
+// decrease with the number of devices, up to the number of CPUs.
+func BenchmarkDevices(b *testing.B) {
+	for _, n := range []int{1, 4, 16, 64} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			daqs := make([]*OpenDAQ, n)
+			for i := range daqs {
+				daqs[i], _ = newSimDAQ(b, ModelMId)
+				daqs[i].ConfigureADC(1, 0, 1, 1)
+			}
+			var next int64
+			var wg sync.WaitGroup
+			b.ResetTimer()
+			for _, daq := range daqs {
+				wg.Add(1)
+				go func(daq *OpenDAQ) {
+					defer wg.Done()
+					for atomic.AddInt64(&next, 1) <= int64(b.N) {
+						if _, err := daq.ReadAnalog(); err != nil {
+							b.Error(err)
+							return
+						}
+					}
+				}(daq)
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func TestTare(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelMId)
+	sim.Inputs = map[uint]Waveform{1: Constant(0.5), 5: Constant(0.2)}
+	assert.Nil(t, daq.ConfigureADC(1, 0, 1, 1))
+	_, err := daq.Tare(2, 0)
+	assert.Equal(t, ErrNotConfigured, err)
+
+	offset, err := daq.Tare(1, 10*time.Millisecond)
+	assert.Nil(t, err)
+	assert.InDelta(t, 0.5, offset, 0.001)
+	assert.Equal(t, offset, daq.GetTare(1, 0))
+	v, err := daq.ReadAnalog()
+	assert.Nil(t, err)
+	assert.InDelta(t, 0, v, 0.001)
+
+	// The tare of a single-ended reading doesn't apply to differential ones
+	assert.Nil(t, daq.ConfigureADC(1, 5, 1, 1))
+	assert.Zero(t, daq.GetTare(1, 5))
+	v, err = daq.ReadAnalog()
+	assert.Nil(t, err)
+	assert.InDelta(t, 0.3, v, 0.001)
+
+	assert.Nil(t, daq.SetTare(1, 5, 0.1))
+	v, err = daq.ReadAnalog()
+	assert.Nil(t, err)
+	assert.InDelta(t, 0.2, v, 0.001)
+	assert.Nil(t, daq.SetTare(1, 5, 0))
+	assert.Zero(t, daq.GetTare(1, 5))
+	assert.Equal(t, offset, daq.GetTare(1, 0))
+	assert.Equal(t, ErrInvalidInput, daq.SetTare(1, 2, 0.1))
+	assert.Equal(t, ErrInvalidInput, daq.SetTare(9, 0, 0.1))
+}
+
+func TestSettling(t *testing.T) {
+	sim, _ := NewSimulator(ModelMId)
+	rec := &recorder{ReadWriteCloser: sim}
+	daq, err := NewFromTransport(rec)
+	assert.Nil(t, err)
+	daq.SetSettling(Settling{Discard: 2, Delay: 100 * time.Millisecond})
+
+	// Number of ADC readings sent by read
+	reads := func(read func() error) int {
+		rec.cmds = nil
+		assert.Nil(t, read())
+		n := 0
+		for _, cmd := range rec.cmds {
+			if cmd == AIN {
+				n++
+			}
+		}
+		return n
+	}
+	readADC := func() error { _, err := daq.ReadADC(); return err }
+	readAnalog := func() error { _, err := daq.ReadAnalog(); return err }
+
+	assert.Nil(t, daq.ConfigureADC(1, 0, 1, 1))
+	start := time.Now()
+	assert.Equal(t, 3, reads(readADC))
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+	assert.Equal(t, 1, reads(readADC))
+
+	// Nothing is discarded if the configuration doesn't change
+	assert.Nil(t, daq.ConfigureADC(1, 0, 1, 1))
+	start = time.Now()
+	assert.Equal(t, 1, reads(readAnalog))
+	assert.True(t, time.Since(start) < 100*time.Millisecond)
+
+	// Input and gain changes
+	assert.Nil(t, daq.ConfigureADC(2, 0, 1, 1))
+	assert.Equal(t, 3, reads(readAnalog))
+	assert.Nil(t, daq.ConfigureADC(2, 0, 2, 1))
+	assert.Equal(t, 3, reads(readADC))
+	assert.Equal(t, 1, reads(readAnalog))
+}
+
+func TestConcurrentReads(t *testing.T) {
+	daq, _ := newSimDAQ(t, ModelMId)
+	daq.SetMedianFilter(1, 3)
+	daq.SetSettling(Settling{Discard: 1})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := uint(0); i < 20; i++ {
+			assert.Nil(t, daq.ConfigureADC(i%2+1, 0, 1, 1))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			_, err := daq.ReadAnalogInfo()
+			assert.Nil(t, err)
+		}
+	}()
+	wg.Wait()
+}
+
+func TestReadRatio(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelMId, WithRetries(1))
+	sim.Inputs = map[uint]Waveform{1: Constant(1), 2: Constant(2)}
+	assert.Nil(t, daq.ConfigureADC(1, 0, 1, 1))
+	_, err := daq.ReadRatio()
+	assert.Equal(t, ErrNoReference, err)
+
+	assert.Nil(t, daq.SetRatiometric(2, 1))
+	ratio, err := daq.ReadRatio()
+	assert.Nil(t, err)
+	assert.InDelta(t, 0.5, ratio, 0.001)
+	assert.Equal(t, ADCConfig{1, 0, 1, 1}, sim.adc)
+
+	assert.Nil(t, daq.SetRatiometric(3, 1))
+	_, err = daq.ReadRatio()
+	assert.Equal(t, ErrZeroReference, err)
+	assert.Equal(t, ErrInvalidInput, daq.SetRatiometric(9, 1))
+
+	// The configuration is restored when the reference can't be read
+	assert.Nil(t, daq.SetRatiometric(2, 1))
+	reads := 0
+	sim.Faults = func(cmd CommandNumber) Fault {
+		if cmd == AIN {
+			if reads++; reads > 1 {
+				return FAULT_NAK
+			}
+		}
+		return NO_FAULT
+	}
+	_, err = daq.ReadRatio()
+	assert.True(t, errors.Is(err, ErrNakReceived))
+	assert.Equal(t, 2, reads)
+	assert.Equal(t, ADCConfig{1, 0, 1, 1}, sim.adc)
+	assert.Equal(t, []uint{1, 0, 1}, []uint{daq.posInput, daq.negInput, daq.gainId})
+}
+
+func TestPortState(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelMId)
+	st, err := daq.ReadPortState()
+	assert.Nil(t, err)
+	assert.Equal(t, PortState{}, st)
+
+	assert.Nil(t, daq.SetPortState(PortState{0x0f, 0x05}))
+	assert.Equal(t, PortState{0x0f, 0x05}, sim.Port())
+	sim.SetPIOInputs(0x30)
+	st, err = daq.ReadPortState()
+	assert.Nil(t, err)
+	assert.Equal(t, PortState{0x0f, 0x35}, st)
+
+	assert.Nil(t, daq.SetPIODir(1, false))
+	st, err = daq.ReadPortState()
+	assert.Nil(t, err)
+	assert.Equal(t, PortState{0x0e, 0x34}, st)
+
+	// The direction is the one set through the library
+	sim.Reset()
+	st, err = daq.ReadPortState()
+	assert.Nil(t, err)
+	assert.Equal(t, PortState{0x0e, 0x30}, st)
+}
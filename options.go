@@ -0,0 +1,161 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Option of New and NewFromTransport
+type Option func(*options)
+
+type options struct {
+	outputs     *OutputDefaults
+	zeroOutputs bool
+
+	baud        int
+	readTimeout time.Duration
+	bootDelay   time.Duration
+	retries     int
+	skipCalib   bool
+	dial        Dialer
+	port        string
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		baud:        115200,
+		readTimeout: 100 * time.Millisecond,
+		bootDelay:   1500 * time.Millisecond,
+		retries:     8,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Values written to the outputs when the device is opened
+type OutputDefaults struct {
+	Analog map[uint]float32 // Voltage of each analog output
+	Port   *PortState       // Direction and value of the PIOs (nil to keep them)
+}
+
+// Write the given values to the outputs when the device is opened.
+// By default the outputs are not written, so reconnecting to a device doesn't
+// change what it's driving (but opening a serial port reboots the device).
+func WithOutputDefaults(d OutputDefaults) Option {
+	return func(o *options) {
+		o.outputs, o.zeroOutputs = &d, false
+	}
+}
+
+// Set all the analog outputs to 0 V and all the PIOs as inputs when the
+// device is opened
+func WithZeroOutputs() Option {
+	return func(o *options) {
+		o.outputs, o.zeroOutputs = nil, true
+	}
+}
+
+// Baud rate of the serial port (115200 by default, as the firmware uses)
+func WithBaud(baud int) Option {
+	return func(o *options) {
+		o.baud = baud
+	}
+}
+
+// Time waited for the response of the device before retrying a command
+// (100 ms by default). It's used by New and NewTCP: other transports must
+// implement their own timeout.
+func WithReadTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.readTimeout = d
+	}
+}
+
+// Maximum number of attempts of each command (8 by default)
+func WithRetries(n int) Option {
+	return func(o *options) {
+		if n < 1 {
+			n = 1
+		}
+		o.retries = n
+	}
+}
+
+// Maximum time waited for the device to reboot after opening the serial port
+// (1.5 s by default). The device is probed during this time, so a device
+// that is already booted is used right away.
+func WithBootDelay(d time.Duration) Option {
+	return func(o *options) {
+		o.bootDelay = d
+	}
+}
+
+// Don't read the calibration registers when the device is opened, to speed
+// up the startup. The readings and the outputs are not calibrated.
+func WithSkipCalibration() Option {
+	return func(o *options) {
+		o.skipCalib = true
+	}
+}
+
+// Open again the transport of a device, see StartReconnect
+type Dialer func(ctx context.Context) (io.ReadWriteCloser, error)
+
+// Use d to reconnect to a device opened with NewFromTransport.
+// New and NewTCP set it to open the same port again.
+func WithDialer(d Dialer) Option {
+	return func(o *options) {
+		o.dial = d
+	}
+}
+
+// Name of the port, reported in the errors
+func withPort(port string) Option {
+	return func(o *options) {
+		o.port = port
+	}
+}
+
+// Write the startup values to the outputs
+func (daq *OpenDAQ) applyOutputDefaults(d OutputDefaults) error {
+	for n, v := range d.Analog {
+		if err := daq.SetAnalog(n, v); err != nil {
+			return err
+		}
+	}
+	if d.Port != nil {
+		return daq.SetPortState(*d.Port)
+	}
+	return nil
+}
+
+// Apply the startup options to the outputs
+func (daq *OpenDAQ) initOutputs(o options) error {
+	if o.zeroOutputs {
+		d := OutputDefaults{Analog: make(map[uint]float32), Port: &PortState{}}
+		for n := uint(1); n <= daq.NOutputs; n++ {
+			d.Analog[n] = 0
+		}
+		return daq.applyOutputDefaults(d)
+	}
+	if o.outputs != nil {
+		return daq.applyOutputDefaults(*o.outputs)
+	}
+	return nil
+}
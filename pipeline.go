@@ -0,0 +1,166 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// Maximum time spent discarding the data received after a failure
+const drainTimeout = time.Second
+
+// Send the commands keeping up to depth of them on the wire, and pass the
+// responses to handle in order. On a failure the data received is discarded
+// until the link is quiet, so the late responses to the commands in flight
+// aren't taken for the responses to the commands sent again, and the
+// commands not answered yet are sent again. So the commands must be
+// idempotent (e.g. AIN).
+func (daq *OpenDAQ) sendPipelined(ctx context.Context, msgs []*Message, depth int,
+	handle func(i int, r io.Reader)) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	if depth < 1 {
+		depth = 1
+	}
+	frames := make([][]byte, len(msgs))
+	for i, m := range msgs {
+		var err error
+		if frames[i], err = m.Marshal(); err != nil {
+			return err
+		}
+	}
+	if err := daq.queue.acquire(ctx); err != nil {
+		return &OpError{msgs[0].Number, daq.port, 0, err}
+	}
+	defer daq.queue.release()
+	daq.Lock()
+	defer daq.Unlock()
+	if daq.streaming {
+		return &OpError{msgs[0].Number, daq.port, 0, ErrStreaming}
+	}
+
+	next, done, attempts := 0, 0, 1
+	for done < len(msgs) {
+		if err := ctx.Err(); err != nil {
+			sent := attempts - 1
+			if next > done {
+				sent = attempts
+			}
+			return &OpError{msgs[done].Number, daq.port, sent, err}
+		}
+		var err error
+		for ; next < len(msgs) && next-done < depth && err == nil; next++ {
+			_, err = daq.ser.Write(frames[next])
+		}
+		var r io.Reader
+		if err == nil {
+			cmd := msgs[done].Number
+			data := make([]byte, cmd.RespLen()+4)
+			if err = readResponse(daq.ser, data); err == nil {
+				if !validResponse(data, cmd) {
+					err = ErrChecksum
+				} else {
+					r, err = parseResponse(data)
+				}
+			}
+		}
+		if err != nil {
+			daq.lastErr = err
+			if attempts >= daq.retries {
+				daq.stats.Commands++
+				daq.stats.Errors++
+				daq.failures++
+				return &OpError{msgs[done].Number, daq.port, attempts, err}
+			}
+			attempts++
+			daq.stats.Retries++
+			// Send again the commands not answered
+			daq.drain()
+			next = done
+			continue
+		}
+		handle(done, r)
+		daq.stats.Commands++
+		daq.failures, daq.lastErr = 0, nil
+		done, attempts = done+1, 1
+	}
+	return nil
+}
+
+// Discard the data received until a read times out
+func (daq *OpenDAQ) drain() {
+	daq.flush()
+	buf := make([]byte, 64)
+	for start := time.Now(); time.Since(start) < drainTimeout; {
+		if n, err := daq.ser.Read(buf); n == 0 || err != nil {
+			return
+		}
+	}
+}
+
+// Read n raw values from the ADC, sending up to depth AIN commands before
+// reading their responses. It increases the throughput over links with a
+// long latency, such as a TCP serial server.
+func (daq *OpenDAQ) ReadADCPipelined(ctx context.Context, n, depth int) ([]int16, error) {
+	daq.cfgMu.RLock()
+	defer daq.cfgMu.RUnlock()
+	return daq.readADCPipelined(ctx, n, depth)
+}
+
+// cfgMu must be held
+func (daq *OpenDAQ) readADCPipelined(ctx context.Context, n, depth int) ([]int16, error) {
+	if n < 0 {
+		return nil, ErrOutOfRange
+	}
+	if err := daq.settle(ctx); err != nil {
+		return nil, err
+	}
+	msgs := make([]*Message, n)
+	for i := range msgs {
+		msgs[i] = &Message{Number: AIN}
+	}
+	values := make([]int16, n)
+	err := daq.sendPipelined(ctx, msgs, depth, func(i int, r io.Reader) {
+		binary.Read(r, binary.BigEndian, &values[i])
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Read n values in volts from the ADC, like ReadADCPipelined.
+// The filter and the tare of the input are applied, but not host averaging.
+func (daq *OpenDAQ) ReadAnalogPipelined(ctx context.Context, n, depth int) ([]float32, error) {
+	daq.cfgMu.RLock()
+	defer daq.cfgMu.RUnlock()
+	raw, err := daq.readADCPipelined(ctx, n, depth)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]float32, n)
+	tare := daq.GetTare(daq.posInput, daq.negInput)
+	for i, r := range raw {
+		v, err := daq.adcToVolts(int(r))
+		if err != nil {
+			return nil, err
+		}
+		values[i] = daq.filter(daq.posInput, v) - tare
+	}
+	return values, nil
+}
@@ -0,0 +1,88 @@
+package godaq
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Transport measuring the number of AIN commands waiting for a response
+type inflight struct {
+	io.ReadWriteCloser
+	sent, read, max int
+}
+
+func (f *inflight) Write(p []byte) (int, error) {
+	f.sent++
+	if n := f.sent - f.read/(AIN.RespLen()+4); n > f.max {
+		f.max = n
+	}
+	return f.ReadWriteCloser.Write(p)
+}
+
+func (f *inflight) Read(p []byte) (int, error) {
+	n, err := f.ReadWriteCloser.Read(p)
+	f.read += n
+	return n, err
+}
+
+func TestReadAnalogPipelined(t *testing.T) {
+	sim, _ := NewSimulator(ModelMId)
+	sim.Inputs = map[uint]Waveform{1: Constant(1.5)}
+	daq, err := NewFromTransport(sim)
+	assert.Nil(t, err)
+	assert.Nil(t, daq.ConfigureADC(1, 0, 1, 1))
+	assert.Nil(t, daq.settle(context.Background()))
+
+	tr := &inflight{ReadWriteCloser: sim}
+	daq.ser = tr
+	values, err := daq.ReadAnalogPipelined(context.Background(), 50, 8)
+	assert.Nil(t, err)
+	assert.Len(t, values, 50)
+	for _, v := range values {
+		assert.InDelta(t, 1.5, v, 0.01)
+	}
+	assert.Equal(t, 8, tr.max)
+	assert.Equal(t, 50, tr.sent)
+	_, err = daq.ReadAnalogPipelined(context.Background(), -1, 8)
+	assert.Equal(t, ErrOutOfRange, err)
+
+	// The commands not answered are sent again after an error
+	n := 0
+	sim.Faults = func(CommandNumber) Fault {
+		n++
+		if n == 3 {
+			return FAULT_CHECKSUM
+		}
+		return NO_FAULT
+	}
+	before := daq.Stats()
+	raw, err := daq.ReadADCPipelined(context.Background(), 20, 4)
+	assert.Nil(t, err)
+	assert.Len(t, raw, 20)
+	assert.EqualValues(t, 1, daq.Stats().Retries-before.Retries)
+	assert.EqualValues(t, 20, daq.Stats().Commands-before.Commands)
+
+	// The late responses to the commands in flight aren't taken for the
+	// responses to the commands sent again
+	sim.Latency = 2 * time.Millisecond
+	n = 0
+	raw, err = daq.ReadADCPipelined(context.Background(), 20, 4)
+	assert.Nil(t, err)
+	assert.Len(t, raw, 20)
+	left, _ := sim.Read(make([]byte, 64))
+	assert.Zero(t, left)
+	sim.Latency = 0
+
+	sim.Faults = func(CommandNumber) Fault { return FAULT_NAK }
+	_, err = daq.ReadADCPipelined(context.Background(), 20, 4)
+	assert.Equal(t, &OpError{AIN, "", 8, ErrNakReceived}, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = daq.ReadADCPipelined(ctx, 20, 4)
+	assert.Equal(t, &OpError{AIN, "", 0, context.Canceled}, err)
+}
@@ -0,0 +1,212 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+)
+
+var ErrEmptyWaveform = errors.New("Empty waveform")
+
+// Voltage of a signal at a time t since its start
+type Waveform func(t time.Duration) float32
+
+// Constant voltage
+func Constant(v float32) Waveform {
+	return func(time.Duration) float32 { return v }
+}
+
+// Sine wave of the given amplitude and frequency (Hz) around offset
+func Sine(amplitude, freq, offset float32) Waveform {
+	return func(t time.Duration) float32 {
+		return offset + amplitude*float32(math.Sin(2*math.Pi*float64(freq)*t.Seconds()))
+	}
+}
+
+// Square wave of the given amplitude and frequency (Hz) around offset
+func Square(amplitude, freq, offset float32) Waveform {
+	return Signal{SQUARE, float64(freq), amplitude, offset}.Waveform()
+}
+
+// Triangle wave of the given amplitude and frequency (Hz) around offset
+func Triangle(amplitude, freq, offset float32) Waveform {
+	return Signal{TRIANGLE, float64(freq), amplitude, offset}.Waveform()
+}
+
+// Sawtooth wave of the given amplitude and frequency (Hz) around offset,
+// rising from offset-amplitude
+func Sawtooth(amplitude, freq, offset float32) Waveform {
+	return Signal{SAWTOOTH, float64(freq), amplitude, offset}.Waveform()
+}
+
+// Minimum period of the software-timed outputs.
+// Each point is a serial round trip of a few milliseconds, so shorter periods
+// (higher than 200 Hz) can't be held.
+const MinSoftwarePeriod = 5 * time.Millisecond
+
+// Timing statistics of a software-timed output
+type OutputStats struct {
+	Points  int // Points written
+	Skipped int // Points skipped to catch up after a delay
+	// Delay between the time each point was due and its write to the device
+	MeanJitter, MaxJitter, StdDevJitter time.Duration
+}
+
+// Play the waveform w on output n, writing a point from the host every period
+// until ctx is done. The points are scheduled from the start time, so the
+// errors don't accumulate, and points are skipped when the host falls behind.
+// Use it with models or waveforms without hardware support.
+func (daq *OpenDAQ) PlaySoftware(ctx context.Context, n uint, w Waveform, period time.Duration) (OutputStats, error) {
+	return daq.playSoftware(ctx, n, w, period, 0)
+}
+
+// Play nPoints of the waveform (0 for no limit)
+func (daq *OpenDAQ) playSoftware(ctx context.Context, n uint, w Waveform, period time.Duration,
+	nPoints int) (OutputStats, error) {
+	var stats OutputStats
+	if period < MinSoftwarePeriod {
+		return stats, ErrInvalidPeriod
+	}
+	var sum, sumSq float64
+	start := time.Now()
+	for k := 0; nPoints == 0 || k < nPoints; k++ {
+		t := time.Duration(k) * period
+		if err := sleepContext(ctx, time.Until(start.Add(t))); err != nil {
+			break
+		}
+		if err := daq.SetAnalog(n, w(t)); err != nil {
+			return stats, err
+		}
+		jitter := daq.LastTiming().Mid().Sub(start.Add(t))
+		stats.Points++
+		sum += float64(jitter)
+		sumSq += float64(jitter) * float64(jitter)
+		if jitter > stats.MaxJitter {
+			stats.MaxJitter = jitter
+		}
+
+		// Skip the points already due. Once ctx is done no more points are
+		// due, so none are counted as skipped.
+		if ctx.Err() != nil {
+			break
+		}
+		if late := int(time.Since(start.Add(t)) / period); late > 0 {
+			if nPoints != 0 && k+late >= nPoints {
+				late = nPoints - k - 1
+			}
+			k += late
+			stats.Skipped += late
+		}
+	}
+	if stats.Points > 0 {
+		mean := sum / float64(stats.Points)
+		stats.MeanJitter = time.Duration(mean)
+		stats.StdDevJitter = time.Duration(math.Sqrt(math.Max(0, sumSq/float64(stats.Points)-mean*mean)))
+	}
+	return stats, nil
+}
+
+// Play the samples (V) on output n, one every period, loop times (0 to repeat
+// them until ctx is done). It returns when the samples have been played; the
+// output keeps the last value.
+// The samples are uploaded to the signal buffer of the firmware and played by
+// a stream experiment when possible (see Generator). Otherwise they are
+// written from the host like PlaySoftware does.
+func (daq *OpenDAQ) PlayWaveformContext(ctx context.Context, n uint, samples []float32,
+	period time.Duration, loop int) (OutputStats, error) {
+	if n < 1 || n > daq.NOutputs {
+		return OutputStats{}, ErrInvalidOutput
+	}
+	if len(samples) == 0 {
+		return OutputStats{}, ErrEmptyWaveform
+	}
+	if loop < 0 {
+		return OutputStats{}, ErrOutOfRange
+	}
+	payload := make([]byte, 0, 2*len(samples))
+	for _, v := range samples {
+		if err := daq.Dac.CheckRange(v); err != nil {
+			return OutputStats{}, err
+		}
+		raw, err := daq.voltsToDac(v, n)
+		if err != nil {
+			return OutputStats{}, err
+		}
+		payload = append(payload, toBytes(int16(raw))...)
+	}
+	nPoints := len(samples) * loop
+
+	stats, err := daq.playHardware(ctx, n, payload, period, nPoints)
+	if !errors.Is(err, errNoHardware) {
+		return stats, err
+	}
+	w := func(t time.Duration) float32 {
+		return samples[int(t/period)%len(samples)]
+	}
+	return daq.playSoftware(ctx, n, w, period, nPoints)
+}
+
+// Play the samples on output n, one every period, loop times
+func (daq *OpenDAQ) PlayWaveform(n uint, samples []float32, period time.Duration, loop int) (OutputStats, error) {
+	return daq.PlayWaveformContext(context.Background(), n, samples, period, loop)
+}
+
+// Play nPoints (0 for no limit) of the raw DAC values in payload from the
+// signal buffer of the firmware
+func (daq *OpenDAQ) playHardware(ctx context.Context, n uint, payload []byte,
+	period time.Duration, nPoints int) (OutputStats, error) {
+	if actual, err := daq.StreamPeriod(period); err != nil || actual != period ||
+		len(payload)/2 > MaxSignalPoints || nPoints > math.MaxUint16 || len(daq.streams) != 0 {
+		return OutputStats{}, errNoHardware
+	}
+	if err := daq.CreateStream(generatorStream, period); err != nil {
+		return OutputStats{}, err
+	}
+	err := daq.ConfigureChannel(generatorStream, ChannelConfig{Mode: ANALOG_OUTPUT,
+		PosInput: n, NPoints: uint16(nPoints)})
+	if err == nil {
+		err = daq.loadSignal(payload)
+	}
+	if err == nil {
+		err = daq.startOutputStream()
+	}
+	if err != nil {
+		daq.DestroyStream(generatorStream)
+		return OutputStats{}, err
+	}
+
+	start := time.Now()
+	var done <-chan time.Time
+	if nPoints != 0 {
+		timer := time.NewTimer(time.Duration(nPoints) * period)
+		defer timer.Stop()
+		done = timer.C
+	}
+	select {
+	case <-ctx.Done():
+	case <-done:
+	}
+	stats := OutputStats{Points: int(time.Since(start) / period)}
+	if nPoints != 0 && stats.Points > nPoints {
+		stats.Points = nPoints
+	}
+	err = daq.StopStream()
+	if e := daq.DestroyStream(generatorStream); err == nil {
+		err = e
+	}
+	return stats, err
+}
@@ -0,0 +1,74 @@
+package godaq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlaySoftware(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelMId)
+	_, err := daq.PlaySoftware(context.Background(), 1, Constant(1), time.Millisecond)
+	assert.Equal(t, ErrInvalidPeriod, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	stats, err := daq.PlaySoftware(ctx, 1, Constant(1), 10*time.Millisecond)
+	assert.Nil(t, err)
+	// Only the points due before ctx was done (at 0, 10... 100 ms at most)
+	// are written or skipped
+	assert.True(t, stats.Points >= 1)
+	assert.True(t, stats.Points+stats.Skipped <= 11)
+	assert.True(t, stats.MaxJitter >= stats.MeanJitter)
+	raw, _ := daq.voltsToDac(1, 1)
+	assert.EqualValues(t, raw, sim.DAC(1))
+
+	stats, err = daq.playSoftware(context.Background(), 1, Sine(1, 10, 0), 5*time.Millisecond, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, stats.Points+stats.Skipped)
+
+	// The points due after ctx is done aren't skipped
+	sim.Latency = 50 * time.Millisecond
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	stats, err = daq.PlaySoftware(ctx, 1, Constant(1), 10*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Equal(t, OutputStats{Points: 1}, OutputStats{Points: stats.Points, Skipped: stats.Skipped})
+}
+
+func TestPlayWaveform(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelMId)
+	samples := []float32{0.5, 1, 1.5}
+	_, err := daq.PlayWaveform(1, nil, time.Millisecond, 1)
+	assert.Equal(t, ErrEmptyWaveform, err)
+	_, err = daq.PlayWaveform(3, samples, time.Millisecond, 1)
+	assert.Equal(t, ErrInvalidOutput, err)
+	_, err = daq.PlayWaveform(1, []float32{10}, time.Millisecond, 1)
+	assert.NotNil(t, err)
+
+	// Played by the firmware
+	start := time.Now()
+	stats, err := daq.PlayWaveform(1, samples, 2*time.Millisecond, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 9, stats.Points)
+	assert.True(t, time.Since(start) >= 18*time.Millisecond)
+	assert.Empty(t, daq.streams)
+	raw, _ := daq.voltsToDac(1.5, 1)
+	assert.EqualValues(t, raw, sim.DAC(1))
+
+	// Written from the host
+	sim.Faults = func(cmd CommandNumber) Fault {
+		if cmd == LOAD_SIGNAL {
+			return FAULT_NAK
+		}
+		return NO_FAULT
+	}
+	stats, err = daq.PlayWaveform(1, []float32{1, 2}, 5*time.Millisecond, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, stats.Points+stats.Skipped)
+	assert.Empty(t, daq.streams)
+	raw, _ = daq.voltsToDac(2, 1)
+	assert.EqualValues(t, raw, sim.DAC(1))
+}
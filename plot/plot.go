@@ -0,0 +1,239 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plot renders rolling time-series plots of openDAQ channels.
+// Only the standard library is used, so the core driver doesn't pull in
+// any plotting dependency.
+package plot
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+var ErrEmptyPlot = errors.New("Nothing to plot")
+
+// Line colors, assigned to the series in order
+var palette = []color.RGBA{
+	{0x1f, 0x77, 0xb4, 0xff},
+	{0xd6, 0x27, 0x28, 0xff},
+	{0x2c, 0xa0, 0x2c, 0xff},
+	{0xff, 0x7f, 0x0e, 0xff},
+	{0x94, 0x67, 0xbd, 0xff},
+	{0x8c, 0x56, 0x4b, 0xff},
+}
+
+type point struct {
+	t time.Time
+	v float32
+}
+
+// Rolling buffer holding the last points of a channel
+type Series struct {
+	Name   string
+	points []point
+	start  int
+	full   bool
+}
+
+func NewSeries(name string, size int) *Series {
+	if size < 2 {
+		size = 2
+	}
+	return &Series{Name: name, points: make([]point, 0, size)}
+}
+
+// Append a new point, discarding the oldest one when the buffer is full
+func (s *Series) add(t time.Time, v float32) {
+	if !s.full {
+		s.points = append(s.points, point{t, v})
+		s.full = len(s.points) == cap(s.points)
+		return
+	}
+	s.points[s.start] = point{t, v}
+	s.start = (s.start + 1) % len(s.points)
+}
+
+// Return the points in chronological order
+func (s *Series) ordered() []point {
+	ret := make([]point, 0, len(s.points))
+	ret = append(ret, s.points[s.start:]...)
+	return append(ret, s.points[:s.start]...)
+}
+
+// Rolling time-series plot of several channels.
+// Points can be added from the acquisition goroutine while the plot is
+// being rendered from another one (e.g. an HTTP handler).
+type Plot struct {
+	Title         string
+	Width, Height int
+	series        []*Series
+	sync.Mutex
+}
+
+func New(title string, width, height int) *Plot {
+	return &Plot{Title: title, Width: width, Height: height}
+}
+
+// Add a channel to the plot, keeping its last size points
+func (p *Plot) AddSeries(name string, size int) *Series {
+	p.Lock()
+	defer p.Unlock()
+	s := NewSeries(name, size)
+	p.series = append(p.series, s)
+	return s
+}
+
+// Append a new value to the series s
+func (p *Plot) Add(s *Series, t time.Time, v float32) {
+	p.Lock()
+	s.add(t, v)
+	p.Unlock()
+}
+
+type bounds struct {
+	t0, t1     time.Time
+	vmin, vmax float32
+}
+
+func (p *Plot) bounds() (b bounds, err error) {
+	first := true
+	for _, s := range p.series {
+		for _, pt := range s.points {
+			if first {
+				b = bounds{pt.t, pt.t, pt.v, pt.v}
+				first = false
+				continue
+			}
+			if pt.t.Before(b.t0) {
+				b.t0 = pt.t
+			}
+			if pt.t.After(b.t1) {
+				b.t1 = pt.t
+			}
+			b.vmin = float32(math.Min(float64(b.vmin), float64(pt.v)))
+			b.vmax = float32(math.Max(float64(b.vmax), float64(pt.v)))
+		}
+	}
+	if first {
+		return b, ErrEmptyPlot
+	}
+	if b.vmin == b.vmax {
+		b.vmin--
+		b.vmax++
+	}
+	if !b.t1.After(b.t0) {
+		b.t1 = b.t0.Add(time.Second)
+	}
+	return b, nil
+}
+
+// Map a point to image coordinates
+func (b *bounds) scale(pt point, w, h int) (float64, float64) {
+	x := float64(pt.t.Sub(b.t0)) / float64(b.t1.Sub(b.t0)) * float64(w-1)
+	y := float64(b.vmax-pt.v) / float64(b.vmax-b.vmin) * float64(h-1)
+	return x, y
+}
+
+// Render the plot as an SVG document
+func (p *Plot) WriteSVG(w io.Writer) error {
+	p.Lock()
+	defer p.Unlock()
+	b, err := p.bounds()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d">`+"\n",
+		p.Width, p.Height)
+	fmt.Fprintf(w, `<rect width="100%%" height="100%%" fill="white"/>`+"\n")
+	fmt.Fprintf(w, `<text x="4" y="14" font-size="12">%s [%.4g, %.4g]</text>`+"\n",
+		html.EscapeString(p.Title), b.vmin, b.vmax)
+	for i, s := range p.series {
+		c := palette[i%len(palette)]
+		fmt.Fprintf(w, `<polyline fill="none" stroke="#%02x%02x%02x" points="`, c.R, c.G, c.B)
+		for _, pt := range s.ordered() {
+			x, y := b.scale(pt, p.Width, p.Height)
+			fmt.Fprintf(w, "%.1f,%.1f ", x, y)
+		}
+		fmt.Fprintf(w, `"><title>%s</title></polyline>`+"\n", html.EscapeString(s.Name))
+	}
+	_, err = fmt.Fprintln(w, "</svg>")
+	return err
+}
+
+// Render the plot as a PNG image
+func (p *Plot) WritePNG(w io.Writer) error {
+	p.Lock()
+	defer p.Unlock()
+	b, err := p.bounds()
+	if err != nil {
+		return err
+	}
+	img := image.NewRGBA(image.Rect(0, 0, p.Width, p.Height))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	for i, s := range p.series {
+		c := palette[i%len(palette)]
+		pts := s.ordered()
+		for j := 1; j < len(pts); j++ {
+			x0, y0 := b.scale(pts[j-1], p.Width, p.Height)
+			x1, y1 := b.scale(pts[j], p.Width, p.Height)
+			drawLine(img, int(x0), int(y0), int(x1), int(y1), c)
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// Bresenham's line algorithm
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA) {
+	dx := abs(x1 - x0)
+	dy := -abs(y1 - y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		img.SetRGBA(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		if 2*e >= dy {
+			e += dy
+			x0 += sx
+		}
+		if 2*e <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,51 @@
+package plot
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeriesRolling(t *testing.T) {
+	s := NewSeries("ch1", 3)
+	t0 := time.Unix(0, 0)
+	for i := 0; i < 5; i++ {
+		s.add(t0.Add(time.Duration(i)*time.Second), float32(i))
+	}
+	var vals []float32
+	for _, pt := range s.ordered() {
+		vals = append(vals, pt.v)
+	}
+	assert.Equal(t, []float32{2, 3, 4}, vals)
+}
+
+func TestWriteSVG(t *testing.T) {
+	p := New("test", 100, 50)
+	var buf bytes.Buffer
+	assert.Equal(t, ErrEmptyPlot, p.WriteSVG(&buf))
+
+	s := p.AddSeries("AIN1", 10)
+	t0 := time.Unix(0, 0)
+	p.Add(s, t0, 0)
+	p.Add(s, t0.Add(time.Second), 1)
+	assert.Nil(t, p.WriteSVG(&buf))
+	assert.True(t, strings.Contains(buf.String(), `points="0.0,49.0 99.0,0.0 "`))
+}
+
+func TestWritePNG(t *testing.T) {
+	p := New("test", 100, 50)
+	s := p.AddSeries("AIN1", 10)
+	t0 := time.Unix(0, 0)
+	p.Add(s, t0, 0)
+	p.Add(s, t0.Add(time.Second), 1)
+
+	var buf bytes.Buffer
+	assert.Nil(t, p.WritePNG(&buf))
+	img, err := png.Decode(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, img.Bounds().Dx())
+}
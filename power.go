@@ -0,0 +1,121 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Measurements of a PowerMeter since the last Reset
+type PowerReading struct {
+	VRMS, IRMS  float32 // True-RMS voltage (V) and current (A)
+	Power       float32 // Mean (real) power (W)
+	Apparent    float32 // Apparent power, VRMS*IRMS (VA)
+	PowerFactor float32 // Power / Apparent
+	Energy      float64 // Energy accumulated since the meter was created (J)
+	Samples     int
+}
+
+// Power and energy computed from a voltage and a current channel.
+// The readings are multiplied by the scales: e.g. the ratio of a voltage
+// divider, and 1/R for a shunt resistor R or the ratio of a current
+// transformer divided by its burden resistor.
+type PowerMeter struct {
+	VoltageScale, CurrentScale float32
+	VoltageChannel             uint // Stream of the voltage (see AddSample)
+	CurrentChannel             uint // Stream of the current
+	energy                     *Totalizer
+	sumV2, sumI2, sumP         float64
+	n                          int
+	// Samples waiting for the sample of the other channel
+	pendingV, pendingI []Sample
+	sync.Mutex
+}
+
+func NewPowerMeter(vScale, iScale float32) *PowerMeter {
+	return &PowerMeter{VoltageScale: vScale, CurrentScale: iScale, energy: NewTotalizer(1)}
+}
+
+// Add the voltage v and the current i (as read, in volts) measured at time t
+// and return the instantaneous power
+func (m *PowerMeter) Add(t time.Time, v, i float32) float32 {
+	m.Lock()
+	defer m.Unlock()
+	return m.add(t, v, i)
+}
+
+func (m *PowerMeter) add(t time.Time, v, i float32) float32 {
+	v *= m.VoltageScale
+	i *= m.CurrentScale
+	p := v * i
+	m.sumV2 += float64(v * v)
+	m.sumI2 += float64(i * i)
+	m.sumP += float64(p)
+	m.n++
+	m.energy.Update(t, p)
+	return p
+}
+
+// Add a sample of a stream (see Samples). The samples of the
+// voltage and the current channels are paired in order, so both streams must
+// have the same period.
+func (m *PowerMeter) AddSample(s Sample) {
+	m.Lock()
+	defer m.Unlock()
+	switch s.Channel {
+	case m.VoltageChannel:
+		m.pendingV = append(m.pendingV, s)
+	case m.CurrentChannel:
+		m.pendingI = append(m.pendingI, s)
+	default:
+		return
+	}
+	for len(m.pendingV) > 0 && len(m.pendingI) > 0 {
+		m.add(m.pendingV[0].Time, m.pendingV[0].Volts, m.pendingI[0].Volts)
+		m.pendingV, m.pendingI = m.pendingV[1:], m.pendingI[1:]
+	}
+}
+
+// Return the measurements since the last Reset
+func (m *PowerMeter) Reading() PowerReading {
+	m.Lock()
+	defer m.Unlock()
+	r := PowerReading{Energy: m.energy.Total(), Samples: m.n}
+	if m.n == 0 {
+		return r
+	}
+	n := float64(m.n)
+	r.VRMS = float32(math.Sqrt(m.sumV2 / n))
+	r.IRMS = float32(math.Sqrt(m.sumI2 / n))
+	r.Power = float32(m.sumP / n)
+	r.Apparent = r.VRMS * r.IRMS
+	if r.Apparent != 0 {
+		r.PowerFactor = r.Power / r.Apparent
+	}
+	return r
+}
+
+// Start a new measurement period. The accumulated energy is kept.
+func (m *PowerMeter) Reset() {
+	m.Lock()
+	m.sumV2, m.sumI2, m.sumP, m.n = 0, 0, 0, 0
+	m.Unlock()
+}
+
+// Energy accumulated since the meter was created, in joules
+func (m *PowerMeter) Energy() float64 {
+	return m.energy.Total()
+}
@@ -0,0 +1,50 @@
+package godaq
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPowerMeter(t *testing.T) {
+	// 230 V with a 1:100 divider, 2 A through a 0.1 ohm shunt, 60° lagging
+	m := NewPowerMeter(100, 10)
+	t0 := time.Unix(0, 0)
+	vPeak, iPeak := 230*math.Sqrt2/100, 2*math.Sqrt2/10
+	for k := 0; k < 1000; k++ {
+		ph := 2 * math.Pi * float64(k) / 100
+		m.Add(t0.Add(time.Duration(k)*200*time.Microsecond),
+			float32(vPeak*math.Sin(ph)), float32(iPeak*math.Sin(ph-math.Pi/3)))
+	}
+	r := m.Reading()
+	assert.Equal(t, 1000, r.Samples)
+	assert.InDelta(t, 230, r.VRMS, 0.01)
+	assert.InDelta(t, 2, r.IRMS, 0.001)
+	assert.InDelta(t, 460, r.Apparent, 0.1)
+	assert.InDelta(t, 230, r.Power, 0.1)
+	assert.InDelta(t, 0.5, r.PowerFactor, 0.001)
+	// 230 W during 0.2 s
+	assert.InDelta(t, 46, r.Energy, 0.5)
+
+	m.Reset()
+	assert.Equal(t, PowerReading{Energy: m.Energy()}, m.Reading())
+}
+
+func TestPowerMeterSamples(t *testing.T) {
+	m := NewPowerMeter(1, 1)
+	m.VoltageChannel, m.CurrentChannel = 1, 2
+	t0 := time.Unix(0, 0)
+	m.AddSample(Sample{Channel: 1, Volts: 2, Time: t0})
+	m.AddSample(Sample{Channel: 1, Volts: 4, Time: t0.Add(time.Second)})
+	m.AddSample(Sample{Channel: 3, Volts: 100, Time: t0})
+	assert.Equal(t, 0, m.Reading().Samples)
+	m.AddSample(Sample{Channel: 2, Volts: 3, Time: t0})
+	m.AddSample(Sample{Channel: 2, Volts: 1, Time: t0.Add(time.Second)})
+
+	r := m.Reading()
+	assert.Equal(t, 2, r.Samples)
+	assert.InDelta(t, 5, r.Power, 1e-6)
+	assert.InDelta(t, 5, r.Energy, 1e-6)
+}
@@ -17,6 +17,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"time"
 )
@@ -25,10 +26,21 @@ type CommandNumber uint8
 
 const nak = 160
 
+// Maximum length of a message body
+const maxBodyLen = 255
+
+// Maximum number of bytes discarded looking for a valid response
+const maxResync = maxBodyLen + 4
+
 var (
 	ErrChecksum      = errors.New("Checksum error")
 	ErrInvalidLength = errors.New("Invalid message length")
 	ErrNakReceived   = errors.New("NAK response received")
+	ErrBodyTooLong   = errors.New("Message body too long")
+	// The response is incomplete because the device stopped sending data
+	ErrTimeout = fmt.Errorf("%w: response timeout", ErrInvalidLength)
+	// No valid response found after a checksum error
+	ErrBadChecksum = fmt.Errorf("%w: resynchronization failed", ErrChecksum)
 )
 
 type Message struct {
@@ -50,6 +62,9 @@ func toBytes(value interface{}) []byte {
 }
 
 func (m *Message) Marshal() ([]byte, error) {
+	if len(m.Body) > maxBodyLen {
+		return nil, ErrBodyTooLong
+	}
 	b := make([]byte, 4+len(m.Body))
 	b[2] = byte(m.Number)
 	b[3] = byte(len(m.Body))
@@ -74,18 +89,71 @@ func parseResponse(b []byte) (io.Reader, error) {
 	return bytes.NewBuffer(b[4:]), nil
 }
 
-func sendCommand(ser io.ReadWriter, command *Message, respLen int) (io.Reader, error) {
+// b holds a valid response to the command cmd
+func validResponse(b []byte, cmd CommandNumber) bool {
+	if binary.BigEndian.Uint16(b[:2]) != checksum(b[2:]) {
+		return false
+	}
+	return b[2] == nak || b[2] == byte(cmd) && int(b[3]) == len(b)-4
+}
+
+// Transport timestamps of a command
+type Timing struct {
+	Sent     time.Time // Before writing the command
+	Received time.Time // After reading the response
+}
+
+// Middle point between the command and its response, the best estimate of
+// when the device executed it
+func (t Timing) Mid() time.Time {
+	return t.Sent.Add(t.Received.Sub(t.Sent) / 2)
+}
+
+// Read a whole response, which may arrive in several pieces (e.g. TCP)
+func readResponse(r io.Reader, data []byte) error {
+	for n := 0; n < len(data); {
+		m, err := r.Read(data[n:])
+		if m == 0 && (err == nil || err == io.EOF) {
+			// Read timeout (a serial port reports it as EOF)
+			return ErrTimeout
+		}
+		if err != nil {
+			return err
+		}
+		n += m
+	}
+	return nil
+}
+
+func sendCommand(ser io.ReadWriter, command *Message, respLen int, t *Timing) (io.Reader, error) {
 	data, err := command.Marshal()
 	if err != nil {
 		return nil, err
 	}
+	t.Sent = time.Now()
 	if _, err := ser.Write(data); err != nil {
 		return nil, err
 	}
 	data = make([]byte, respLen+4)
-	if _, err := ser.Read(data); err != nil {
+	if err := readResponse(ser, data); err != nil {
 		return nil, err
 	}
+	t.Received = time.Now()
+	// Discard bytes until a valid response is found, e.g. after stale bytes
+	// left by a timeout or a late response to a previous command
+	for skipped := 0; !validResponse(data, command.Number); skipped++ {
+		if skipped == maxResync {
+			return nil, ErrBadChecksum
+		}
+		copy(data, data[1:])
+		if err := readResponse(ser, data[len(data)-1:]); err != nil {
+			if errors.Is(err, ErrTimeout) {
+				return nil, ErrBadChecksum
+			}
+			return nil, err
+		}
+		t.Received = time.Now()
+	}
 	time.Sleep(time.Millisecond)
 	return parseResponse(data)
 }
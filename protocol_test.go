@@ -0,0 +1,67 @@
+package godaq
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type readWriter struct {
+	*bytes.Buffer
+	written bytes.Buffer
+}
+
+func (rw *readWriter) Write(p []byte) (int, error) {
+	return rw.written.Write(p)
+}
+
+func TestSendCommandTiming(t *testing.T) {
+	resp, _ := (&Message{AIN, []byte{0x12, 0x34}}).Marshal()
+	rw := &readWriter{Buffer: bytes.NewBuffer(resp)}
+
+	var tm Timing
+	before := time.Now()
+	r, err := sendCommand(rw, &Message{Number: AIN}, 2, &tm)
+	assert.Nil(t, err)
+	body, _ := ioutil.ReadAll(r)
+	assert.Equal(t, []byte{0x12, 0x34}, body)
+	assert.False(t, tm.Sent.Before(before))
+	assert.False(t, tm.Received.Before(tm.Sent))
+	assert.False(t, tm.Mid().Before(tm.Sent))
+	assert.False(t, tm.Mid().After(tm.Received))
+}
+
+func TestSendCommandResync(t *testing.T) {
+	resp, _ := (&Message{AIN, []byte{0x12, 0x34}}).Marshal()
+	stale, _ := (&Message{GET_COUNTER, []byte{0, 1}}).Marshal()
+
+	// Stale bytes and a late response to another command before the response
+	data := append([]byte{0x55, 0x7e}, stale...)
+	rw := &readWriter{Buffer: bytes.NewBuffer(append(data, resp...))}
+	var tm Timing
+	r, err := sendCommand(rw, &Message{Number: AIN}, 2, &tm)
+	assert.Nil(t, err)
+	body, _ := ioutil.ReadAll(r)
+	assert.Equal(t, []byte{0x12, 0x34}, body)
+
+	// Corrupted response
+	resp[5] ^= 0xff
+	rw = &readWriter{Buffer: bytes.NewBuffer(resp)}
+	_, err = sendCommand(rw, &Message{Number: AIN}, 2, &tm)
+	assert.Equal(t, ErrBadChecksum, err)
+	assert.True(t, errors.Is(err, ErrChecksum))
+}
+
+func TestReadResponse(t *testing.T) {
+	data := make([]byte, 4)
+	r := iotest.OneByteReader(bytes.NewReader([]byte{1, 2, 3, 4}))
+	assert.Nil(t, readResponse(r, data))
+	assert.Equal(t, []byte{1, 2, 3, 4}, data)
+
+	assert.NotNil(t, readResponse(bytes.NewReader([]byte{1, 2}), data))
+}
@@ -0,0 +1,149 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+var ErrPyExperiment = errors.New("Invalid python-opendaq experiment")
+
+// Experiment of a python-opendaq script: the arguments of create_stream,
+// create_external or create_burst and those of analog_setup, e.g. dumped to
+// JSON by the script:
+//
+//	[{"type": "stream", "mode": 0, "period": 10, "continuous": true,
+//	  "pinput": 1, "gain": 1, "nsamples": 20}]
+//
+// The omitted arguments take the defaults of python-opendaq.
+type PyExperiment struct {
+	Type       string      `json:"type"`   // "stream", "external" or "burst"
+	Mode       ChannelMode `json:"mode"`   // ExpMode value (0 for ANALOG_IN)
+	Period     uint        `json:"period"` // ms for streams, µs for bursts
+	NPoints    int         `json:"npoints"`
+	Continuous bool        `json:"continuous"`
+	ClockInput uint        `json:"clock_input"` // Trigger PIO of external experiments
+	Edge       Edge        `json:"edge"`
+	PInput     uint        `json:"pinput"`
+	NInput     uint        `json:"ninput"`
+	Gain       uint        `json:"gain"` // Gain index
+	NSamples   uint8       `json:"nsamples"`
+}
+
+func (e *PyExperiment) UnmarshalJSON(b []byte) error {
+	type plain PyExperiment
+	p := plain{Period: 100, NPoints: 10, Edge: RISING, PInput: 1, Gain: 1, NSamples: 20}
+	if err := json.Unmarshal(b, &p); err != nil {
+		return err
+	}
+	*e = PyExperiment(p)
+	return nil
+}
+
+// Read the experiments of a python-opendaq script dumped as a JSON array
+func ReadPyExperiments(r io.Reader) ([]PyExperiment, error) {
+	var exps []PyExperiment
+	if err := json.NewDecoder(r).Decode(&exps); err != nil {
+		return nil, err
+	}
+	return exps, nil
+}
+
+// Channel configuration of the experiment
+func (e PyExperiment) channel() (ChannelConfig, error) {
+	cfg := ChannelConfig{Mode: e.Mode, PosInput: e.PInput, NegInput: e.NInput,
+		GainId: e.Gain, NSamples: e.NSamples}
+	if e.Mode > CAPTURE_INPUT {
+		return cfg, ErrPyExperiment
+	}
+	if !e.Continuous {
+		if e.NPoints < 1 || e.NPoints > 65535 {
+			return cfg, ErrInvalidNPoints
+		}
+		cfg.NPoints = uint16(e.NPoints)
+	}
+	return cfg, nil
+}
+
+// Create the stream and external experiments of a python-opendaq script and
+// configure their channels, so they can be started with StartStream or
+// Samples. Like in python-opendaq, the stream experiments take the lowest
+// free numbers and the external ones the number of their clock input.
+// The experiments are checked before creating any of them. Bursts can't be
+// imported along with other experiments: they're run with RunPyBurst.
+func (daq *OpenDAQ) ImportPyExperiments(exps []PyExperiment) error {
+	type experiment struct {
+		n   uint
+		clk ExperimentClock
+		cfg ChannelConfig
+	}
+	var todo []experiment
+	used := make(map[uint]bool)
+	for n := range daq.streams {
+		used[n] = true
+	}
+	for i, e := range exps {
+		cfg, err := e.channel()
+		if err == nil {
+			err = daq.checkChannel(cfg)
+		}
+		if err != nil {
+			return fmt.Errorf("experiment %d: %w", i, err)
+		}
+		ex := experiment{cfg: cfg}
+		switch e.Type {
+		case "stream":
+			ex.n = 1
+			for used[ex.n] {
+				ex.n++
+			}
+			ex.clk = ExperimentClock{Source: INTERNAL_CLOCK, Period: time.Duration(e.Period) * time.Millisecond}
+		case "external":
+			ex.n = e.ClockInput
+			ex.clk = ExperimentClock{Source: EXTERNAL_CLOCK, Edge: e.Edge}
+		default:
+			return fmt.Errorf("experiment %d: %w: type %q", i, ErrPyExperiment, e.Type)
+		}
+		if ex.n < 1 || ex.n > MaxStreams || used[ex.n] {
+			return fmt.Errorf("experiment %d: %w", i, ErrInvalidStream)
+		}
+		used[ex.n] = true
+		todo = append(todo, ex)
+	}
+	for _, ex := range todo {
+		if err := daq.CreateExperiment(ex.n, ex.clk); err != nil {
+			return err
+		}
+		if err := daq.ConfigureChannel(ex.n, ex.cfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run the burst experiment of a python-opendaq script (see Burst)
+func (daq *OpenDAQ) RunPyBurst(e PyExperiment, progress func(done, total int)) ([]float32, error) {
+	if e.Type != "burst" || e.Continuous {
+		return nil, ErrPyExperiment
+	}
+	cfg, err := e.channel()
+	if err != nil {
+		return nil, err
+	}
+	return daq.Burst(cfg, e.NPoints, time.Duration(e.Period)*time.Microsecond, progress)
+}
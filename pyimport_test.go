@@ -0,0 +1,62 @@
+package godaq
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportPyExperiments(t *testing.T) {
+	exps, err := ReadPyExperiments(strings.NewReader(`[
+		{"type": "external", "mode": 0, "clock_input": 1, "edge": 0, "npoints": 5, "pinput": 2},
+		{"type": "stream", "mode": 0, "period": 20, "continuous": true, "pinput": 3, "gain": 2},
+		{"type": "stream", "mode": 2, "period": 5}
+	]`))
+	assert.Nil(t, err)
+	if !assert.Len(t, exps, 3) {
+		return
+	}
+	// Defaults of python-opendaq
+	assert.Equal(t, PyExperiment{Type: "stream", Mode: DIGITAL_INPUT, Period: 5, NPoints: 10,
+		Edge: RISING, PInput: 1, Gain: 1, NSamples: 20}, exps[2])
+
+	daq, sim := newSimDAQ(t, ModelMId)
+	assert.Nil(t, daq.ImportPyExperiments(exps))
+	assert.True(t, sim.streams[1].external)
+	assert.Equal(t, 5, sim.streams[1].nPoints)
+	assert.Equal(t, [5]byte{byte(ANALOG_INPUT), 2, 0, 1, 20}, sim.streams[1].channel)
+	assert.Equal(t, 20*time.Millisecond, daq.streams[2].period)
+	assert.Equal(t, ChannelConfig{ANALOG_INPUT, 3, 0, 2, 20, 0}, daq.streams[2].channel)
+	assert.Equal(t, 5*time.Millisecond, daq.streams[3].period)
+	assert.Equal(t, uint16(10), daq.streams[3].channel.NPoints)
+
+	// Nothing is created if an experiment is invalid
+	daq, sim = newSimDAQ(t, ModelMId)
+	exps[1].Type = "burst"
+	err = daq.ImportPyExperiments(exps)
+	assert.True(t, errors.Is(err, ErrPyExperiment))
+	assert.Empty(t, sim.streams)
+	exps[1].Type = "external"
+	assert.True(t, errors.Is(daq.ImportPyExperiments(exps), ErrInvalidStream))
+	exps[1].Type, exps[1].PInput = "stream", 99
+	assert.True(t, errors.Is(daq.ImportPyExperiments(exps), ErrInvalidInput))
+	assert.Empty(t, sim.streams)
+}
+
+func TestRunPyBurst(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelMId)
+	sim.Inputs = map[uint]Waveform{1: Constant(0.5)}
+	exps, err := ReadPyExperiments(strings.NewReader(`[{"type": "burst", "period": 1000, "npoints": 20}]`))
+	assert.Nil(t, err)
+	points, err := daq.RunPyBurst(exps[0], nil)
+	assert.Nil(t, err)
+	assert.Len(t, points, 20)
+	assert.InDelta(t, 0.5, points[0], 0.05)
+
+	exps[0].Continuous = true
+	_, err = daq.RunPyBurst(exps[0], nil)
+	assert.Equal(t, ErrPyExperiment, err)
+}
@@ -0,0 +1,254 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Priority class of the commands competing for the link to a device
+type Priority uint8
+
+const (
+	INTERACTIVE Priority = iota // User calls (default)
+	SCHEDULED                   // Periodic tasks, e.g. the heartbeat
+	BACKGROUND                  // Loggers and other bulk readings
+	nPriorities
+)
+
+// Number of consecutive commands of higher classes after which a waiting
+// command of a lower class is sent, so it isn't starved
+const fairShare = 8
+
+// Time constant of the average of the busy fraction of the link
+const busyWindow = time.Second
+
+type priorityKey struct{}
+
+// Return a context whose commands are sent with priority p.
+// A command waiting for the link is sent before the commands of lower
+// classes, and in order with the commands of its own class.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+func priorityOf(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok && p < nPriorities {
+		return p
+	}
+	return INTERACTIVE
+}
+
+// Command waiting for the link
+type waiter struct {
+	ready      chan struct{} // Closed when the link is granted or the command superseded
+	key        string        // Target of an output command ("" if it isn't coalesced)
+	superseded bool
+}
+
+// Queue of the commands waiting for the link, served by priority
+type linkQueue struct {
+	mu      sync.Mutex
+	busy    bool
+	waiting [nPriorities][]*waiter
+	// Commands of higher classes sent while each class was waiting
+	starved [nPriorities]int
+
+	maxDepth  int
+	coalesced uint64
+	// Average busy fraction until lastChange
+	busyAvg    float64
+	lastChange time.Time
+}
+
+// Average busy fraction at time t
+func (q *linkQueue) busyAt(t time.Time) float64 {
+	if q.lastChange.IsZero() {
+		return 0
+	}
+	state := 0.0
+	if q.busy {
+		state = 1
+	}
+	alpha := 1 - math.Exp(-float64(t.Sub(q.lastChange))/float64(busyWindow))
+	return q.busyAvg + alpha*(state-q.busyAvg)
+}
+
+// Set the state of the link, updating the average busy fraction
+func (q *linkQueue) setBusy(busy bool) {
+	now := time.Now()
+	q.busyAvg, q.lastChange = q.busyAt(now), now
+	q.busy = busy
+}
+
+// Wait for the link, giving up when ctx is done
+func (q *linkQueue) acquire(ctx context.Context) error {
+	_, err := q.acquireKey(ctx, "")
+	return err
+}
+
+// Wait for the link, giving up when ctx is done. Output commands with the
+// same key are coalesced: a command waiting in the queue is superseded by a
+// newer one of the same class, which takes its place, and it returns
+// without the link (granted is false).
+func (q *linkQueue) acquireKey(ctx context.Context, key string) (granted bool, err error) {
+	p := priorityOf(ctx)
+	q.mu.Lock()
+	if !q.busy {
+		q.setBusy(true)
+		q.mu.Unlock()
+		return true, nil
+	}
+	w := &waiter{ready: make(chan struct{}), key: key}
+	replaced := false
+	if key != "" {
+		for i, old := range q.waiting[p] {
+			if old.key == key {
+				old.superseded = true
+				close(old.ready)
+				q.waiting[p][i] = w
+				q.coalesced++
+				replaced = true
+				break
+			}
+		}
+	}
+	if !replaced {
+		q.waiting[p] = append(q.waiting[p], w)
+	}
+	if n := q.depth(); n > q.maxDepth {
+		q.maxDepth = n
+	}
+	q.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return !w.superseded, nil
+	case <-ctx.Done():
+	}
+	q.mu.Lock()
+	for i, c := range q.waiting[p] {
+		if c == w {
+			q.waiting[p] = append(q.waiting[p][:i], q.waiting[p][i+1:]...)
+			q.mu.Unlock()
+			return false, ctx.Err()
+		}
+	}
+	q.mu.Unlock()
+	if w.superseded {
+		return false, nil
+	}
+	// The link was granted meanwhile
+	q.release()
+	return false, ctx.Err()
+}
+
+// Hand the link over to the next command
+func (q *linkQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	next := nPriorities
+	for p := range q.waiting {
+		if len(q.waiting[p]) == 0 {
+			q.starved[p] = 0
+			continue
+		}
+		if next == nPriorities || q.starved[p] >= fairShare {
+			next = Priority(p)
+		}
+	}
+	if next == nPriorities {
+		q.setBusy(false)
+		return
+	}
+	for p := range q.waiting {
+		if len(q.waiting[p]) != 0 && Priority(p) != next {
+			q.starved[p]++
+		}
+	}
+	q.starved[next] = 0
+	w := q.waiting[next][0]
+	q.waiting[next] = q.waiting[next][1:]
+	close(w.ready)
+}
+
+// Number of commands waiting for the link
+func (q *linkQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.depth()
+}
+
+// Fill the statistics of the queue
+func (q *linkQueue) addStats(st *Stats) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	st.QueueDepth, st.MaxQueueDepth = q.depth(), q.maxDepth
+	st.Busy = q.busyAt(time.Now())
+	st.Coalesced = q.coalesced
+}
+
+func (q *linkQueue) depth() int {
+	n := 0
+	for _, w := range q.waiting {
+		n += len(w)
+	}
+	return n
+}
+
+// Load of the link, sent by WatchLoad when it changes
+type LoadEvent struct {
+	Overloaded bool    // The limits are exceeded
+	QueueDepth int     // Commands waiting for the link
+	Busy       float64 // Average busy fraction of the link
+}
+
+// Check the load of the link every period (1 s if it's 0) and send an event
+// when it starts or stops exceeding the limits: a busy fraction above maxBusy
+// or more than maxDepth commands waiting. The application can then request
+// less, e.g. slowing down a logger. The channel is closed when ctx is done.
+func (daq *OpenDAQ) WatchLoad(ctx context.Context, period time.Duration, maxBusy float64, maxDepth int) <-chan LoadEvent {
+	if period <= 0 {
+		period = time.Second
+	}
+	out := make(chan LoadEvent, 1)
+	go func() {
+		defer close(out)
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+		overloaded := false
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			st := daq.Stats()
+			ev := LoadEvent{st.Busy > maxBusy || st.QueueDepth > maxDepth, st.QueueDepth, st.Busy}
+			if ev.Overloaded == overloaded {
+				continue
+			}
+			overloaded = ev.Overloaded
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
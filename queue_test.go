@@ -0,0 +1,182 @@
+package godaq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Queue a command of priority p, waiting until it's queued. Its name is sent
+// to order when it gets the link, which is released right away.
+func queueCommand(t *testing.T, q *linkQueue, wg *sync.WaitGroup, p Priority, name string, order chan<- string) {
+	n := q.len()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.Nil(t, q.acquire(WithPriority(context.Background(), p)))
+		order <- name
+		q.release()
+	}()
+	for q.len() == n {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLinkQueue(t *testing.T) {
+	var q linkQueue
+	var wg sync.WaitGroup
+	order := make(chan string, 100)
+
+	// Hold the link while the commands are queued
+	assert.Nil(t, q.acquire(context.Background()))
+	queueCommand(t, &q, &wg, BACKGROUND, "b1", order)
+	queueCommand(t, &q, &wg, SCHEDULED, "s1", order)
+	queueCommand(t, &q, &wg, BACKGROUND, "b2", order)
+	queueCommand(t, &q, &wg, INTERACTIVE, "i1", order)
+	queueCommand(t, &q, &wg, INTERACTIVE, "i2", order)
+	q.release()
+	wg.Wait()
+	close(order)
+	var got []string
+	for name := range order {
+		got = append(got, name)
+	}
+	assert.Equal(t, []string{"i1", "i2", "s1", "b1", "b2"}, got)
+	assert.False(t, q.busy)
+
+	// A waiting command can be cancelled
+	assert.Nil(t, q.acquire(context.Background()))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, q.acquire(ctx))
+	assert.Zero(t, q.len())
+	q.release()
+	assert.False(t, q.busy)
+}
+
+func TestLinkQueueFairness(t *testing.T) {
+	var q linkQueue
+	var wg sync.WaitGroup
+	order := make(chan string, 100)
+
+	assert.Nil(t, q.acquire(context.Background()))
+	queueCommand(t, &q, &wg, BACKGROUND, "b", order)
+	for i := 0; i < 2*fairShare; i++ {
+		queueCommand(t, &q, &wg, INTERACTIVE, "i", order)
+	}
+	q.release()
+	wg.Wait()
+	close(order)
+	pos := 0
+	for name := range order {
+		if name == "b" {
+			break
+		}
+		pos++
+	}
+	// The background command isn't starved by the interactive ones
+	assert.Equal(t, fairShare, pos)
+}
+
+func TestPriorityCommands(t *testing.T) {
+	daq, _ := newSimDAQ(t, ModelMId)
+	ctx := WithPriority(context.Background(), BACKGROUND)
+	_, err := daq.ReadAnalogContext(ctx)
+	assert.Nil(t, err)
+
+	// Cancelled while waiting for the link
+	assert.Nil(t, daq.queue.acquire(context.Background()))
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = daq.ReadAnalogContext(ctx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	var opErr *OpError
+	assert.True(t, errors.As(err, &opErr))
+	daq.queue.release()
+}
+
+func TestLoadStats(t *testing.T) {
+	daq, _ := newSimDAQ(t, ModelMId)
+	var wg sync.WaitGroup
+	order := make(chan string, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := daq.WatchLoad(ctx, 5*time.Millisecond, 0.9, 2)
+
+	// Hold the link with 3 commands waiting
+	assert.Nil(t, daq.queue.acquire(context.Background()))
+	for i := 0; i < 3; i++ {
+		queueCommand(t, &daq.queue, &wg, BACKGROUND, "b", order)
+	}
+	st := daq.Stats()
+	assert.Equal(t, 3, st.QueueDepth)
+	assert.Equal(t, 3, st.MaxQueueDepth)
+	ev := <-events
+	assert.True(t, ev.Overloaded)
+	assert.Equal(t, 3, ev.QueueDepth)
+
+	time.Sleep(300 * time.Millisecond)
+	busy := daq.Stats().Busy
+	// 1 - exp(-0.3)
+	assert.InDelta(t, 0.26, busy, 0.1)
+
+	daq.queue.release()
+	wg.Wait()
+	// The event may be sent before the last commands leave the queue
+	ev = <-events
+	assert.False(t, ev.Overloaded)
+	assert.True(t, ev.QueueDepth <= 2)
+	st = daq.Stats()
+	assert.Zero(t, st.QueueDepth)
+	assert.Equal(t, 3, st.MaxQueueDepth)
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, daq.Stats().Busy < busy)
+
+	// The default period is used
+	ctx, cancel = context.WithCancel(context.Background())
+	events = daq.WatchLoad(ctx, 0, 0.9, 2)
+	cancel()
+	for range events {
+	}
+}
+
+func TestCoalescing(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelMId)
+	assert.Nil(t, daq.SetPIODir(2, true))
+	commands := daq.Stats().Commands
+
+	// Updates of the output 1 and the PIO 2 while the link is busy
+	assert.Nil(t, daq.queue.acquire(context.Background()))
+	var wg sync.WaitGroup
+	for i := 1; i <= 5; i++ {
+		wg.Add(2)
+		go func(v float32) {
+			defer wg.Done()
+			assert.Nil(t, daq.SetAnalog(1, v))
+		}(float32(i) / 2)
+		go func(v bool) {
+			defer wg.Done()
+			assert.Nil(t, daq.SetPIO(2, v))
+		}(i%2 == 1)
+		// Wait until both are queued
+		for st := daq.Stats(); st.QueueDepth+int(st.Coalesced) < 2*i; st = daq.Stats() {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	assert.Equal(t, 2, daq.Stats().QueueDepth)
+	daq.queue.release()
+	wg.Wait()
+
+	// Only the latest values are sent
+	st := daq.Stats()
+	assert.EqualValues(t, 8, st.Coalesced)
+	assert.Equal(t, commands+2, st.Commands)
+	assert.InDelta(t, 2.5, sim.features.Dac.toVolts(int(sim.DAC(1))), 0.01)
+	assert.EqualValues(t, sim.DAC(1), daq.dacValues[1])
+	assert.EqualValues(t, 2, sim.Port().Value&2)
+	assert.EqualValues(t, 2, daq.portOut&2)
+}
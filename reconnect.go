@@ -0,0 +1,159 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrNoDialer     = errors.New("Transport can't be reopened")
+	ErrModelChanged = errors.New("Another device model connected")
+)
+
+// State of the connection with the device
+type ConnState uint8
+
+const (
+	CONNECTED ConnState = iota
+	DISCONNECTED
+)
+
+func (s ConnState) String() string {
+	if s == CONNECTED {
+		return "connected"
+	}
+	return "disconnected"
+}
+
+// Settings of StartReconnect
+type ReconnectConfig struct {
+	Interval     time.Duration   // Between checks and reconnection attempts (1 s by default)
+	OnDisconnect func(err error) // Called with the error when the connection is lost
+	OnReconnect  func()          // Called when the connection is recovered
+}
+
+// The connection is lost: the transport fails, or the device doesn't answer
+// several commands in a row. Protocol errors are retried by sendCommand.
+func (daq *OpenDAQ) linkLost() (bool, error) {
+	daq.Lock()
+	defer daq.Unlock()
+	err := daq.lastErr
+	if daq.failures == 0 || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false, nil
+	}
+	if daq.failures >= heartbeatFailures {
+		return true, err
+	}
+	protocol := errors.Is(err, ErrChecksum) || errors.Is(err, ErrInvalidLength) ||
+		errors.Is(err, ErrNakReceived)
+	return !protocol, err
+}
+
+// Monitor the connection and reopen the transport when it's lost, until ctx
+// is done. Once reconnected, the calibration is read again and the
+// configuration is restored (see Restore). The changes of state are sent to
+// the returned channel, after calling the callbacks of cfg.
+// The connection isn't checked while streaming: stop and start the stream
+// again if StreamErr reports an error.
+func (daq *OpenDAQ) StartReconnect(ctx context.Context, cfg ReconnectConfig) (<-chan ConnState, error) {
+	if daq.dial == nil {
+		return nil, ErrNoDialer
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = time.Second
+	}
+	out := make(chan ConnState, 1)
+	send := func(s ConnState) bool {
+		select {
+		case out <- s:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	go func() {
+		defer close(out)
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			lost, err := daq.linkLost()
+			if !lost {
+				continue
+			}
+			daq.Lock()
+			daq.ser.Close()
+			daq.Unlock()
+			if cfg.OnDisconnect != nil {
+				cfg.OnDisconnect(err)
+			}
+			if !send(DISCONNECTED) {
+				return
+			}
+			for daq.reconnect(ctx) != nil {
+				if sleepContext(ctx, cfg.Interval) != nil {
+					return
+				}
+			}
+			if cfg.OnReconnect != nil {
+				cfg.OnReconnect()
+			}
+			if !send(CONNECTED) {
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Open the transport again and restore the state of the device
+func (daq *OpenDAQ) reconnect(ctx context.Context) error {
+	rw, err := daq.dial(ctx)
+	if err != nil {
+		return err
+	}
+	daq.Lock()
+	daq.ser = rw
+	daq.failures, daq.lastErr = 0, nil
+	daq.Unlock()
+
+	err = func() error {
+		info, err := daq.readInfo(ctx)
+		if err != nil {
+			return err
+		}
+		if info.Model != daq.model {
+			return ErrModelChanged
+		}
+		// It may be another unit of the same model
+		daq.Lock()
+		daq.info = info
+		daq.Unlock()
+		if err := daq.readCalibs(ctx); err != nil {
+			return err
+		}
+		return daq.Restore()
+	}()
+	if err != nil {
+		rw.Close()
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+package godaq
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconnect(t *testing.T) {
+	sim, _ := NewSimulator(ModelMId)
+	// The device is connected again after being reset
+	next, _ := NewSimulator(ModelMId)
+	next.Calib = []SimCalib{{0, 64}}
+	dials := 0
+	dial := func(ctx context.Context) (io.ReadWriteCloser, error) {
+		dials++
+		if dials == 1 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return next, nil
+	}
+	daq, err := NewFromTransport(sim, WithDialer(dial))
+	assert.Nil(t, err)
+	assert.Nil(t, daq.ConfigureADC(3, 0, 2, 5))
+	assert.Nil(t, daq.SetAnalog(1, 1.0))
+
+	var lost error
+	reconnected := false
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	states, err := daq.StartReconnect(ctx, ReconnectConfig{
+		Interval:     5 * time.Millisecond,
+		OnDisconnect: func(err error) { lost = err },
+		OnReconnect:  func() { reconnected = true },
+	})
+	assert.Nil(t, err)
+
+	// Cable unplugged
+	sim.Close()
+	_, err = daq.ReadADC()
+	assert.NotNil(t, err)
+	assert.Equal(t, DISCONNECTED, <-states)
+	assert.Equal(t, io.ErrClosedPipe, lost)
+	assert.Equal(t, CONNECTED, <-states)
+	assert.True(t, reconnected)
+	assert.Equal(t, 2, dials)
+
+	// The calibration is read again and the configuration restored
+	assert.Equal(t, Calib{1, 64. / (1 << 16)}, daq.calib[0])
+	assert.Equal(t, sim.DAC(1), next.DAC(1))
+	assert.Nil(t, daq.CheckConfig())
+
+	daq.dial = nil
+	_, err = daq.StartReconnect(ctx, ReconnectConfig{})
+	assert.Equal(t, ErrNoDialer, err)
+}
+
+func TestReconnectConcurrent(t *testing.T) {
+	sim, _ := NewSimulator(ModelMId)
+	next, _ := NewSimulator(ModelMId)
+	next.Calib = []SimCalib{{0, 64}}
+	dial := func(ctx context.Context) (io.ReadWriteCloser, error) {
+		return next, nil
+	}
+	daq, err := NewFromTransport(sim, WithDialer(dial))
+	assert.Nil(t, err)
+	assert.Nil(t, daq.ConfigureADC(3, 0, 2, 5))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	states, err := daq.StartReconnect(ctx, ReconnectConfig{Interval: time.Millisecond})
+	assert.Nil(t, err)
+
+	// The application keeps using the device while it's reconnected
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			daq.ReadAnalog()
+			daq.SetAnalog(1, float32(i%3))
+			daq.SetPIO(1, i%2 == 0)
+		}
+	}()
+	sim.Close()
+	assert.Equal(t, DISCONNECTED, <-states)
+	assert.Equal(t, CONNECTED, <-states)
+	close(stop)
+	<-done
+	assert.Nil(t, daq.CheckConfig())
+	assert.Equal(t, daq.dacValues[1], int(next.DAC(1)))
+}
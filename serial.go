@@ -0,0 +1,29 @@
+//go:build !js && !android
+// +build !js,!android
+
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"io"
+
+	"github.com/tarm/serial"
+)
+
+// Setup and open the serial port
+func openSerial(port string, o options) (io.ReadWriteCloser, error) {
+	serCfg := &serial.Config{Name: port, Baud: o.baud, ReadTimeout: o.readTimeout}
+	return serial.OpenPort(serCfg)
+}
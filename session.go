@@ -0,0 +1,161 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"context"
+	"time"
+)
+
+// Stream experiments delivering their points one by one (see Samples).
+// The delivery, and optionally the acquisition, can be paused and resumed,
+// keeping the configuration of the experiments and the indexes of the points.
+type Session struct {
+	C    <-chan Sample // Closed when the session ends
+	reqs chan pauseRequest
+	done chan struct{}
+}
+
+type pauseRequest struct {
+	pause, stop bool
+	result      chan error
+}
+
+// Start the stream experiments in a session, which ends when ctx is done or
+// when the stream is interrupted by an error (see StreamErr).
+func (daq *OpenDAQ) StartSession(ctx context.Context) (*Session, error) {
+	packets, err := daq.StartStream()
+	if err != nil {
+		return nil, err
+	}
+	periods := make(map[uint]time.Duration)
+	for n, st := range daq.streams {
+		periods[n] = st.period
+	}
+	out := make(chan Sample, 256)
+	s := &Session{C: out, reqs: make(chan pauseRequest), done: make(chan struct{})}
+	go daq.runSession(ctx, s, packets, periods, out)
+	return s, nil
+}
+
+// Pause the delivery of the samples. With stop, the acquisition is stopped
+// too, so other commands can be sent meanwhile. Otherwise the device goes on
+// acquiring, and the points received while paused are discarded (their
+// indexes are skipped).
+// ErrNotStreaming is returned if the session has ended.
+func (s *Session) Pause(stop bool) error {
+	return s.request(pauseRequest{pause: true, stop: stop})
+}
+
+// Resume the delivery, and the acquisition if it was stopped. The indexes of
+// the points go on from the pause, and their times from the restart.
+func (s *Session) Resume() error {
+	return s.request(pauseRequest{})
+}
+
+func (s *Session) request(req pauseRequest) error {
+	req.result = make(chan error, 1)
+	select {
+	case s.reqs <- req:
+		return <-req.result
+	case <-s.done:
+		return ErrNotStreaming
+	}
+}
+
+// Deliver the points of the packets as samples until the session ends
+func (daq *OpenDAQ) runSession(ctx context.Context, s *Session, packets <-chan StreamPacket,
+	periods map[uint]time.Duration, out chan<- Sample) {
+	defer close(s.done)
+	defer close(out)
+
+	// Index and time of the first point of each channel since the (re)start
+	start := time.Now()
+	base, baseIndex, index := make(map[uint]time.Time), make(map[uint]int), make(map[uint]int)
+	for n := range periods {
+		base[n] = start
+	}
+	paused := false
+	stop := func() {
+		if packets != nil {
+			daq.stopDraining(packets)
+		}
+	}
+
+	handle := func(req pauseRequest) {
+		var err error
+		switch {
+		case req.pause && req.stop && packets != nil:
+			err = daq.stopDraining(packets)
+			packets = nil
+		case !req.pause && packets == nil:
+			var p <-chan StreamPacket
+			if p, err = daq.StartStream(); err != nil {
+				req.result <- err
+				return
+			}
+			packets = p
+			now := time.Now()
+			for n := range periods {
+				base[n], baseIndex[n] = now, index[n]
+			}
+		}
+		paused = req.pause
+		req.result <- err
+	}
+	// Send a sample unless paused, false if ctx is done
+	send := func(smp Sample) bool {
+		for !paused {
+			select {
+			case out <- smp:
+				return true
+			case req := <-s.reqs:
+				handle(req)
+			case <-ctx.Done():
+				stop()
+				return false
+			}
+		}
+		return true
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			stop()
+			return
+		case req := <-s.reqs:
+			handle(req)
+		case pkt, ok := <-packets:
+			if !ok {
+				daq.StopStream()
+				return
+			}
+			n := pkt.Stream
+			for i, raw := range pkt.Raw {
+				smp := Sample{Channel: n, Index: index[n], Raw: raw, Time: time.Now()}
+				if period := periods[n]; period != 0 {
+					smp.Time = base[n].Add(time.Duration(index[n]-baseIndex[n]) * period)
+				}
+				if pkt.Volts != nil {
+					smp.Volts = pkt.Volts[i]
+				}
+				index[n]++
+				if !send(smp) {
+					return
+				}
+			}
+		}
+	}
+}
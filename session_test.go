@@ -0,0 +1,61 @@
+package godaq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Read the samples buffered by the session and return the last one
+func drainSession(s *Session, last Sample) Sample {
+	for {
+		select {
+		case smp := <-s.C:
+			last = smp
+		case <-time.After(20 * time.Millisecond):
+			return last
+		}
+	}
+}
+
+func TestSession(t *testing.T) {
+	daq, _ := newSimDAQ(t, ModelMId)
+	assert.Nil(t, daq.CreateStream(1, time.Millisecond))
+	assert.Nil(t, daq.ConfigureChannel(1, ChannelConfig{Mode: ANALOG_INPUT, PosInput: 1}))
+	ctx, cancel := context.WithCancel(context.Background())
+	s, err := daq.StartSession(ctx)
+	assert.Nil(t, err)
+	first := <-s.C
+	assert.Equal(t, 0, first.Index)
+	smp := <-s.C
+	assert.Equal(t, 1, smp.Index)
+	assert.Equal(t, time.Millisecond, smp.Time.Sub(first.Time))
+
+	// The points acquired while paused are skipped
+	assert.Nil(t, s.Pause(false))
+	last := drainSession(s, smp)
+	time.Sleep(30 * time.Millisecond)
+	assert.Nil(t, s.Resume())
+	smp = <-s.C
+	assert.True(t, smp.Index > last.Index+20, "%d after %d", smp.Index, last.Index)
+	assert.Equal(t, time.Duration(smp.Index)*time.Millisecond, smp.Time.Sub(first.Time))
+
+	// The acquisition is stopped, so other commands can be sent
+	assert.Nil(t, s.Pause(true))
+	last = drainSession(s, smp)
+	_, err = daq.ReadAnalog()
+	assert.Nil(t, err)
+	resumed := time.Now()
+	assert.Nil(t, s.Resume())
+	smp = <-s.C
+	assert.Equal(t, last.Index+1, smp.Index)
+	assert.False(t, smp.Time.Before(resumed))
+
+	cancel()
+	for range s.C {
+	}
+	assert.Equal(t, ErrNotStreaming, s.Pause(false))
+	assert.Nil(t, daq.StreamErr())
+}
@@ -0,0 +1,621 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Fault injected by the Simulator in the response to a command
+type Fault uint8
+
+const (
+	NO_FAULT       Fault = iota
+	FAULT_NAK            // Answer with a NAK
+	FAULT_CHECKSUM       // Corrupt the checksum of the response
+	FAULT_TIMEOUT        // Don't answer
+)
+
+// Digital signal at the counter input of a simulated device
+type PulseTrain struct {
+	Frequency float64 // Hz (0 for no pulses)
+	Duty      float64 // Fraction of the period in high state
+}
+
+// Raw value of a calibration register
+type SimCalib struct {
+	Gain, Offset int16
+}
+
+type simStream struct {
+	period   time.Duration // 0 for external experiments
+	channel  [5]byte       // Mode, PosInput, NegInput, GainId, NSamples
+	nPoints  int
+	sent     int
+	next     time.Time
+	external bool
+}
+
+// The experiment has points left to send periodically
+func (st *simStream) active() bool {
+	return !st.external && st.period > 0 && (st.nPoints == 0 || st.sent < st.nPoints)
+}
+
+// Simulated openDAQ implementing the serial protocol in-process, to test
+// applications without hardware. Use it as the transport of NewFromTransport.
+// The exported fields must be set before using the simulator.
+// The readings are ideal: the calibration registers are reported to the
+// library but they are not applied to the simulated signals.
+type Simulator struct {
+	Model   uint8
+	Version uint8
+	Serial  uint32
+	Calib   []SimCalib // Missing registers are 0 (no correction)
+	// Voltage at each analog input (0 V if missing)
+	Inputs map[uint]Waveform
+	// Analog output wired to each analog input (it overrides Inputs)
+	Loopback map[uint]uint
+	// PIO wired to each PIO: an input reads the level of the PIO wired to it
+	// when that one is an output (it overrides SetPIOInputs)
+	PIOWires map[uint]uint
+	// Signal at the counter/capture input
+	TimerInput PulseTrain
+	// PIO wired to the counter input (0 for none): its rising edges are
+	// counted too
+	CounterWire uint
+	// Delay of the responses: Latency, or the one of the command in
+	// Latencies, plus a random delay up to Jitter. The responses keep their
+	// order, and those later than the read timeout (100 ms) arrive after it
+	// like late responses of a device.
+	Latency, Jitter time.Duration
+	Latencies       map[CommandNumber]time.Duration
+	// Called with each command to inject faults (nil for none)
+	Faults func(cmd CommandNumber) Fault
+	// Commands of firmware extensions (they override the standard ones).
+	// Each one returns the response body, or false to answer with a NAK.
+	Commands map[CommandNumber]func(body []byte) ([]byte, bool)
+
+	mu       sync.Mutex
+	features HwFeatures
+	start    time.Time
+	in, out  bytes.Buffer
+	closed   bool
+	pending  []simResponse // Responses delayed by the latency
+	rnd      *rand.Rand
+
+	adc              ADCConfig
+	dac              map[uint]int16
+	leds             map[uint]Color
+	portDir, portOut uint8
+	pioInputs        uint8
+	counterStart     time.Time
+	counterEdges     int
+	streams          map[uint8]*simStream
+	streaming        bool
+	// Signal buffer played by the ANALOG_OUTPUT stream channels
+	signal []int16
+}
+
+type simResponse struct {
+	due  time.Time
+	data []byte
+}
+
+// Read timeout of the simulated serial port
+const simReadTimeout = 100 * time.Millisecond
+
+// Create a simulator of the given model (e.g. ModelMId)
+func NewSimulator(model uint8) (*Simulator, error) {
+	hw, ok := GetModel(model)
+	if !ok {
+		return nil, ErrUnknownModel
+	}
+	s := &Simulator{Model: model, Version: 1, features: hw.GetFeatures(), start: time.Now(),
+		rnd: rand.New(rand.NewSource(1))}
+	s.reset()
+	return s, nil
+}
+
+// Clear the volatile state, as a reset of the device does
+func (s *Simulator) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reset()
+}
+
+func (s *Simulator) reset() {
+	s.adc = ADCConfig{}
+	s.dac = make(map[uint]int16)
+	s.leds = make(map[uint]Color)
+	s.portDir, s.portOut = 0, 0
+	s.counterStart, s.counterEdges = time.Time{}, 0
+	s.streams = make(map[uint8]*simStream)
+	s.streaming = false
+	s.signal = nil
+	s.in.Reset()
+	s.out.Reset()
+	s.pending = nil
+}
+
+// Set the level of the PIOs configured as inputs (PIO n is bit n-1)
+func (s *Simulator) SetPIOInputs(value uint8) {
+	s.mu.Lock()
+	s.pioInputs = value
+	s.mu.Unlock()
+}
+
+// Return the raw value of the DAC at output n
+func (s *Simulator) DAC(n uint) int16 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dac[n]
+}
+
+// Return the color of the LED n
+func (s *Simulator) LED(n uint) Color {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.leds[n]
+}
+
+// Return the direction and the output value of the PIOs
+func (s *Simulator) Port() PortState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return PortState{s.portDir, s.portOut}
+}
+
+// Receive commands
+func (s *Simulator) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0, io.ErrClosedPipe
+	}
+	s.in.Write(p)
+	for s.in.Len() >= 4 {
+		b := s.in.Bytes()
+		n := 4 + int(b[3])
+		if len(b) < n {
+			break
+		}
+		s.handle(s.in.Next(n))
+	}
+	return len(p), nil
+}
+
+// Read the responses and the stream data.
+// Like a serial port with a read timeout, it returns no data when there's
+// nothing to send.
+func (s *Simulator) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0, io.EOF
+	}
+	s.emit(time.Now())
+	if s.out.Len() == 0 && (s.streaming || len(s.pending) != 0) {
+		// Wait for the next point or response, up to the read timeout
+		wait := simReadTimeout
+		for _, st := range s.streams {
+			if d := time.Until(st.next); s.streaming && st.active() && d < wait {
+				wait = d
+			}
+		}
+		if len(s.pending) != 0 {
+			if d := time.Until(s.pending[0].due); d < wait {
+				wait = d
+			}
+		}
+		s.mu.Unlock()
+		time.Sleep(wait)
+		s.mu.Lock()
+		s.emit(time.Now())
+	}
+	return s.out.Read(p)
+}
+
+// Send the responses and the stream points due at time now
+func (s *Simulator) emit(now time.Time) {
+	for len(s.pending) != 0 && !now.Before(s.pending[0].due) {
+		s.out.Write(s.pending[0].data)
+		s.pending = s.pending[1:]
+	}
+	if s.out.Len() == 0 && s.streaming {
+		s.emitStreams(now)
+	}
+}
+
+// Discard the received responses. Those delayed by the latency are still
+// on their way, so they are kept.
+func (s *Simulator) Flush() error {
+	s.mu.Lock()
+	s.out.Reset()
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Simulator) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	return nil
+}
+
+// Answer a command
+func (s *Simulator) handle(data []byte) {
+	cmd := CommandNumber(data[2])
+	body := data[4:]
+	fault := NO_FAULT
+	if s.Faults != nil {
+		fault = s.Faults(cmd)
+	}
+	if binary.BigEndian.Uint16(data) != checksum(data[2:]) {
+		fault = FAULT_NAK
+	}
+	delay := s.Latency
+	if d, ok := s.Latencies[cmd]; ok {
+		delay = d
+	}
+	if s.Jitter > 0 {
+		delay += time.Duration(s.rnd.Int63n(int64(s.Jitter)))
+	}
+	if s.streaming && cmd != STREAM_STOP {
+		return
+	}
+
+	resp, ok := s.execute(cmd, body)
+	if !ok {
+		fault = FAULT_NAK
+	}
+	switch fault {
+	case FAULT_TIMEOUT:
+		return
+	case FAULT_NAK:
+		// Keep the expected length, so the NAK is detected
+		resp = nil
+		if n := cmd.RespLen(); n > 0 {
+			resp = make([]byte, n)
+		}
+		cmd = nak
+	}
+	b, _ := (&Message{cmd, resp}).Marshal()
+	if fault == FAULT_CHECKSUM {
+		b[1] ^= 0xff
+	}
+	if delay <= 0 && len(s.pending) == 0 {
+		s.out.Write(b)
+		return
+	}
+	due := time.Now().Add(delay)
+	if n := len(s.pending); n != 0 && due.Before(s.pending[n-1].due) {
+		due = s.pending[n-1].due
+	}
+	s.pending = append(s.pending, simResponse{due, b})
+}
+
+// Execute a command and return the body of its response
+func (s *Simulator) execute(cmd CommandNumber, body []byte) ([]byte, bool) {
+	if f, ok := s.Commands[cmd]; ok {
+		return f(body)
+	}
+	switch cmd {
+	case ID_CONFIG:
+		return append([]byte{s.Model, s.Version}, toBytes(s.Serial)...), true
+	case GET_CALIB:
+		var cal SimCalib
+		if len(body) < 1 {
+			return nil, false
+		}
+		if int(body[0]) < len(s.Calib) {
+			cal = s.Calib[body[0]]
+		}
+		return append([]byte{body[0]}, toBytes(cal)...), true
+	case SET_CALIB:
+		if len(body) < 5 {
+			return nil, false
+		}
+		for int(body[0]) >= len(s.Calib) {
+			s.Calib = append(s.Calib, SimCalib{})
+		}
+		s.Calib[body[0]] = SimCalib{int16(binary.BigEndian.Uint16(body[1:])),
+			int16(binary.BigEndian.Uint16(body[3:]))}
+		return body[:5], true
+	case AIN_CFG:
+		if len(body) < 4 {
+			return nil, false
+		}
+		s.adc = ADCConfig{uint(body[0]), uint(body[1]), uint(body[2]), body[3]}
+		return append(toBytes(s.readADC(s.adc)), body[:4]...), true
+	case GET_AIN_CFG:
+		return append(toBytes(s.readADC(s.adc)), byte(s.adc.PosInput), byte(s.adc.NegInput),
+			byte(s.adc.GainId), s.adc.NSamples), true
+	case AIN:
+		return toBytes(s.readADC(s.adc)), true
+	case SET_DAC:
+		if len(body) < 3 {
+			return nil, false
+		}
+		s.dac[uint(body[2])] = int16(binary.BigEndian.Uint16(body))
+		return body[:3], true
+	case LED_W:
+		if len(body) < 2 {
+			return nil, false
+		}
+		s.leds[uint(body[1])] = Color(body[0])
+		return body[:2], true
+	case PIO:
+		if len(body) < 1 || body[0] < 1 || body[0] > 8 {
+			return nil, false
+		}
+		bit := uint8(1) << (body[0] - 1)
+		if len(body) > 1 {
+			prev := s.pins()
+			s.portOut = s.portOut&^bit | body[1]<<(body[0]-1)
+			s.countEdge(prev)
+		}
+		return []byte{body[0], boolToByte(s.pins()&bit != 0)}, true
+	case PIO_DIR:
+		if len(body) < 2 || body[0] < 1 || body[0] > 8 {
+			return nil, false
+		}
+		bit := uint8(1) << (body[0] - 1)
+		s.portDir = s.portDir&^bit | body[1]<<(body[0]-1)
+		return body[:2], true
+	case PORT:
+		if len(body) > 0 {
+			prev := s.pins()
+			s.portOut = body[0]
+			s.countEdge(prev)
+		}
+		return []byte{s.pins()}, true
+	case PORT_DIR:
+		if len(body) > 0 {
+			s.portDir = body[0]
+		}
+		return []byte{s.portDir}, true
+	case COUNTER_INIT, CAPTURE_INIT:
+		s.counterStart, s.counterEdges = time.Now(), 0
+		return body, len(body) == cmd.RespLen()
+	case GET_COUNTER:
+		if len(body) < 1 {
+			return nil, false
+		}
+		var count uint16
+		if !s.counterStart.IsZero() {
+			count = uint16(time.Since(s.counterStart).Seconds()*s.TimerInput.Frequency) +
+				uint16(s.counterEdges)
+		}
+		if body[0] != 0 {
+			s.counterStart, s.counterEdges = time.Now(), 0
+		}
+		return toBytes(count), true
+	case GET_CAPTURE:
+		if len(body) < 1 {
+			return nil, false
+		}
+		var us float64
+		if f := s.TimerInput.Frequency; f > 0 {
+			us = 1e6 / f
+			switch CaptureMode(body[0]) {
+			case CAPTURE_HIGH:
+				us *= s.TimerInput.Duty
+			case CAPTURE_LOW:
+				us *= 1 - s.TimerInput.Duty
+			}
+		}
+		return append([]byte{body[0]}, toBytes(uint32(us))...), true
+	case CAPTURE_STOP, STREAM_START, STREAM_STOP:
+		return s.streamControl(cmd), true
+	case STREAM_CREATE:
+		if len(body) < 3 {
+			return nil, false
+		}
+		period := time.Duration(binary.BigEndian.Uint16(body[1:])) * time.Millisecond
+		s.streams[body[0]] = &simStream{period: period}
+		return body[:3], true
+	case BURST_CREATE:
+		if len(body) < 2 {
+			return nil, false
+		}
+		period := time.Duration(binary.BigEndian.Uint16(body)) * time.Microsecond
+		s.streams[1] = &simStream{period: period}
+		return body[:2], true
+	case EXTERNAL_CREATE:
+		if len(body) < 2 {
+			return nil, false
+		}
+		s.streams[body[0]] = &simStream{external: true}
+		return body[:2], true
+	case LOAD_SIGNAL:
+		// Chunk of the signal buffer: the chunk at offset 0 starts a new signal.
+		// The response holds the number of points loaded and the offset.
+		if len(body) < 4 || len(body)%2 != 0 {
+			return nil, false
+		}
+		offs := int(binary.BigEndian.Uint16(body))
+		if offs == 0 {
+			s.signal = s.signal[:0]
+		}
+		if offs != len(s.signal) || offs+(len(body)-2)/2 > MaxSignalPoints {
+			return nil, false
+		}
+		for i := 2; i < len(body); i += 2 {
+			s.signal = append(s.signal, int16(binary.BigEndian.Uint16(body[i:])))
+		}
+		return append(toBytes(uint16(len(body)-2)/2), body[:2]...), true
+	case CHANNEL_CFG:
+		if len(body) < 6 {
+			return nil, false
+		}
+		st, ok := s.streams[body[0]]
+		if !ok {
+			return nil, false
+		}
+		copy(st.channel[:], body[1:6])
+		return body[:6], true
+	case CHANNEL_SETUP:
+		if len(body) < 4 {
+			return nil, false
+		}
+		st, ok := s.streams[body[0]]
+		if !ok {
+			return nil, false
+		}
+		st.nPoints = int(binary.BigEndian.Uint16(body[1:]))
+		return body[:4], true
+	case CHANNEL_DESTROY:
+		if len(body) < 1 {
+			return nil, false
+		}
+		delete(s.streams, body[0])
+		return body[:1], true
+	}
+	return nil, false
+}
+
+// Start or stop the experiments
+func (s *Simulator) streamControl(cmd CommandNumber) []byte {
+	switch cmd {
+	case CAPTURE_STOP:
+		s.counterStart = time.Time{}
+	case STREAM_START:
+		now := time.Now()
+		for _, st := range s.streams {
+			st.sent, st.next = 0, now.Add(st.period)
+		}
+		s.streaming = true
+	case STREAM_STOP:
+		// The points due before the stop were already sent by the firmware
+		if s.streaming {
+			s.emitStreams(time.Now())
+		}
+		s.streaming = false
+	}
+	return nil
+}
+
+// Level of the PIOs: the output value for the outputs and the simulated
+// levels for the inputs
+func (s *Simulator) pins() uint8 {
+	inputs := s.pioInputs
+	for n, m := range s.PIOWires {
+		if bit := uint8(1) << (m - 1); s.portDir&bit != 0 {
+			inputs = inputs&^(1<<(n-1)) | (s.portOut&bit)>>(m-1)<<(n-1)
+		}
+	}
+	return s.portOut&s.portDir | inputs&^s.portDir
+}
+
+// Voltage at the analog input n
+func (s *Simulator) input(n uint) float32 {
+	if out, ok := s.Loopback[n]; ok {
+		return s.features.Dac.toVolts(int(s.dac[out]))
+	}
+	if w, ok := s.Inputs[n]; ok {
+		return w(time.Since(s.start))
+	}
+	return 0
+}
+
+// Read the simulated inputs with the given configuration
+func (s *Simulator) readADC(cfg ADCConfig) int16 {
+	v := s.input(cfg.PosInput)
+	if cfg.NegInput != 0 {
+		v -= s.input(cfg.NegInput)
+	}
+	gainId := cfg.GainId
+	if gainId >= uint(len(s.features.Adc.Gains)) {
+		gainId = 0
+	}
+	return int16(s.features.Adc.fromVolts(v, gainId))
+}
+
+// Count a rising edge of the PIO wired to the counter input
+func (s *Simulator) countEdge(prev uint8) {
+	if s.CounterWire == 0 || s.counterStart.IsZero() {
+		return
+	}
+	bit := uint8(1) << (s.CounterWire - 1)
+	if prev&bit == 0 && s.pins()&bit != 0 {
+		s.counterEdges++
+	}
+}
+
+// Send the points of the stream experiments due at time now, in time order.
+// The experiments due at the same time are handled in order of their number.
+func (s *Simulator) emitStreams(now time.Time) {
+	for {
+		var n uint8
+		var st *simStream
+		for m, e := range s.streams {
+			if e.active() && !now.Before(e.next) && (st == nil || e.next.Before(st.next) ||
+				e.next.Equal(st.next) && m < n) {
+				n, st = m, e
+			}
+		}
+		if st == nil {
+			return
+		}
+		s.emitPoint(n, st)
+		st.sent++
+		st.next = st.next.Add(st.period)
+	}
+}
+
+// Acquire or play a point of the experiment n
+func (s *Simulator) emitPoint(n uint8, st *simStream) {
+	var value int16
+	switch ChannelMode(st.channel[0]) {
+	case ANALOG_OUTPUT:
+		if len(s.signal) != 0 {
+			s.dac[uint(st.channel[1])] = s.signal[st.sent%len(s.signal)]
+		}
+		return
+	case ANALOG_INPUT:
+		// The ADC is left configured for the channel, like in the firmware
+		s.adc = ADCConfig{uint(st.channel[1]), uint(st.channel[2]), uint(st.channel[3]), st.channel[4]}
+		value = s.readADC(s.adc)
+	case DIGITAL_INPUT:
+		value = int16(s.pins())
+	}
+	s.out.Write(streamFrame(n, value))
+}
+
+// Build the frame of a stream packet
+func streamFrame(n uint8, values ...int16) []byte {
+	b := make([]byte, streamHeaderLen, streamHeaderLen+2*len(values))
+	b[2] = byte(STREAM_DATA)
+	b[3] = byte(streamHeaderLen - 4 + 2*len(values))
+	b[4] = n
+	for _, v := range values {
+		b = append(b, toBytes(v)...)
+	}
+	binary.BigEndian.PutUint16(b, checksum(b[2:]))
+
+	frame := []byte{frameStart}
+	for _, c := range b {
+		if c == frameStart || c == frameEscape {
+			frame = append(frame, frameEscape, c^0x20)
+		} else {
+			frame = append(frame, c)
+		}
+	}
+	return frame
+}
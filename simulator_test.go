@@ -0,0 +1,144 @@
+package godaq
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulatorFaults(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelMId)
+	faults := []Fault{FAULT_NAK, FAULT_CHECKSUM, FAULT_TIMEOUT}
+	sim.Faults = func(cmd CommandNumber) Fault {
+		if len(faults) == 0 {
+			return NO_FAULT
+		}
+		f := faults[0]
+		faults = faults[1:]
+		return f
+	}
+	before := daq.Stats()
+	_, err := daq.ReadADC()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 3, daq.Stats().Retries-before.Retries)
+
+	sim.Faults = func(CommandNumber) Fault { return FAULT_NAK }
+	_, err = daq.ReadADC()
+	assert.True(t, errors.Is(err, ErrNakReceived))
+
+	sim.Faults = func(CommandNumber) Fault { return FAULT_TIMEOUT }
+	_, err = daq.ReadADC()
+	var opErr *OpError
+	assert.True(t, errors.As(err, &opErr))
+	assert.True(t, opErr.Timeout())
+	assert.Equal(t, 8, opErr.Attempts)
+	assert.Equal(t, "AIN: Invalid message length: response timeout (8 attempts)", err.Error())
+}
+
+func TestSimulatorPIO(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelSId)
+	sim.SetPIOInputs(0x02)
+	assert.Nil(t, daq.SetPIODir(1, true))
+	assert.Nil(t, daq.SetPIO(1, true))
+
+	v, err := daq.ReadPIO(2)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, v)
+	port, err := daq.ReadPort()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0x03, port)
+}
+
+func TestSimulatorCapture(t *testing.T) {
+	sim, _ := NewSimulator(ModelMId)
+	sim.TimerInput = PulseTrain{Frequency: 1000, Duty: 0.25}
+	daq, _ := NewFromTransport(sim)
+
+	assert.Nil(t, daq.InitCapture(time.Millisecond))
+	high, err := daq.ReadCapture(CAPTURE_HIGH)
+	assert.Nil(t, err)
+	assert.Equal(t, 250*time.Microsecond, high)
+	f, err := daq.ReadFrequency()
+	assert.Nil(t, err)
+	assert.InDelta(t, 1000, f, 1e-9)
+	assert.Nil(t, daq.StopCapture())
+}
+
+func TestSimulatorStream(t *testing.T) {
+	sim, _ := NewSimulator(ModelMId)
+	sim.Inputs = map[uint]Waveform{2: Constant(0.5)}
+	daq, _ := NewFromTransport(sim)
+
+	assert.Nil(t, daq.CreateStream(1, 5*time.Millisecond))
+	assert.Nil(t, daq.ConfigureChannel(1, ChannelConfig{Mode: ANALOG_INPUT,
+		PosInput: 2, GainId: 1, NSamples: 1}))
+	data, err := daq.StartStream()
+	assert.Nil(t, err)
+	for i := 0; i < 5; i++ {
+		pkt := <-data
+		assert.EqualValues(t, 1, pkt.Stream)
+		assert.InDelta(t, 0.5, pkt.Volts[0], 0.001)
+	}
+	assert.Nil(t, daq.stopDraining(data))
+	assert.Nil(t, daq.DestroyStream(1))
+}
+
+func TestSimulatorBurst(t *testing.T) {
+	sim, _ := NewSimulator(ModelMId)
+	sim.Inputs = map[uint]Waveform{1: Sine(1, 100, 0)}
+	daq, _ := NewFromTransport(sim)
+
+	points, err := daq.Burst(ChannelConfig{Mode: ANALOG_INPUT, PosInput: 1, GainId: 1},
+		20, time.Millisecond, nil)
+	assert.Nil(t, err)
+	assert.Len(t, points, 20)
+	for _, v := range points {
+		assert.InDelta(t, 0, v, 1.001)
+	}
+}
+
+func TestSimulatorShortBodies(t *testing.T) {
+	sim, _ := NewSimulator(ModelMId)
+	for cmd := 0; cmd < 256; cmd++ {
+		for n := 0; n < 3; n++ {
+			// Stream 0 exists, so the length checks come first
+			sim.streams[0] = &simStream{}
+			assert.NotPanics(t, func() { sim.execute(CommandNumber(cmd), make([]byte, n)) },
+				"command %d with a body of %d bytes", cmd, n)
+		}
+	}
+
+	// A frame with an empty body is rejected
+	_, err := sim.Write([]byte{0, byte(CHANNEL_CFG), byte(CHANNEL_CFG), 0})
+	assert.Nil(t, err)
+	resp := make([]byte, 16)
+	n, _ := sim.Read(resp)
+	if assert.True(t, n > 2) {
+		assert.EqualValues(t, nak, resp[2])
+	}
+}
+
+func TestSimulatorLatency(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelMId)
+	sim.Latency = 5 * time.Millisecond
+	sim.Jitter = 2 * time.Millisecond
+	sim.Latencies = map[CommandNumber]time.Duration{LED_W: 0}
+	for i := 0; i < 10; i++ {
+		_, err := daq.ReadADC()
+		assert.Nil(t, err)
+		tm := daq.LastTiming()
+		assert.True(t, tm.Received.Sub(tm.Sent) >= 5*time.Millisecond)
+		assert.True(t, tm.Received.Sub(tm.Sent) < 50*time.Millisecond)
+	}
+	assert.Nil(t, daq.SetLED(1, GREEN))
+	tm := daq.LastTiming()
+	assert.True(t, tm.Received.Sub(tm.Sent) < 5*time.Millisecond)
+
+	// A response later than the read timeout
+	daq, sim = newSimDAQ(t, ModelMId, WithRetries(1))
+	sim.Latencies = map[CommandNumber]time.Duration{AIN: 150 * time.Millisecond}
+	_, err := daq.ReadADC()
+	assert.True(t, errors.Is(err, ErrTimeout))
+}
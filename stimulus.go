@@ -0,0 +1,158 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Stream experiments used by StimulusResponse in hardware
+const (
+	stimulusStream = 1
+	responseStream = 2
+)
+
+// Paired stimulus and response of a system: Response[i] was read right after
+// writing Stimulus[i]
+type StimulusResponse struct {
+	Stimulus []float32       // Voltages written to the output
+	Response []float32       // Voltages read from the input
+	Times    []time.Duration // Time of each reading since the start
+}
+
+// Write each point of stimulus to output n and read the input selected with
+// ConfigureADC right after it, one point every period.
+// When possible, the stimulus is played by the firmware from its signal
+// buffer while a stream experiment reads the input at the same period: there
+// must be no stream experiments, the period must be valid for them (see
+// StreamPeriod), the stimulus must fit in MaxSignalPoints and the firmware
+// must accept the buffer. Then the tare of the input is applied to the
+// readings, but not its filter or host averaging.
+// Otherwise both channels are polled from the host and the period must be at
+// least 2*MinSoftwarePeriod. The points are never skipped: if the host falls
+// behind, the next point is played immediately.
+// When ctx is done, the pairs acquired so far are returned with the error of
+// ctx.
+func (daq *OpenDAQ) StimulusResponse(ctx context.Context, n uint, stimulus []float32,
+	period time.Duration) (StimulusResponse, error) {
+	sr := StimulusResponse{
+		Stimulus: make([]float32, 0, len(stimulus)),
+		Response: make([]float32, 0, len(stimulus)),
+		Times:    make([]time.Duration, 0, len(stimulus)),
+	}
+	if err := daq.stimulusStreams(ctx, n, stimulus, period, &sr); !errors.Is(err, errNoHardware) {
+		return sr, err
+	}
+	if period < 2*MinSoftwarePeriod {
+		return sr, ErrInvalidPeriod
+	}
+	start := time.Now()
+	for i, v := range stimulus {
+		if err := sleepContext(ctx, time.Until(start.Add(time.Duration(i)*period))); err != nil {
+			return sr, err
+		}
+		if err := daq.SetAnalog(n, v); err != nil {
+			return sr, err
+		}
+		resp, err := daq.ReadAnalog()
+		if err != nil {
+			return sr, err
+		}
+		sr.Stimulus = append(sr.Stimulus, v)
+		sr.Response = append(sr.Response, resp)
+		sr.Times = append(sr.Times, daq.lastReadTiming().Mid().Sub(start))
+	}
+	return sr, nil
+}
+
+// Play the stimulus with the stream-out of the firmware while a stream
+// experiment reads the input. errNoHardware is returned if it's not possible.
+func (daq *OpenDAQ) stimulusStreams(ctx context.Context, n uint, stimulus []float32,
+	period time.Duration, sr *StimulusResponse) error {
+	if len(daq.streams) != 0 || len(stimulus) == 0 || len(stimulus) > MaxSignalPoints {
+		return errNoHardware
+	}
+	if actual, err := daq.StreamPeriod(period); err != nil || actual != period {
+		return errNoHardware
+	}
+	payload := make([]byte, 0, 2*len(stimulus))
+	for _, v := range stimulus {
+		raw, err := daq.voltsToDac(v, n)
+		if err != nil {
+			return err
+		}
+		payload = append(payload, toBytes(int16(raw))...)
+	}
+
+	nPoints := uint16(len(stimulus))
+	defer daq.DestroyStream(stimulusStream)
+	defer daq.DestroyStream(responseStream)
+	if err := daq.CreateStream(stimulusStream, period); err != nil {
+		return err
+	}
+	err := daq.ConfigureChannel(stimulusStream, ChannelConfig{Mode: ANALOG_OUTPUT,
+		PosInput: n, NPoints: nPoints})
+	if err != nil {
+		return err
+	}
+	if err := daq.CreateStream(responseStream, period); err != nil {
+		return err
+	}
+	err = daq.ConfigureChannel(responseStream, ChannelConfig{Mode: ANALOG_INPUT,
+		PosInput: daq.posInput, NegInput: daq.negInput, GainId: daq.gainId,
+		NSamples: daq.nSamples, NPoints: nPoints})
+	if err != nil {
+		return err
+	}
+	if err := daq.loadSignal(payload); err != nil {
+		return err
+	}
+
+	tare := daq.GetTare(daq.posInput, daq.negInput)
+	packets, err := daq.StartStream()
+	if err != nil {
+		return err
+	}
+	timeout := time.After(time.Duration(nPoints)*period + 5*time.Second)
+	for len(sr.Response) < len(stimulus) {
+		select {
+		case pkt, ok := <-packets:
+			if !ok {
+				if err := daq.StopStream(); err != nil {
+					return err
+				}
+				return ErrNotStreaming
+			}
+			if pkt.Stream != responseStream {
+				continue
+			}
+			for _, v := range pkt.Volts {
+				if i := len(sr.Response); i < len(stimulus) {
+					sr.Stimulus = append(sr.Stimulus, stimulus[i])
+					sr.Response = append(sr.Response, v-tare)
+					sr.Times = append(sr.Times, time.Duration(i)*period)
+				}
+			}
+		case <-timeout:
+			daq.stopDraining(packets)
+			return ErrTimeout
+		case <-ctx.Done():
+			daq.stopDraining(packets)
+			return ctx.Err()
+		}
+	}
+	return daq.stopDraining(packets)
+}
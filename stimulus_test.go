@@ -0,0 +1,52 @@
+package godaq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStimulusResponse(t *testing.T) {
+	sim, _ := NewSimulator(ModelMId)
+	sim.Loopback = map[uint]uint{3: 1}
+	daq, _ := NewFromTransport(sim)
+	assert.Nil(t, daq.ConfigureADC(3, 0, 1, 1))
+
+	// Played by the firmware
+	stimulus := []float32{0, 0.5, 1, 1.5, 1, 0.5}
+	sr, err := daq.StimulusResponse(context.Background(), 1, stimulus, 10*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Equal(t, stimulus, sr.Stimulus)
+	for i, v := range sr.Response {
+		assert.InDelta(t, stimulus[i], v, 0.002)
+	}
+	if assert.Len(t, sr.Times, len(stimulus)) {
+		assert.Equal(t, 50*time.Millisecond, sr.Times[5])
+	}
+	assert.Empty(t, daq.streams)
+	_, err = daq.StimulusResponse(context.Background(), 1, stimulus, time.Millisecond)
+	assert.Nil(t, err)
+
+	// Polled from the host, since the period isn't valid for the streams
+	sr, err = daq.StimulusResponse(context.Background(), 1, stimulus, 10500*time.Microsecond)
+	assert.Nil(t, err)
+	assert.Equal(t, stimulus, sr.Stimulus)
+	assert.Len(t, sr.Times, len(stimulus))
+	for i, v := range sr.Response {
+		assert.InDelta(t, stimulus[i], v, 0.002)
+	}
+	for i := 1; i < len(sr.Times); i++ {
+		assert.True(t, sr.Times[i] > sr.Times[i-1])
+	}
+	_, err = daq.StimulusResponse(context.Background(), 1, stimulus, 1500*time.Microsecond)
+	assert.Equal(t, ErrInvalidPeriod, err)
+
+	// Polled too when the stream experiments are in use
+	assert.Nil(t, daq.CreateStream(4, time.Second))
+	sr, err = daq.StimulusResponse(context.Background(), 1, stimulus[:2], 10*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Len(t, sr.Response, 2)
+	assert.Len(t, daq.streams, 1)
+}
@@ -0,0 +1,466 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// Number of stream experiments supported by the firmware
+const MaxStreams = 4
+
+// Limits of the period of the stream experiments of a model
+type StreamLimits struct {
+	MinPeriod, MaxPeriod time.Duration
+	// The period is a multiple of it, which must be a multiple of 1 ms (the
+	// unit of the protocol)
+	Resolution time.Duration
+}
+
+// Limits of the openDAQ firmware
+var firmwareStreamLimits = StreamLimits{time.Millisecond, 65535 * time.Millisecond, time.Millisecond}
+
+// Time waited for the device to acknowledge STREAM_STOP
+var streamStopTimeout = 2 * time.Second
+
+// Stream packets are framed with a start byte, and the bytes equal to the
+// start or the escape byte are escaped (XOR 0x20) inside the frame.
+const (
+	frameStart  = 0x7e
+	frameEscape = 0x7d
+	// Checksum, command, length, experiment number and 3 reserved bytes
+	streamHeaderLen = 8
+)
+
+var (
+	ErrInvalidStream  = errors.New("Invalid stream number")
+	ErrInvalidPeriod  = errors.New("Invalid period")
+	ErrStreaming      = errors.New("Command not allowed while streaming")
+	ErrNotStreaming   = errors.New("No stream running")
+	errStreamStopped  = errors.New("Stream stopped")
+	errStreamNoData   = errors.New("No stream data")
+	errStreamTooShort = errors.New("Stream packet too short")
+)
+
+type ChannelMode uint8
+
+const (
+	ANALOG_INPUT ChannelMode = iota
+	ANALOG_OUTPUT
+	DIGITAL_INPUT
+	DIGITAL_OUTPUT
+	COUNTER_INPUT
+	CAPTURE_INPUT
+)
+
+// Configuration of the channel of a stream experiment
+type ChannelConfig struct {
+	Mode               ChannelMode
+	PosInput, NegInput uint
+	GainId             uint
+	NSamples           uint8  // Number of samples averaged in each point
+	NPoints            uint16 // Number of points to acquire (0 for a continuous stream)
+}
+
+type streamConfig struct {
+	period  time.Duration
+	channel ChannelConfig
+}
+
+// Data received from a stream experiment
+type StreamPacket struct {
+	Stream uint
+	Raw    []int16
+	Volts  []float32 // Only for ANALOG_INPUT channels
+}
+
+// Return the period closest to period that the stream experiments of the
+// model can use, or ErrInvalidPeriod if it's out of the limits of the model
+// (see HwFeatures.Stream).
+func (daq *OpenDAQ) StreamPeriod(period time.Duration) (time.Duration, error) {
+	lim := daq.Stream
+	if lim.Resolution == 0 {
+		lim = firmwareStreamLimits
+	}
+	actual := (period + lim.Resolution/2) / lim.Resolution * lim.Resolution
+	if actual < lim.MinPeriod || actual > lim.MaxPeriod {
+		return 0, ErrInvalidPeriod
+	}
+	return actual, nil
+}
+
+// Create the stream experiment n (1 to MaxStreams), acquiring a point every
+// period. The period must be within the limits of the model (up to 65535 ms
+// in whole milliseconds for the openDAQ firmware); otherwise ErrInvalidPeriod
+// is returned.
+func (daq *OpenDAQ) CreateStream(n uint, period time.Duration) error {
+	if n < 1 || n > MaxStreams {
+		return ErrInvalidStream
+	}
+	if actual, err := daq.StreamPeriod(period); err != nil || actual != period {
+		return ErrInvalidPeriod
+	}
+	body := append([]byte{byte(n)}, toBytes(uint16(period/time.Millisecond))...)
+	if _, err := daq.sendCommand(&Message{STREAM_CREATE, body}, STREAM_CREATE.RespLen()); err != nil {
+		return err
+	}
+	daq.streams[n] = &streamConfig{period: period}
+	return nil
+}
+
+// Create the stream experiment n like CreateStream, with the period closest
+// to the requested one that the model can use, and return that period
+func (daq *OpenDAQ) CreateStreamNearest(n uint, period time.Duration) (time.Duration, error) {
+	actual, err := daq.StreamPeriod(period)
+	if err != nil {
+		return 0, err
+	}
+	return actual, daq.CreateStream(n, actual)
+}
+
+// Configure the channel acquired by the stream experiment n
+func (daq *OpenDAQ) ConfigureChannel(n uint, cfg ChannelConfig) error {
+	st, ok := daq.streams[n]
+	if !ok {
+		return ErrInvalidStream
+	}
+	if err := daq.checkChannel(cfg); err != nil {
+		return err
+	}
+	_, err := daq.sendCommand(&Message{CHANNEL_CFG, []byte{byte(n), byte(cfg.Mode),
+		byte(cfg.PosInput), byte(cfg.NegInput), byte(cfg.GainId), cfg.NSamples}}, CHANNEL_CFG.RespLen())
+	if err != nil {
+		return err
+	}
+	body := append([]byte{byte(n)}, toBytes(cfg.NPoints)...)
+	body = append(body, boolToByte(cfg.NPoints != 0))
+	if _, err := daq.sendCommand(&Message{CHANNEL_SETUP, body}, CHANNEL_SETUP.RespLen()); err != nil {
+		return err
+	}
+	st.channel = cfg
+	return nil
+}
+
+// Check the inputs and the gain of an analog input channel
+func (daq *OpenDAQ) checkChannel(cfg ChannelConfig) error {
+	if cfg.Mode != ANALOG_INPUT {
+		return nil
+	}
+	if err := daq.hw.CheckValidInputs(cfg.PosInput, cfg.NegInput); err != nil {
+		return err
+	}
+	if cfg.GainId >= uint(len(daq.Adc.Gains)) {
+		return ErrInvalidGainID
+	}
+	return nil
+}
+
+// Delete the stream experiment n
+func (daq *OpenDAQ) DestroyStream(n uint) error {
+	if _, ok := daq.streams[n]; !ok {
+		return ErrInvalidStream
+	}
+	_, err := daq.sendCommand(&Message{CHANNEL_DESTROY, []byte{byte(n)}}, CHANNEL_DESTROY.RespLen())
+	if err == nil {
+		delete(daq.streams, n)
+	}
+	return err
+}
+
+// Start all the stream experiments.
+// The data is delivered through the returned channel, which is closed when
+// the streams stop. Other commands fail with ErrStreaming until StopStream.
+func (daq *OpenDAQ) StartStream() (<-chan StreamPacket, error) {
+	// The LED can't be changed while streaming
+	if err := daq.setStatus(GREEN); err != nil {
+		return nil, err
+	}
+	if _, err := daq.sendCommand(&Message{Number: STREAM_START}, STREAM_START.RespLen()); err != nil {
+		daq.setStatus(YELLOW)
+		return nil, err
+	}
+	out := make(chan StreamPacket, 64)
+	daq.Lock()
+	daq.streaming = true
+	daq.streamErr = nil
+	daq.streamQuit = make(chan struct{})
+	daq.quitOnce = new(sync.Once)
+	daq.streamDone = make(chan struct{})
+	daq.Unlock()
+	go daq.streamLoop(out, daq.streamQuit, daq.streamDone)
+	return out, nil
+}
+
+// Start all the stream experiments like StartStream, delivering the packets
+// of each experiment through its own channel. The channels are closed when
+// the streams stop. Every channel must be read: a stalled one blocks the
+// delivery to the others.
+func (daq *OpenDAQ) StartStreams() (map[uint]<-chan StreamPacket, error) {
+	packets, err := daq.StartStream()
+	if err != nil {
+		return nil, err
+	}
+	outs := make(map[uint]chan StreamPacket)
+	chans := make(map[uint]<-chan StreamPacket)
+	for n := range daq.streams {
+		outs[n] = make(chan StreamPacket, 64)
+		chans[n] = outs[n]
+	}
+	go func() {
+		for pkt := range packets {
+			if out, ok := outs[pkt.Stream]; ok {
+				out <- pkt
+			}
+		}
+		for _, out := range outs {
+			close(out)
+		}
+	}()
+	return chans, nil
+}
+
+// A single point of a stream experiment
+type Sample struct {
+	Channel uint // Number of the stream experiment
+	Index   int  // Number of the point in its channel, going on across pauses
+	Raw     int16
+	Volts   float32 // Only for ANALOG_INPUT channels
+	// Computed from the start time and the stream period
+	// (reception time for external experiments)
+	Time time.Time
+}
+
+// Start the stream experiments and deliver their points one by one.
+// The streams are stopped and the channel is closed when ctx is done, or
+// when the stream is interrupted by an error (see StreamErr).
+// If the channel isn't read fast enough, the reception of the stream blocks
+// and the data is buffered by the serial port.
+func (daq *OpenDAQ) Samples(ctx context.Context) (<-chan Sample, error) {
+	s, err := daq.StartSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.C, nil
+}
+
+// Stop the streams while the packets are discarded, so the read loop
+// doesn't block before receiving the acknowledgment of the device
+func (daq *OpenDAQ) stopDraining(packets <-chan StreamPacket) error {
+	go func() {
+		for range packets {
+		}
+	}()
+	return daq.StopStream()
+}
+
+// Return the error that interrupted the last stream, if any
+func (daq *OpenDAQ) StreamErr() error {
+	daq.Lock()
+	defer daq.Unlock()
+	return daq.streamErr
+}
+
+// Stop the stream experiments and return the error that interrupted
+// the stream, if any. It can be called concurrently (e.g. while Samples
+// stops the stream because its context is done): all the calls wait for
+// the stream to stop.
+func (daq *OpenDAQ) StopStream() error {
+	daq.Lock()
+	if !daq.streaming {
+		daq.Unlock()
+		return ErrNotStreaming
+	}
+	quit, quitOnce, done := daq.streamQuit, daq.quitOnce, daq.streamDone
+	stop, _ := (&Message{Number: STREAM_STOP}).Marshal()
+	_, err := daq.ser.Write(stop)
+	daq.Unlock()
+
+	// Wait for the acknowledgment of the device
+	select {
+	case <-done:
+	case <-time.After(streamStopTimeout):
+		quitOnce.Do(func() { close(quit) })
+		<-done
+	}
+	daq.Lock()
+	daq.streaming = false
+	streamErr := daq.streamErr
+	daq.Unlock()
+	if e := daq.resumePolling(); err == nil {
+		err = e
+	}
+	if streamErr != nil {
+		daq.setStatus(RED)
+		return streamErr
+	}
+	daq.setStatus(YELLOW)
+	return err
+}
+
+// The analog input channels of the stream experiments leave the ADC
+// configured for them: configure it again for the polled reads
+func (daq *OpenDAQ) resumePolling() error {
+	analog := false
+	for _, st := range daq.streams {
+		analog = analog || st.channel.Mode == ANALOG_INPUT
+	}
+	daq.cfgMu.RLock()
+	defer daq.cfgMu.RUnlock()
+	if !analog || !daq.adcConfigured {
+		return nil
+	}
+	_, err := daq.sendCommand(&Message{AIN_CFG, []byte{byte(daq.posInput), byte(daq.negInput),
+		byte(daq.gainId), daq.nSamples}}, AIN_CFG.RespLen())
+	daq.setUnsettled()
+	return err
+}
+
+// Read the stream packets and deliver them until the stream stops
+func (daq *OpenDAQ) streamLoop(out chan<- StreamPacket, quit, done chan struct{}) {
+	defer close(done)
+	defer close(out)
+	r := &byteReader{r: daq.ser}
+	for {
+		n, data, err := readStreamPacket(r)
+		switch err {
+		case nil:
+		case errStreamNoData:
+			select {
+			case <-quit:
+				return
+			default:
+				continue
+			}
+		case ErrChecksum, errStreamTooShort:
+			// Discard the corrupted packet
+			continue
+		case errStreamStopped:
+			return
+		default:
+			daq.Lock()
+			daq.streamErr = err
+			daq.Unlock()
+			return
+		}
+
+		pkt := StreamPacket{Stream: uint(n), Raw: make([]int16, len(data)/2)}
+		for i := range pkt.Raw {
+			pkt.Raw[i] = int16(binary.BigEndian.Uint16(data[2*i:]))
+		}
+		if st, ok := daq.streams[uint(n)]; ok && st.channel.Mode == ANALOG_INPUT {
+			cfg := st.channel
+			pkt.Volts = make([]float32, len(pkt.Raw))
+			for i, raw := range pkt.Raw {
+				pkt.Volts[i], _ = daq.rawToVolts(int(raw), cfg.PosInput, cfg.NegInput != 0, cfg.GainId)
+			}
+		}
+		select {
+		case out <- pkt:
+		case <-quit:
+			return
+		}
+	}
+}
+
+// Byte reader over a serial port with a read timeout.
+// A read returning no data means that the timeout expired.
+type byteReader struct {
+	r      io.Reader
+	buf    [256]byte
+	pos, n int
+}
+
+func (br *byteReader) readByte() (byte, error) {
+	if br.pos == br.n {
+		n, err := br.r.Read(br.buf[:])
+		if n == 0 && (err == nil || err == io.EOF) {
+			return 0, errStreamNoData
+		}
+		if err != nil {
+			return 0, err
+		}
+		br.pos, br.n = 0, n
+	}
+	b := br.buf[br.pos]
+	br.pos++
+	return b, nil
+}
+
+// Read a byte inside a frame, removing the escaping
+func (br *byteReader) readFrameByte() (byte, error) {
+	b, err := br.readByte()
+	if err != nil || b != frameEscape {
+		return b, err
+	}
+	b, err = br.readByte()
+	return b ^ 0x20, err
+}
+
+// Read a stream packet, returning its experiment number and its data.
+// errStreamStopped is returned when the device acknowledges STREAM_STOP.
+func readStreamPacket(br *byteReader) (uint8, []byte, error) {
+	// Look for the start of a frame. The acknowledgment of STREAM_STOP may
+	// come as a plain response, so the last bytes are kept to detect it.
+	var last []byte
+	for {
+		b, err := br.readByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		if b == frameStart {
+			break
+		}
+		if last = append(last, b); len(last) > 4 {
+			last = last[1:]
+		}
+		if len(last) == 4 && CommandNumber(last[2]) == STREAM_STOP {
+			if _, err := parseResponse(last); err == nil {
+				return 0, nil, errStreamStopped
+			}
+		}
+	}
+
+	header := make([]byte, 0, streamHeaderLen)
+	for len(header) < streamHeaderLen {
+		b, err := br.readFrameByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		header = append(header, b)
+		if len(header) == 3 && CommandNumber(b) == STREAM_STOP {
+			return 0, nil, errStreamStopped
+		}
+	}
+	if header[3] < streamHeaderLen-4 {
+		return 0, nil, errStreamTooShort
+	}
+	frame := make([]byte, 4+int(header[3]))
+	copy(frame, header)
+	for i := streamHeaderLen; i < len(frame); i++ {
+		b, err := br.readFrameByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		frame[i] = b
+	}
+	if binary.BigEndian.Uint16(frame) != checksum(frame[2:]) {
+		return 0, nil, ErrChecksum
+	}
+	return frame[4], frame[streamHeaderLen:], nil
+}
@@ -0,0 +1,150 @@
+package godaq
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadStreamPacket(t *testing.T) {
+	var buf bytes.Buffer
+	buf.Write([]byte{0x01, 0x02}) // garbage before the frame
+	buf.Write(streamFrame(2, 1000, -1, 0x7e7d))
+	stop, _ := (&Message{Number: STREAM_STOP}).Marshal()
+	buf.Write(stop)
+	br := &byteReader{r: &buf}
+
+	n, data, err := readStreamPacket(br)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, n)
+	assert.Equal(t, []byte{0x03, 0xe8, 0xff, 0xff, 0x7e, 0x7d}, data)
+
+	_, _, err = readStreamPacket(br)
+	assert.Equal(t, errStreamStopped, err)
+
+	_, _, err = readStreamPacket(br)
+	assert.Equal(t, errStreamNoData, err)
+}
+
+func TestReadStreamPacketChecksum(t *testing.T) {
+	frame := streamFrame(1, 10, 20)
+	frame[len(frame)-1]++
+	_, _, err := readStreamPacket(&byteReader{r: bytes.NewBuffer(frame)})
+	assert.Equal(t, ErrChecksum, err)
+}
+
+func TestStopStreamConcurrent(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelMId)
+	defer func(d time.Duration) { streamStopTimeout = d }(streamStopTimeout)
+	streamStopTimeout = 20 * time.Millisecond
+	assert.Nil(t, daq.CreateStream(1, 10*time.Millisecond))
+	assert.Nil(t, daq.ConfigureChannel(1, ChannelConfig{Mode: ANALOG_INPUT, PosInput: 1}))
+	packets, err := daq.StartStream()
+	assert.Nil(t, err)
+	go func() {
+		for range packets {
+		}
+	}()
+
+	// The device doesn't acknowledge the stop, so both calls time out
+	sim.Faults = func(cmd CommandNumber) Fault {
+		if cmd == STREAM_STOP {
+			return FAULT_TIMEOUT
+		}
+		return NO_FAULT
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NotPanics(t, func() { daq.StopStream() })
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, ErrNotStreaming, daq.StopStream())
+}
+
+func TestStartStreams(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelMId)
+	sim.Inputs = map[uint]Waveform{1: Constant(1), 2: Constant(-1)}
+	assert.Nil(t, daq.CreateStream(1, 2*time.Millisecond))
+	assert.Nil(t, daq.ConfigureChannel(1, ChannelConfig{Mode: ANALOG_INPUT, PosInput: 1, GainId: 1}))
+	assert.Nil(t, daq.CreateStream(3, 5*time.Millisecond))
+	assert.Nil(t, daq.ConfigureChannel(3, ChannelConfig{Mode: ANALOG_INPUT, PosInput: 2}))
+	chans, err := daq.StartStreams()
+	assert.Nil(t, err)
+	assert.Len(t, chans, 2)
+
+	var wg sync.WaitGroup
+	counts := make([]int, 2)
+	for i, c := range []struct {
+		n     uint
+		volts float32
+	}{{1, 1}, {3, -1}} {
+		wg.Add(1)
+		go func(i int, n uint, volts float32, packets <-chan StreamPacket) {
+			defer wg.Done()
+			for pkt := range packets {
+				assert.Equal(t, n, pkt.Stream)
+				assert.InDelta(t, volts, pkt.Volts[0], 0.05)
+				counts[i]++
+			}
+		}(i, c.n, c.volts, chans[c.n])
+	}
+	time.Sleep(50 * time.Millisecond)
+	assert.Nil(t, daq.StopStream())
+	wg.Wait()
+	assert.True(t, counts[0] > counts[1] && counts[1] > 3, "%v", counts)
+}
+
+func TestStreamThenPoll(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelMId)
+	sim.Inputs = map[uint]Waveform{1: Constant(1), 2: Constant(-2)}
+	assert.Nil(t, daq.ConfigureADC(2, 0, 0, 1))
+	assert.Nil(t, daq.CreateStream(1, time.Millisecond))
+	assert.Nil(t, daq.ConfigureChannel(1, ChannelConfig{Mode: ANALOG_INPUT, PosInput: 1, GainId: 2}))
+	packets, err := daq.StartStream()
+	assert.Nil(t, err)
+	pkt := <-packets
+	assert.InDelta(t, 1, pkt.Volts[0], 0.05)
+	assert.Nil(t, daq.stopDraining(packets))
+
+	// The polled reads get their own configuration back
+	v, err := daq.ReadAnalog()
+	assert.Nil(t, err)
+	assert.InDelta(t, -2, v, 0.05)
+}
+
+func TestStreamPeriod(t *testing.T) {
+	daq, _ := newSimDAQ(t, ModelMId)
+	for _, c := range []struct{ period, actual time.Duration }{
+		{1400 * time.Microsecond, time.Millisecond},
+		{1600 * time.Microsecond, 2 * time.Millisecond},
+		{time.Second, time.Second},
+		{300 * time.Microsecond, 0},
+		{70 * time.Second, 0},
+	} {
+		actual, err := daq.StreamPeriod(c.period)
+		assert.Equal(t, c.actual, actual, "%v", c.period)
+		assert.Equal(t, c.actual == 0, err == ErrInvalidPeriod, "%v", c.period)
+	}
+
+	assert.Equal(t, ErrInvalidPeriod, daq.CreateStream(1, 1500*time.Microsecond))
+	actual, err := daq.CreateStreamNearest(1, 1500*time.Microsecond)
+	assert.Nil(t, err)
+	assert.Equal(t, 2*time.Millisecond, actual)
+	assert.Equal(t, actual, daq.streams[1].period)
+
+	// Model with coarser limits
+	daq.Stream = StreamLimits{10 * time.Millisecond, time.Second, 10 * time.Millisecond}
+	actual, err = daq.StreamPeriod(14 * time.Millisecond)
+	assert.Nil(t, err)
+	assert.Equal(t, 10*time.Millisecond, actual)
+	assert.Equal(t, ErrInvalidPeriod, daq.CreateStream(2, 5*time.Millisecond))
+	_, err = daq.StreamPeriod(2 * time.Second)
+	assert.Equal(t, ErrInvalidPeriod, err)
+}
@@ -0,0 +1,83 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"context"
+	"io"
+	"net"
+	"time"
+)
+
+// TCP connection behaving like a serial port: reads time out returning the
+// bytes received so far instead of an error
+type tcpConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *tcpConn) Read(p []byte) (int, error) {
+	c.SetReadDeadline(time.Now().Add(c.timeout))
+	n, err := c.Conn.Read(p)
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return n, nil
+	}
+	return n, err
+}
+
+// Discard the data already received
+func (c *tcpConn) Flush() error {
+	buf := make([]byte, 256)
+	for {
+		c.SetReadDeadline(time.Now().Add(time.Millisecond))
+		if _, err := c.Conn.Read(buf); err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// Open a device exposed by a TCP serial server, such as ser2net, at addr
+// ("host:port"). The retries and timeouts are the same as for a local port
+// (see WithReadTimeout).
+func NewTCP(addr string, opts ...Option) (*OpenDAQ, error) {
+	return NewTCPContext(context.Background(), addr, opts...)
+}
+
+// Open a device exposed by a TCP serial server, like NewTCP.
+// The connection and the initialization are aborted when ctx is done.
+func NewTCPContext(ctx context.Context, addr string, opts ...Option) (*OpenDAQ, error) {
+	timeout := newOptions(opts).readTimeout
+	dial := func(ctx context.Context) (io.ReadWriteCloser, error) {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return &tcpConn{conn, timeout}, nil
+	}
+	conn, err := dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts[:len(opts):len(opts)], WithDialer(dial), withPort(addr))
+	daq, err := NewFromTransportContext(ctx, conn, opts...)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return daq, nil
+}
@@ -0,0 +1,55 @@
+package godaq
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Serve a simulated device on a local TCP port
+func serveSimulator(t *testing.T, sim *Simulator) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 512)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			sim.Write(buf[:n])
+			if n, _ := sim.Read(buf); n > 0 {
+				conn.Write(buf[:n])
+			}
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestNewTCP(t *testing.T) {
+	sim, _ := NewSimulator(ModelNId)
+	sim.Inputs = map[uint]Waveform{1: Constant(-1)}
+	addr := serveSimulator(t, sim)
+	daq, err := NewTCP(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer daq.Close()
+	assert.Equal(t, "OpenDAQ N", daq.Name)
+	assert.Nil(t, daq.ConfigureADC(1, 0, 1, 1))
+	v, err := daq.ReadAnalog()
+	assert.Nil(t, err)
+	assert.InDelta(t, -1, v, 0.01)
+
+	_, err = NewTCP("127.0.0.1:1")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,87 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Integral of a signal over time (e.g. flow into volume or power into energy),
+// computed with the trapezoidal rule.
+type Totalizer struct {
+	Scale float64 // Factor applied to the integral (e.g. 1./3600 for hours)
+	total float64
+	last  float32
+	lastT time.Time
+	init  bool
+	sync.Mutex
+}
+
+func NewTotalizer(scale float64) *Totalizer {
+	return &Totalizer{Scale: scale}
+}
+
+// Add the value v read at time t and return the accumulated total
+func (tot *Totalizer) Update(t time.Time, v float32) float64 {
+	tot.Lock()
+	defer tot.Unlock()
+	if tot.init && t.After(tot.lastT) {
+		dt := t.Sub(tot.lastT).Seconds()
+		tot.total += float64(v+tot.last) / 2 * dt * tot.Scale
+	}
+	tot.last, tot.lastT, tot.init = v, t, true
+	return tot.total
+}
+
+func (tot *Totalizer) Total() float64 {
+	tot.Lock()
+	defer tot.Unlock()
+	return tot.total
+}
+
+// Set the total to zero
+func (tot *Totalizer) Reset() {
+	tot.Lock()
+	tot.total = 0
+	tot.Unlock()
+}
+
+type totalizerState struct {
+	Total float64 `json:"total"`
+}
+
+// Save the accumulated total, so it can be restored after a restart
+func (tot *Totalizer) Save(w io.Writer) error {
+	tot.Lock()
+	defer tot.Unlock()
+	return json.NewEncoder(w).Encode(totalizerState{tot.total})
+}
+
+// Restore a total saved with Save.
+// The integration restarts with the next value, the time elapsed while the
+// application was stopped isn't accounted.
+func (tot *Totalizer) Load(r io.Reader) error {
+	var st totalizerState
+	if err := json.NewDecoder(r).Decode(&st); err != nil {
+		return err
+	}
+	tot.Lock()
+	defer tot.Unlock()
+	tot.total = st.Total
+	tot.init = false
+	return nil
+}
@@ -0,0 +1,30 @@
+package godaq
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTotalizer(t *testing.T) {
+	tot := NewTotalizer(1)
+	t0 := time.Unix(0, 0)
+	assert.Equal(t, 0.0, tot.Update(t0, 1))
+	assert.Equal(t, 2.0, tot.Update(t0.Add(time.Second), 3))
+	assert.Equal(t, 5.0, tot.Update(t0.Add(2*time.Second), 3))
+
+	var buf bytes.Buffer
+	assert.Nil(t, tot.Save(&buf))
+
+	tot.Reset()
+	assert.Equal(t, 0.0, tot.Total())
+
+	restored := NewTotalizer(1)
+	assert.Nil(t, restored.Load(&buf))
+	assert.Equal(t, 5.0, restored.Total())
+	// The gap since the last value is not integrated
+	assert.Equal(t, 5.0, restored.Update(t0.Add(time.Hour), 3))
+	assert.Equal(t, 8.0, restored.Update(t0.Add(time.Hour+time.Second), 3))
+}
@@ -44,6 +44,8 @@ type DevicePort struct {
 	Port  string
 }
 
+// Open every USB-serial port and return the ones with an openDAQ attached.
+// Use Discover to skip the ports of other USB devices.
 func ListDevicePorts() ([]DevicePort, error) {
 	ports, err := ListPorts()
 	if err != nil {
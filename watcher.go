@@ -0,0 +1,190 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Kind of a DeviceEvent
+type DeviceEventKind uint8
+
+const (
+	ARRIVED DeviceEventKind = iota
+	REMOVED
+	// A device that arrived with an error was identified by a later probe
+	IDENTIFIED
+)
+
+func (k DeviceEventKind) String() string {
+	switch k {
+	case ARRIVED:
+		return "arrived"
+	case IDENTIFIED:
+		return "identified"
+	}
+	return "removed"
+}
+
+// A device plugged in or removed
+type DeviceEvent struct {
+	Kind   DeviceEventKind
+	Device DiscoveredDevice
+}
+
+// Monitor the USB-serial ports (Linux only) and report the openDAQs plugged
+// in or removed, so long-running services can attach to them
+// automatically. The ports are polled every Interval and selected as
+// Discover does; with Options.Probe the new devices are identified before
+// being reported. The devices that can't be identified (e.g. still booting)
+// are reported with their error and probed again at the next scans, until
+// they are reported as IDENTIFIED.
+type Watcher struct {
+	Interval time.Duration // Between scans of the ports (1 s by default)
+	Options  DiscoverOptions
+
+	list    func() ([]string, error)
+	open    func(ctx context.Context, port string) (*OpenDAQ, error)
+	mu      sync.Mutex
+	devices map[string]DiscoveredDevice
+}
+
+func NewWatcher(interval time.Duration, opts DiscoverOptions) *Watcher {
+	return &Watcher{Interval: interval, Options: opts}
+}
+
+// Scan the ports and send the events until ctx is done, when the channel is
+// closed. The devices already attached are reported as arrived first.
+// Only the error of the first scan is returned; later scans that fail are
+// retried at the next interval.
+func (w *Watcher) Watch(ctx context.Context) (<-chan DeviceEvent, error) {
+	if w.list == nil {
+		w.list = ListPorts
+	}
+	if w.open == nil {
+		w.open = func(ctx context.Context, port string) (*OpenDAQ, error) {
+			return NewContext(ctx, port, w.Options.Options...)
+		}
+	}
+	interval := w.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	w.mu.Lock()
+	w.devices = make(map[string]DiscoveredDevice)
+	w.mu.Unlock()
+	events, err := w.scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan DeviceEvent, 16)
+	go func() {
+		defer close(out)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			for _, ev := range events {
+				select {
+				case out <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			events, _ = w.scan(ctx)
+		}
+	}()
+	return out, nil
+}
+
+// Compare the ports with the known devices and return the changes: the
+// removals first, then the arrivals and then the identifications, each of
+// them in port order
+func (w *Watcher) scan(ctx context.Context) ([]DeviceEvent, error) {
+	ports, err := w.list()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(ports)
+	present := make(map[string]bool)
+	var arrived, retried []DiscoveredDevice
+	w.mu.Lock()
+	for _, d := range candidatePorts(ports, w.Options) {
+		present[d.Port] = true
+		if known, ok := w.devices[d.Port]; !ok {
+			arrived = append(arrived, d)
+		} else if w.Options.Probe && known.Err != nil {
+			retried = append(retried, d)
+		}
+	}
+	var events []DeviceEvent
+	for _, port := range sortedPorts(w.devices) {
+		if !present[port] {
+			events = append(events, DeviceEvent{REMOVED, w.devices[port]})
+			delete(w.devices, port)
+		}
+	}
+	w.mu.Unlock()
+
+	if w.Options.Probe {
+		probed := append(append([]DiscoveredDevice(nil), arrived...), retried...)
+		for _, daq := range probePorts(ctx, probed, w.open) {
+			if daq != nil {
+				daq.Close()
+			}
+		}
+		arrived, retried = probed[:len(arrived)], probed[len(arrived):]
+	}
+	w.mu.Lock()
+	for _, d := range arrived {
+		w.devices[d.Port] = d
+		events = append(events, DeviceEvent{ARRIVED, d})
+	}
+	for _, d := range retried {
+		w.devices[d.Port] = d
+		if d.Err == nil {
+			events = append(events, DeviceEvent{IDENTIFIED, d})
+		}
+	}
+	w.mu.Unlock()
+	return events, nil
+}
+
+// Return the devices attached at the last scan, in port order
+func (w *Watcher) Devices() []DiscoveredDevice {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var devs []DiscoveredDevice
+	for _, port := range sortedPorts(w.devices) {
+		devs = append(devs, w.devices[port])
+	}
+	return devs
+}
+
+func sortedPorts(devices map[string]DiscoveredDevice) []string {
+	ports := make([]string, 0, len(devices))
+	for port := range devices {
+		ports = append(ports, port)
+	}
+	sort.Strings(ports)
+	return ports
+}
@@ -0,0 +1,127 @@
+package godaq
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatcher(t *testing.T) {
+	root, err := ioutil.TempDir("", "sysfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	addSysfsTTY(t, root, "ttyUSB0", OpenDAQUSBIDs[0])
+	addSysfsTTY(t, root, "ttyUSB1", OpenDAQUSBIDs[0])
+	addSysfsTTY(t, root, "ttyUSB2", USBID{0x067b, 0x2303})
+	defer func(dir string) { sysfsTTY = dir }(sysfsTTY)
+	sysfsTTY = filepath.Join(root, "class", "tty")
+
+	var mu sync.Mutex
+	ports := []string{"/dev/ttyUSB2", "/dev/ttyUSB0"}
+	setPorts := func(p ...string) {
+		mu.Lock()
+		ports = p
+		mu.Unlock()
+	}
+	w := NewWatcher(5*time.Millisecond, DiscoverOptions{Probe: true})
+	w.list = func() ([]string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), ports...), nil
+	}
+	w.open = func(ctx context.Context, port string) (*OpenDAQ, error) {
+		sim, _ := NewSimulator(ModelSId)
+		return NewFromTransportContext(ctx, sim)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := w.Watch(ctx)
+	assert.Nil(t, err)
+	next := func() DeviceEvent {
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(time.Second):
+			t.Fatal("no event")
+		}
+		return DeviceEvent{}
+	}
+
+	// The attached devices are reported first
+	ev := next()
+	assert.Equal(t, ARRIVED, ev.Kind)
+	assert.Equal(t, "/dev/ttyUSB0", ev.Device.Port)
+	assert.Equal(t, "OpenDAQ S", ev.Device.Info.ModelName)
+
+	setPorts("/dev/ttyUSB0", "/dev/ttyUSB1", "/dev/ttyUSB2")
+	ev = next()
+	assert.Equal(t, ARRIVED, ev.Kind)
+	assert.Equal(t, "/dev/ttyUSB1", ev.Device.Port)
+
+	setPorts("/dev/ttyUSB1")
+	ev = next()
+	assert.Equal(t, REMOVED, ev.Kind)
+	assert.Equal(t, "/dev/ttyUSB0", ev.Device.Port)
+	assert.Equal(t, "removed", ev.Kind.String())
+
+	devs := w.Devices()
+	assert.Len(t, devs, 1)
+	assert.Equal(t, "/dev/ttyUSB1", devs[0].Port)
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestWatcherReprobe(t *testing.T) {
+	root, err := ioutil.TempDir("", "sysfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	addSysfsTTY(t, root, "ttyUSB0", OpenDAQUSBIDs[0])
+	defer func(dir string) { sysfsTTY = dir }(sysfsTTY)
+	sysfsTTY = filepath.Join(root, "class", "tty")
+
+	// The device doesn't answer the first two probes (still booting)
+	probes := 0
+	w := NewWatcher(5*time.Millisecond, DiscoverOptions{Probe: true})
+	w.list = func() ([]string, error) { return []string{"/dev/ttyUSB0"}, nil }
+	w.open = func(ctx context.Context, port string) (*OpenDAQ, error) {
+		if probes++; probes <= 2 {
+			return nil, ErrTimeout
+		}
+		sim, _ := NewSimulator(ModelSId)
+		return NewFromTransportContext(ctx, sim)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := w.Watch(ctx)
+	assert.Nil(t, err)
+	ev := <-events
+	assert.Equal(t, ARRIVED, ev.Kind)
+	assert.Equal(t, ErrTimeout, ev.Device.Err)
+
+	select {
+	case ev = <-events:
+		assert.Equal(t, IDENTIFIED, ev.Kind)
+		assert.Equal(t, "identified", ev.Kind.String())
+		assert.Nil(t, ev.Device.Err)
+		assert.Equal(t, "OpenDAQ S", ev.Device.Info.ModelName)
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+	}
+	assert.Equal(t, 3, probes)
+	if devs := w.Devices(); assert.Len(t, devs, 1) {
+		assert.Nil(t, devs[0].Err)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"syscall/js"
+	"time"
+)
+
+var ErrWebSerial = errors.New("WebSerial error")
+
+// Result of a JavaScript promise
+type jsResult struct {
+	value js.Value
+	err   error
+}
+
+// Wait for a promise to settle. It blocks the calling goroutine, so it must
+// not be called from a JavaScript callback.
+func await(promise js.Value) <-chan jsResult {
+	ch := make(chan jsResult, 1)
+	var then, catch js.Func
+	then = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		ch <- jsResult{value: args[0]}
+		then.Release()
+		catch.Release()
+		return nil
+	})
+	catch = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		ch <- jsResult{err: fmt.Errorf("%w: %s", ErrWebSerial, args[0].Call("toString").String())}
+		then.Release()
+		catch.Release()
+		return nil
+	})
+	promise.Call("then", then).Call("catch", catch)
+	return ch
+}
+
+// Transport using a SerialPort of the WebSerial API
+type webSerial struct {
+	port, reader, writer js.Value
+	// Read in progress, kept until it completes if a Read times out
+	pending <-chan jsResult
+	buf     bytes.Buffer
+	timeout time.Duration
+}
+
+// Read the data received, waiting up to the read timeout
+func (w *webSerial) Read(p []byte) (int, error) {
+	if w.buf.Len() == 0 {
+		if w.pending == nil {
+			w.pending = await(w.reader.Call("read"))
+		}
+		select {
+		case res := <-w.pending:
+			w.pending = nil
+			if res.err != nil {
+				return 0, res.err
+			}
+			if res.value.Get("done").Bool() {
+				return 0, io.EOF
+			}
+			data := res.value.Get("value")
+			chunk := make([]byte, data.Get("length").Int())
+			js.CopyBytesToGo(chunk, data)
+			w.buf.Write(chunk)
+		case <-time.After(w.timeout):
+			return 0, nil
+		}
+	}
+	return w.buf.Read(p)
+}
+
+func (w *webSerial) Write(p []byte) (int, error) {
+	data := js.Global().Get("Uint8Array").New(len(p))
+	js.CopyBytesToJS(data, p)
+	if res := <-await(w.writer.Call("write", data)); res.err != nil {
+		return 0, res.err
+	}
+	return len(p), nil
+}
+
+// Discard the data received
+func (w *webSerial) Flush() error {
+	w.buf.Reset()
+	return nil
+}
+
+func (w *webSerial) Close() error {
+	<-await(w.reader.Call("cancel"))
+	w.reader.Call("releaseLock")
+	w.writer.Call("releaseLock")
+	res := <-await(w.port.Call("close"))
+	return res.err
+}
+
+// Use a device connected to a SerialPort of the WebSerial API, obtained with
+// navigator.serial.requestPort() from a user gesture. The port is opened
+// here and closed by Close.
+// The device can't be used from a JavaScript callback, which would block the
+// event loop: call it from a new goroutine.
+func NewWebSerial(ctx context.Context, port js.Value, opts ...Option) (*OpenDAQ, error) {
+	o := newOptions(opts)
+	options := js.Global().Get("Object").New()
+	options.Set("baudRate", o.baud)
+	if res := <-await(port.Call("open", options)); res.err != nil {
+		return nil, res.err
+	}
+	ser := &webSerial{
+		port:    port,
+		reader:  port.Get("readable").Call("getReader"),
+		writer:  port.Get("writable").Call("getWriter"),
+		timeout: o.readTimeout,
+	}
+	// The device reboots when the port is opened
+	if err := probeDevice(ctx, ser, o.bootDelay); err != nil {
+		ser.Close()
+		return nil, err
+	}
+	daq, err := NewFromTransportContext(ctx, ser, opts...)
+	if err != nil {
+		ser.Close()
+		return nil, err
+	}
+	return daq, nil
+}
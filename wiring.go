@@ -0,0 +1,255 @@
+// Copyright 2016 The Godaq Authors. All rights reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package godaq
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+var (
+	// Returned by the prompt of a wiring check to skip the current terminal
+	ErrSkipCheck = errors.New("Check skipped")
+	ErrNoPrompt  = errors.New("No wiring prompt")
+	// Reported for the last PIO when their number is odd
+	ErrUnpairedPIO = errors.New("No PIO to pair with")
+)
+
+// Time given to an input to settle after changing the output
+const wiringSettle = 50 * time.Millisecond
+
+// Result of the wiring check of a terminal
+type WiringCheck struct {
+	Terminal    string    // e.g. "AN3" or "PIO1-PIO2"
+	Instruction string    // Connection asked to the user
+	Expected    []float32 // Levels driven (V, or 0/1 for the PIOs)
+	Measured    []float32 // Levels read back
+	Passed      bool
+	Err         error // Why the terminal wasn't checked (ErrSkipCheck if skipped)
+}
+
+// Configuration of CheckWiring
+type WiringConfig struct {
+	// Called with the connection the user must make before checking each
+	// terminal. It must return when the connection is ready, ErrSkipCheck to
+	// skip the terminal or another error to abort the check.
+	Prompt    func(instruction string) error
+	Output    uint    // Analog output driving the inputs (1 by default)
+	Tolerance float32 // Maximum error of the analog readings in volts (0.1 by default)
+	Inputs    []uint  // Analog inputs to check (all the single-ended inputs by default)
+	PIOs      bool    // Check the PIOs too, in pairs (PIO1-PIO2, PIO3-PIO4...)
+}
+
+// Two levels the output can drive and the inputs can read with the widest range
+func (daq *OpenDAQ) wiringLevels() []float32 {
+	vmin := float32(math.Max(float64(daq.Dac.VMin), float64(daq.Adc.VMin/daq.Adc.Gains[0])))
+	vmax := float32(math.Min(float64(daq.Dac.VMax), float64(daq.Adc.VMax/daq.Adc.Gains[0])))
+	return []float32{vmin + (vmax-vmin)/4, vmin + (vmax-vmin)*3/4}
+}
+
+// Guide the user through the wiring of the terminals and check each of them.
+// For every analog input the user is asked to wire it to the analog output,
+// which is set to two different levels that must be read back within the
+// tolerance. For every pair of PIOs the user is asked to wire them together,
+// and each one drives both levels while the other one reads them.
+// The ADC configuration is restored afterwards, the output is set to 0 V and
+// the PIOs are left as inputs, also when the prompt aborts the check.
+// An error is returned only if the prompt aborts the check (or if it's
+// missing); communication errors are reported in the check of the terminal.
+func (daq *OpenDAQ) CheckWiring(cfg WiringConfig) ([]WiringCheck, error) {
+	if cfg.Prompt == nil {
+		return nil, ErrNoPrompt
+	}
+	if cfg.Output == 0 {
+		cfg.Output = 1
+	}
+	if cfg.Tolerance == 0 {
+		cfg.Tolerance = 0.1
+	}
+	if cfg.Output > daq.NOutputs {
+		return nil, ErrInvalidOutput
+	}
+	inputs := cfg.Inputs
+	if inputs == nil {
+		for n := uint(1); n <= daq.NInputs; n++ {
+			if daq.hw.CheckValidInputs(n, 0) == nil {
+				inputs = append(inputs, n)
+			}
+		}
+	}
+
+	checks, err := daq.checkInputs(cfg, inputs)
+	if err != nil {
+		return checks, err
+	}
+	if cfg.PIOs {
+		for p := uint(1); p+1 <= daq.NPIOs; p += 2 {
+			c := WiringCheck{
+				Terminal:    fmt.Sprintf("PIO%d-PIO%d", p, p+1),
+				Instruction: fmt.Sprintf("Connect PIO%d to PIO%d", p, p+1),
+				Expected:    []float32{1, 0, 1, 0},
+			}
+			if err := cfg.Prompt(c.Instruction); err != nil && !errors.Is(err, ErrSkipCheck) {
+				return checks, err
+			} else if err != nil {
+				c.Err = err
+			} else {
+				c.Measured, c.Err = daq.checkPIOPair(p, p+1)
+				c.Passed = c.Err == nil && withinTolerance(c.Expected, c.Measured, 0)
+			}
+			checks = append(checks, c)
+		}
+		if daq.NPIOs%2 != 0 {
+			checks = append(checks, WiringCheck{
+				Terminal: fmt.Sprintf("PIO%d", daq.NPIOs),
+				Err:      ErrUnpairedPIO,
+			})
+		}
+	}
+	return checks, nil
+}
+
+// Check the wiring of the analog inputs. The output is set to 0 V and the ADC
+// configuration is restored afterwards.
+func (daq *OpenDAQ) checkInputs(cfg WiringConfig, inputs []uint) ([]WiringCheck, error) {
+	if len(inputs) == 0 {
+		return nil, nil
+	}
+	daq.cfgMu.RLock()
+	pos, neg, gainId, nSamples := daq.posInput, daq.negInput, daq.gainId, daq.nSamples
+	daq.cfgMu.RUnlock()
+	defer func() {
+		daq.SetAnalog(cfg.Output, 0)
+		daq.ConfigureADC(pos, neg, gainId, nSamples)
+	}()
+
+	var checks []WiringCheck
+	levels := daq.wiringLevels()
+	for _, n := range inputs {
+		c := WiringCheck{
+			Terminal:    fmt.Sprintf("AN%d", n),
+			Instruction: fmt.Sprintf("Connect the output %d to the input AN%d", cfg.Output, n),
+			Expected:    levels,
+		}
+		if err := cfg.Prompt(c.Instruction); err != nil && !errors.Is(err, ErrSkipCheck) {
+			return checks, err
+		} else if err != nil {
+			c.Err = err
+		} else {
+			c.Measured, c.Err = daq.checkInput(n, cfg.Output, levels)
+			c.Passed = c.Err == nil && withinTolerance(levels, c.Measured, cfg.Tolerance)
+		}
+		checks = append(checks, c)
+	}
+	return checks, nil
+}
+
+// Drive the output to each level and read it at the input n
+func (daq *OpenDAQ) checkInput(n, output uint, levels []float32) ([]float32, error) {
+	if err := daq.ConfigureADC(n, 0, 0, 20); err != nil {
+		return nil, err
+	}
+	measured := make([]float32, 0, len(levels))
+	for _, v := range levels {
+		if err := daq.SetAnalog(output, v); err != nil {
+			return measured, err
+		}
+		time.Sleep(wiringSettle)
+		read, err := daq.readVolts()
+		if err != nil {
+			return measured, err
+		}
+		measured = append(measured, read)
+	}
+	return measured, nil
+}
+
+// Drive each PIO of a pair high and low while reading it from the other one
+func (daq *OpenDAQ) checkPIOPair(a, b uint) (measured []float32, err error) {
+	defer func() {
+		if e := daq.SetPIODir(a, false); err == nil {
+			err = e
+		}
+		if e := daq.SetPIODir(b, false); err == nil {
+			err = e
+		}
+	}()
+	for _, pins := range [][2]uint{{a, b}, {b, a}} {
+		out, in := pins[0], pins[1]
+		if err := daq.SetPIODir(in, false); err != nil {
+			return measured, err
+		}
+		if err := daq.SetPIODir(out, true); err != nil {
+			return measured, err
+		}
+		for _, v := range []bool{true, false} {
+			if err := daq.SetPIO(out, v); err != nil {
+				return measured, err
+			}
+			read, err := daq.readPIO(in)
+			if err != nil {
+				return measured, err
+			}
+			measured = append(measured, float32(read))
+		}
+	}
+	return measured, nil
+}
+
+func withinTolerance(expected, measured []float32, tol float32) bool {
+	if len(measured) != len(expected) {
+		return false
+	}
+	for i := range expected {
+		if math.Abs(float64(measured[i]-expected[i])) > float64(tol) {
+			return false
+		}
+	}
+	return true
+}
+
+func formatLevels(levels []float32) string {
+	s := make([]string, len(levels))
+	for i, v := range levels {
+		s[i] = fmt.Sprintf("%.3g", v)
+	}
+	return strings.Join(s, ", ")
+}
+
+// Write the wiring checks as a Markdown table, terminal by terminal
+func WriteWiringReport(w io.Writer, checks []WiringCheck) error {
+	fmt.Fprintln(w, "| Terminal | Connection | Expected | Measured | Result |")
+	fmt.Fprintln(w, "|----------|------------|----------|----------|--------|")
+	for _, c := range checks {
+		result := "pass"
+		if errors.Is(c.Err, ErrSkipCheck) {
+			result = "skipped"
+		} else if errors.Is(c.Err, ErrUnpairedPIO) {
+			result = "unchecked"
+		} else if c.Err != nil {
+			result = "error (" + c.Err.Error() + ")"
+		} else if !c.Passed {
+			result = "FAIL"
+		}
+		if _, err := fmt.Fprintf(w, "| %s | %s | %s | %s | %s |\n", c.Terminal, c.Instruction,
+			formatLevels(c.Expected), formatLevels(c.Measured), result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
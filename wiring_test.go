@@ -0,0 +1,107 @@
+package godaq
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckWiring(t *testing.T) {
+	daq, sim := newSimDAQ(t, ModelMId)
+	// AN3 and PIO3-PIO4 aren't wired
+	sim.Loopback = map[uint]uint{1: 1, 2: 1, 4: 1}
+	sim.PIOWires = map[uint]uint{1: 2, 2: 1, 5: 6, 6: 5}
+	assert.Nil(t, daq.ConfigureADC(5, 0, 1, 3))
+
+	var prompts []string
+	checks, err := daq.CheckWiring(WiringConfig{
+		Inputs: []uint{1, 2, 3, 4},
+		PIOs:   true,
+		Prompt: func(instruction string) error {
+			prompts = append(prompts, instruction)
+			if strings.HasSuffix(instruction, "AN2") {
+				return ErrSkipCheck
+			}
+			return nil
+		},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, checks, 4+3)
+	assert.Len(t, prompts, len(checks))
+	assert.Equal(t, "Connect the output 1 to the input AN1", prompts[0])
+
+	assert.True(t, checks[0].Passed)
+	assert.Len(t, checks[0].Measured, 2)
+	assert.Equal(t, ErrSkipCheck, checks[1].Err)
+	assert.False(t, checks[1].Passed)
+	assert.Nil(t, checks[2].Err)
+	assert.False(t, checks[2].Passed)
+	assert.True(t, checks[3].Passed)
+
+	assert.Equal(t, "PIO1-PIO2", checks[4].Terminal)
+	assert.True(t, checks[4].Passed)
+	assert.False(t, checks[5].Passed)
+	assert.True(t, checks[6].Passed)
+
+	// The configuration is restored
+	assert.Equal(t, []uint{5, 0, 1}, []uint{daq.posInput, daq.negInput, daq.gainId})
+	assert.EqualValues(t, 0, daq.portDir)
+
+	var b strings.Builder
+	assert.Nil(t, WriteWiringReport(&b, checks))
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	assert.Len(t, lines, 2+len(checks))
+	assert.Contains(t, lines[3], "skipped")
+	assert.Contains(t, lines[4], "FAIL")
+
+	// The prompt can abort the check
+	abort := errors.New("abort")
+	checks, err = daq.CheckWiring(WiringConfig{
+		Prompt: func(string) error { return abort },
+	})
+	assert.Equal(t, abort, err)
+	assert.Empty(t, checks)
+
+	// The output and the ADC configuration are restored when aborting after
+	// checking a terminal
+	prompts = nil
+	checks, err = daq.CheckWiring(WiringConfig{
+		Inputs: []uint{1, 2},
+		Prompt: func(instruction string) error {
+			if prompts = append(prompts, instruction); len(prompts) == 2 {
+				return abort
+			}
+			return nil
+		},
+	})
+	assert.Equal(t, abort, err)
+	if assert.Len(t, checks, 1) {
+		assert.True(t, checks[0].Passed)
+	}
+	assert.Zero(t, sim.DAC(1))
+	assert.Equal(t, []uint{5, 0, 1}, []uint{daq.posInput, daq.negInput, daq.gainId})
+
+	// A wrapped ErrSkipCheck skips the terminal and a PIO without a pair
+	// is reported unchecked
+	daq.NPIOs = 5
+	checks, err = daq.CheckWiring(WiringConfig{
+		Inputs: []uint{},
+		PIOs:   true,
+		Prompt: func(string) error { return fmt.Errorf("busy: %w", ErrSkipCheck) },
+	})
+	assert.Nil(t, err)
+	if assert.Len(t, checks, 3) {
+		assert.True(t, errors.Is(checks[0].Err, ErrSkipCheck))
+		assert.Equal(t, "PIO5", checks[2].Terminal)
+		assert.Equal(t, ErrUnpairedPIO, checks[2].Err)
+	}
+	b.Reset()
+	assert.Nil(t, WriteWiringReport(&b, checks))
+	assert.Contains(t, b.String(), "| PIO5 |  |  |  | unchecked |")
+
+	_, err = daq.CheckWiring(WiringConfig{})
+	assert.Equal(t, ErrNoPrompt, err)
+}